@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/agung-learns/ebook-go-further/internal/jsonlog"
+	"github.com/agung-learns/ebook-go-further/pkg/server"
+)
+
+func main() {
+	cfg := server.DefaultConfig()
+
+	flag.IntVar(&cfg.Port, "port", cfg.Port, "API server port")
+	flag.StringVar(&cfg.Env, "env", cfg.Env, "Environment (development|staging|production)")
+	flag.StringVar(&cfg.Mode, "mode", cfg.Mode, "Server mode (read-write|read-only)")
+
+	flag.StringVar(&cfg.DB.DSN, "db-dsn", os.Getenv("GREENLIGHT_DB_DSN"), "PostgreSQL DSN")
+	flag.StringVar(&cfg.DB.Schema, "db-schema", os.Getenv("GREENLIGHT_DB_SCHEMA"), "PostgreSQL schema holding the API's tables, for sharing a database with other applications (must exist; run the migrations with the same search_path)")
+	flag.StringVar(&cfg.DB.ReadDSN, "db-read-dsn", os.Getenv("GREENLIGHT_DB_READ_DSN"), "PostgreSQL DSN of a region-local read replica (optional)")
+	flag.IntVar(&cfg.DB.MaxOpenConns, "db-max-open-conns", cfg.DB.MaxOpenConns, "PostgreSQL max open connections")
+	flag.IntVar(&cfg.DB.MaxIdleConns, "db-max-idle-conns", cfg.DB.MaxIdleConns, "PostgreSQL max idle connections")
+	flag.StringVar(&cfg.DB.MaxIdleTime, "db-max-idle-time", cfg.DB.MaxIdleTime, "PostgreSQL max connection idle time")
+
+	flag.BoolVar(&cfg.WarmUp, "warm-up", cfg.WarmUp, "Warm up the database pool and hot reads before reporting ready")
+
+	flag.Float64Var(&cfg.Limiter.RPS, "limiter-rps", cfg.Limiter.RPS, "Rate limiter maximum requests per second")
+	flag.IntVar(&cfg.Limiter.Burst, "limiter-burst", cfg.Limiter.Burst, "Rate limiter maximum burst")
+	flag.BoolVar(&cfg.Limiter.Enabled, "limiter-enabled", cfg.Limiter.Enabled, "Enable rate limiter")
+	flag.StringVar(&cfg.Limiter.Backend, "limiter-backend", cfg.Limiter.Backend, "Where rate limiter state is kept (memory|redis); use redis to share the limit between instances")
+	flag.IntVar(&cfg.Limiter.GraceWindows, "limiter-grace-windows", cfg.Limiter.GraceWindows, "Minutes over the limit in which clients only get a warning header, before 429 responses begin (0 disables)")
+
+	flag.BoolVar(&cfg.Guest.Enabled, "guest-enabled", cfg.Guest.Enabled, "Let anonymous clients read the movie catalog")
+	flag.Float64Var(&cfg.Guest.RPS, "guest-limiter-rps", cfg.Guest.RPS, "Rate limiter maximum requests per second for anonymous catalog reads")
+	flag.IntVar(&cfg.Guest.Burst, "guest-limiter-burst", cfg.Guest.Burst, "Rate limiter maximum burst for anonymous catalog reads")
+
+	flag.IntVar(&cfg.Limits.MaxPageSize, "limit-max-page-size", cfg.Limits.MaxPageSize, "Maximum page_size for list endpoints")
+	flag.IntVar(&cfg.Limits.MaxOffset, "limit-max-offset", cfg.Limits.MaxOffset, "Maximum offset (in records) for list endpoints")
+	flag.Int64Var(&cfg.Limits.MaxBodySize, "limit-max-body-size", cfg.Limits.MaxBodySize, "Maximum size in bytes of JSON request bodies")
+	flag.Int64Var(&cfg.Limits.MaxPosterSize, "limit-max-poster-size", cfg.Limits.MaxPosterSize, "Maximum size in bytes of uploaded poster images")
+	flag.DurationVar(&cfg.Limits.ListTimeout, "limit-list-timeout", cfg.Limits.ListTimeout, "PostgreSQL statement timeout for list queries")
+
+	flag.StringVar(&cfg.JWT.Secret, "jwt-secret", os.Getenv("GREENLIGHT_JWT_SECRET"), "JWT HMAC secret")
+	flag.StringVar(&cfg.JWT.Issuer, "jwt-issuer", cfg.JWT.Issuer, "JWT issuer")
+	flag.StringVar(&cfg.JWT.Audience, "jwt-audience", cfg.JWT.Audience, "JWT audience")
+	flag.DurationVar(&cfg.JWT.TTL, "jwt-ttl", cfg.JWT.TTL, "JWT lifetime")
+	flag.DurationVar(&cfg.JWT.Leeway, "jwt-leeway", cfg.JWT.Leeway, "Clock skew tolerated when checking JWT expiry and not-before times (at most 5m)")
+	flag.StringVar(&cfg.JWT.RevocationBackend, "jwt-revocation-backend", cfg.JWT.RevocationBackend, "Where revoked authentication tokens are recorded (memory|redis); use redis to revoke them on every instance")
+	flag.StringVar(&cfg.JWT.SigningKeyID, "jwt-signing-key-id", cfg.JWT.SigningKeyID, "ID of the -jwt-key to sign JWTs with, instead of the HMAC secret")
+	flag.Func("jwt-key", "Add an RSA or Ed25519 PEM key file for JWTs, as kid=path (repeatable)", func(val string) error {
+		kid, path, err := server.ParseJWTKey(val)
+		if err != nil {
+			return err
+		}
+
+		if cfg.JWT.Keys == nil {
+			cfg.JWT.Keys = make(map[string]string)
+		}
+		cfg.JWT.Keys[kid] = path
+		return nil
+	})
+
+	flag.BoolVar(&cfg.FastCrypto, "fast-crypto", cfg.FastCrypto, "Use the minimum bcrypt cost (whatever the password hasher) and short JWT lifetimes, for test suites (refused with -env=production)")
+
+	flag.StringVar(&cfg.Passwords.Hasher, "password-hasher", cfg.Passwords.Hasher, "Algorithm for new password hashes (bcrypt|argon2id); existing hashes are upgraded at login")
+	flag.IntVar(&cfg.Passwords.BcryptCost, "password-bcrypt-cost", cfg.Passwords.BcryptCost, "bcrypt cost for new password hashes")
+	flag.UintVar(&cfg.Passwords.Argon2.Memory, "password-argon2-memory", cfg.Passwords.Argon2.Memory, "argon2id memory for new password hashes, in KiB")
+	flag.UintVar(&cfg.Passwords.Argon2.Time, "password-argon2-time", cfg.Passwords.Argon2.Time, "argon2id iterations for new password hashes")
+	flag.UintVar(&cfg.Passwords.Argon2.Threads, "password-argon2-threads", cfg.Passwords.Argon2.Threads, "argon2id parallelism for new password hashes")
+	flag.BoolVar(&cfg.Passwords.BreachCheck, "password-breach-check", cfg.Passwords.BreachCheck, "Reject new passwords found in the Have I Been Pwned breach corpus (sends the first 5 characters of the SHA-1 hash)")
+
+	flag.BoolVar(&cfg.Session.Enabled, "session-cookies", cfg.Session.Enabled, "Enable cookie-based sessions for first-party browser clients")
+
+	flag.Func("cors-trusted-origins", "Trusted CORS origins (space separated)", func(val string) error {
+		cfg.CORS.TrustedOrigins = strings.Fields(val)
+		return nil
+	})
+
+	flag.StringVar(&cfg.OTel.Endpoint, "otel-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "OTLP/HTTP trace exporter endpoint, as host:port (tracing is disabled if empty)")
+	flag.BoolVar(&cfg.OTel.Insecure, "otel-insecure", cfg.OTel.Insecure, "Use plain HTTP for the OTLP trace exporter")
+	flag.StringVar(&cfg.OTel.ServiceName, "otel-service-name", cfg.OTel.ServiceName, "Service name reported in traces")
+
+	flag.StringVar(&cfg.Mailer.Backend, "mailer-backend", cfg.Mailer.Backend, "Email backend (smtp|sendgrid|ses|log)")
+	flag.StringVar(&cfg.Mailer.Sender, "mailer-sender", cfg.Mailer.Sender, "Email sender address")
+	flag.StringVar(&cfg.Mailer.TemplateDir, "mailer-template-dir", cfg.Mailer.TemplateDir, "Re-read email templates from this directory on every send, for development (optional)")
+	flag.IntVar(&cfg.Mailer.Workers, "mailer-workers", cfg.Mailer.Workers, "Number of workers sending queued emails")
+	flag.IntVar(&cfg.Mailer.QueueSize, "mailer-queue-size", cfg.Mailer.QueueSize, "Maximum number of queued emails")
+	flag.IntVar(&cfg.Mailer.MaxAttempts, "mailer-max-attempts", cfg.Mailer.MaxAttempts, "Attempts at sending an email before giving up, and dead-lettering it if it was queued")
+	flag.DurationVar(&cfg.Mailer.RetryBackoff, "mailer-retry-backoff", cfg.Mailer.RetryBackoff, "Wait before the first retry of a failed email, doubling with each retry (jittered)")
+	flag.DurationVar(&cfg.Mailer.RetryMaxBackoff, "mailer-retry-max-backoff", cfg.Mailer.RetryMaxBackoff, "Longest wait between retries of a failed email")
+	flag.StringVar(&cfg.Mailer.SMTP.Host, "smtp-host", cfg.Mailer.SMTP.Host, "SMTP host")
+	flag.IntVar(&cfg.Mailer.SMTP.Port, "smtp-port", cfg.Mailer.SMTP.Port, "SMTP port")
+	flag.StringVar(&cfg.Mailer.SMTP.Username, "smtp-username", os.Getenv("GREENLIGHT_SMTP_USERNAME"), "SMTP username")
+	flag.StringVar(&cfg.Mailer.SMTP.Password, "smtp-password", os.Getenv("GREENLIGHT_SMTP_PASSWORD"), "SMTP password")
+	flag.StringVar(&cfg.Mailer.SendGrid.APIKey, "sendgrid-api-key", os.Getenv("SENDGRID_API_KEY"), "SendGrid API key")
+	flag.StringVar(&cfg.Mailer.SES.Region, "ses-region", os.Getenv("AWS_REGION"), "AWS region for SES")
+
+	flag.StringVar(&cfg.Storage.Backend, "storage-backend", cfg.Storage.Backend, "Where uploaded movie posters are kept (disk|s3)")
+	flag.StringVar(&cfg.Storage.Disk.Dir, "storage-dir", cfg.Storage.Disk.Dir, "Directory the disk storage backend writes posters to")
+	flag.StringVar(&cfg.Storage.Disk.URL, "storage-dir-url", cfg.Storage.Disk.URL, "URL the poster directory is served at (the API serves it at /uploads by default)")
+	flag.StringVar(&cfg.Storage.S3.Bucket, "s3-bucket", cfg.Storage.S3.Bucket, "S3 bucket for posters")
+	flag.StringVar(&cfg.Storage.S3.Region, "s3-region", os.Getenv("AWS_REGION"), "AWS region of the S3 bucket")
+	flag.StringVar(&cfg.Storage.S3.Endpoint, "s3-endpoint", cfg.Storage.S3.Endpoint, "Endpoint of an S3-compatible store, such as MinIO (default: AWS S3)")
+	flag.StringVar(&cfg.Storage.S3.URL, "s3-url", cfg.Storage.S3.URL, "URL posters are downloaded from, such as a CDN in front of the bucket (default: the bucket)")
+
+	flag.BoolVar(&cfg.Cache.Enabled, "cache-enabled", cfg.Cache.Enabled, "Cache responses of the movie read endpoints, and send Cache-Control and Last-Modified headers")
+	flag.StringVar(&cfg.Cache.Backend, "cache-backend", cfg.Cache.Backend, "Where cached responses are kept (memory|redis)")
+	flag.IntVar(&cfg.Cache.Size, "cache-size", cfg.Cache.Size, "Maximum number of cached responses, for the memory backend")
+	flag.DurationVar(&cfg.Cache.TTL, "cache-ttl", cfg.Cache.TTL, "Time a cached response is served as fresh")
+	flag.DurationVar(&cfg.Cache.StaleWhileRevalidate, "cache-stale-while-revalidate", cfg.Cache.StaleWhileRevalidate, "Time an expired response is still served while it is refreshed in the background")
+
+	flag.BoolVar(&cfg.Compression.Enabled, "compression-enabled", cfg.Compression.Enabled, "Compress textual responses with gzip or deflate when the client accepts it")
+	flag.IntVar(&cfg.Compression.MinSize, "compression-min-size", cfg.Compression.MinSize, "Minimum response body size in bytes to compress")
+	flag.IntVar(&cfg.Compression.Level, "compression-level", cfg.Compression.Level, "Compression level, from -2 (Huffman only) to 9 (best); -1 is the default level")
+
+	flag.StringVar(&cfg.Redis.Addr, "redis-addr", os.Getenv("GREENLIGHT_REDIS_ADDR"), "Redis server address, as host:port, for features configured to use Redis")
+	flag.StringVar(&cfg.Redis.Password, "redis-password", os.Getenv("GREENLIGHT_REDIS_PASSWORD"), "Redis password")
+	flag.IntVar(&cfg.Redis.DB, "redis-db", cfg.Redis.DB, "Redis database number")
+	flag.IntVar(&cfg.Redis.PoolSize, "redis-pool-size", cfg.Redis.PoolSize, "Maximum number of idle Redis connections")
+
+	flag.BoolVar(&cfg.Analytics.Enabled, "analytics-enabled", cfg.Analytics.Enabled, "Accept anonymous client analytics events at POST /v1/events")
+	flag.Float64Var(&cfg.Analytics.SampleRate, "analytics-sample-rate", cfg.Analytics.SampleRate, "Fraction of analytics events which are stored (0-1)")
+	flag.IntVar(&cfg.Analytics.BufferSize, "analytics-buffer-size", cfg.Analytics.BufferSize, "Maximum number of analytics events waiting to be exported")
+	flag.IntVar(&cfg.Analytics.BatchSize, "analytics-batch-size", cfg.Analytics.BatchSize, "Number of analytics events exported per batch")
+	flag.DurationVar(&cfg.Analytics.FlushInterval, "analytics-flush-interval", cfg.Analytics.FlushInterval, "Maximum time analytics events wait before they are exported")
+
+	flag.DurationVar(&cfg.Status.CheckInterval, "status-check-interval", cfg.Status.CheckInterval, "Interval between the health checks recorded for the status page")
+	flag.DurationVar(&cfg.Status.ProbeInterval, "readiness-probe-interval", cfg.Status.ProbeInterval, "Interval between the database probes behind /v1/readyz")
+	flag.IntVar(&cfg.Status.ReadinessRise, "readiness-rise", cfg.Status.ReadinessRise, "Consecutive successful probes before /v1/readyz reports ready again")
+	flag.IntVar(&cfg.Status.ReadinessFall, "readiness-fall", cfg.Status.ReadinessFall, "Consecutive failed probes before /v1/readyz reports not ready")
+
+	flag.StringVar(&cfg.Site.Name, "site-name", cfg.Site.Name, "Website name shown in movie preview cards")
+	flag.StringVar(&cfg.Site.URL, "site-url", cfg.Site.URL, "Website base URL, for the links in movie preview cards (omitted if empty)")
+
+	flag.DurationVar(&cfg.Tokens.CleanupInterval, "token-cleanup-interval", cfg.Tokens.CleanupInterval, "Interval between purges of expired activation and email change tokens (0 disables)")
+
+	flag.IntVar(&cfg.TOTP.MaxFailures, "totp-max-failures", cfg.TOTP.MaxFailures, "Failed two-factor attempts allowed per user within -totp-failure-window before further attempts are refused")
+	flag.DurationVar(&cfg.TOTP.FailureWindow, "totp-failure-window", cfg.TOTP.FailureWindow, "Window, from the first failure, in which failed two-factor attempts are counted")
+
+	flag.Int64Var(&cfg.IDs.Node, "id-node", cfg.IDs.Node, "Node number of this instance in generated IDs (0-1023, unique per instance)")
+	flag.Func("id-strategy", "Set how a resource's IDs are generated, as resource=serial|snowflake, for movies or users (repeatable)", func(val string) error {
+		resource, strategy, err := server.ParseIDStrategy(val)
+		if err != nil {
+			return err
+		}
+
+		if cfg.IDs.Strategies == nil {
+			cfg.IDs.Strategies = make(map[string]string)
+		}
+		cfg.IDs.Strategies[resource] = strategy
+		return nil
+	})
+
+	flag.BoolVar(&cfg.Retention.Enabled, "retention-enabled", cfg.Retention.Enabled, "Periodically delete data older than the retention rules allow")
+	flag.BoolVar(&cfg.Retention.DryRun, "retention-dry-run", cfg.Retention.DryRun, "Only log how many rows the retention rules would delete")
+	flag.DurationVar(&cfg.Retention.Interval, "retention-interval", cfg.Retention.Interval, "Interval between retention runs")
+	flag.Func("retention-rule", "Add or replace a retention rule, as name=table.column:max-age (repeatable)", func(val string) error {
+		rule, err := server.ParseRetentionRule(val)
+		if err != nil {
+			return err
+		}
+
+		cfg.SetRetentionRule(rule)
+		return nil
+	})
+
+	flag.StringVar(&cfg.Region, "region", os.Getenv("GREENLIGHT_REGION"), "Region this instance is deployed in (optional)")
+
+	flag.StringVar(&cfg.Examples.Dir, "examples-dir", cfg.Examples.Dir, "Record anonymized request and response examples for the API docs to this directory (development only)")
+	flag.StringVar(&cfg.Feed.BaseURL, "feed-base-url", cfg.Feed.BaseURL, "Public URL of the API, which the movie feeds link to (default: the URL of the request)")
+	flag.StringVar(&cfg.Feed.WebSubHub, "websub-hub", cfg.Feed.WebSubHub, "WebSub hub to notify when the movie feeds change (requires -feed-base-url)")
+	flag.BoolVar(&cfg.Docs.Enabled, "docs-enabled", cfg.Docs.Enabled, "Serve Swagger UI for the OpenAPI document at /docs (never in production)")
+
+	flag.BoolVar(&cfg.EnvelopeMeta, "envelope-meta", cfg.EnvelopeMeta, "Add a meta object with operational information to JSON responses")
+
+	flag.Parse()
+
+	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
+
+	srv, err := server.New(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	err = srv.Run(ctx)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+}
@@ -0,0 +1,359 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNil is returned by the typed helpers when the key doesn't exist.
+var ErrNil = errors.New("redis: nil")
+
+// RedisError is an error reply from the server, such as WRONGTYPE.
+type RedisError string
+
+func (e RedisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// Redis is a client for a single Redis server, speaking just enough of the
+// RESP2 protocol for the commands the API uses. Connections are pooled and
+// safe for concurrent use.
+type Redis struct {
+	addr     string
+	password string
+	db       int
+	timeout  time.Duration
+	pool     chan *redisConn
+}
+
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// NewRedis returns a client for the server at addr, keeping up to poolSize
+// idle connections. Connections are opened lazily, so a server which is down
+// is only reported by the first command.
+func NewRedis(addr, password string, db, poolSize int) *Redis {
+	return &Redis{
+		addr:     addr,
+		password: password,
+		db:       db,
+		timeout:  2 * time.Second,
+		pool:     make(chan *redisConn, max(poolSize, 1)),
+	}
+}
+
+// Do sends a command and returns its reply: a string for simple strings,
+// an int64 for integers, a []byte or nil for bulk strings, and a []any for
+// arrays. Error replies are returned as a RedisError.
+func (c *Redis) Do(ctx context.Context, args ...string) (any, error) {
+	conn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.do(ctx, c.timeout, args)
+	if err != nil {
+		var redisErr RedisError
+		if !errors.As(err, &redisErr) {
+			// The connection may be in an unknown state.
+			conn.conn.Close()
+			return nil, err
+		}
+	}
+
+	c.put(conn)
+
+	return reply, err
+}
+
+// Get returns the value of key, or ErrNil if it doesn't exist.
+func (c *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	reply, err := c.Do(ctx, "GET", key)
+	if err != nil {
+		return nil, err
+	}
+
+	if reply == nil {
+		return nil, ErrNil
+	}
+
+	b, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected GET reply %T", reply)
+	}
+
+	return b, nil
+}
+
+// Set stores value under key, expiring it after ttl if ttl is positive. A
+// TTL under a millisecond is rounded up to one, since Redis rejects PX 0.
+func (c *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(max(ttl.Milliseconds(), 1), 10))
+	}
+
+	_, err := c.Do(ctx, args...)
+	return err
+}
+
+// Del deletes the keys, and returns how many existed.
+func (c *Redis) Del(ctx context.Context, keys ...string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	reply, err := c.Do(ctx, append([]string{"DEL"}, keys...)...)
+	if err != nil {
+		return 0, err
+	}
+
+	n, _ := reply.(int64)
+	return n, nil
+}
+
+// Exists reports whether key exists.
+func (c *Redis) Exists(ctx context.Context, key string) (bool, error) {
+	reply, err := c.Do(ctx, "EXISTS", key)
+	if err != nil {
+		return false, err
+	}
+
+	n, _ := reply.(int64)
+	return n > 0, nil
+}
+
+// Script is a Lua script which is run atomically on the server. It is sent
+// by its SHA1 digest, and only in full when the server hasn't cached it yet.
+type Script struct {
+	src string
+	sha string
+}
+
+func NewScript(src string) *Script {
+	sum := sha1.Sum([]byte(src))
+	return &Script{src: src, sha: hex.EncodeToString(sum[:])}
+}
+
+// Run runs the script with the keys and arguments, and returns its reply as
+// Do does.
+func (s *Script) Run(ctx context.Context, c *Redis, keys []string, args ...string) (any, error) {
+	cmd := make([]string, 0, 3+len(keys)+len(args))
+	cmd = append(cmd, "EVALSHA", s.sha, strconv.Itoa(len(keys)))
+	cmd = append(cmd, keys...)
+	cmd = append(cmd, args...)
+
+	reply, err := c.Do(ctx, cmd...)
+
+	var redisErr RedisError
+	if errors.As(err, &redisErr) && strings.HasPrefix(string(redisErr), "NOSCRIPT") {
+		cmd[0], cmd[1] = "EVAL", s.src
+		reply, err = c.Do(ctx, cmd...)
+	}
+
+	return reply, err
+}
+
+// Scan calls fn with every batch of keys matching the glob pattern, using
+// SCAN so that the server isn't blocked on a large keyspace.
+func (c *Redis) Scan(ctx context.Context, pattern string, fn func(keys []string) error) error {
+	cursor := "0"
+
+	for {
+		reply, err := c.Do(ctx, "SCAN", cursor, "MATCH", pattern, "COUNT", "500")
+		if err != nil {
+			return err
+		}
+
+		parts, ok := reply.([]any)
+		if !ok || len(parts) != 2 {
+			return fmt.Errorf("redis: unexpected SCAN reply %v", reply)
+		}
+
+		next, _ := parts[0].([]byte)
+		items, _ := parts[1].([]any)
+
+		keys := make([]string, 0, len(items))
+		for _, item := range items {
+			if b, ok := item.([]byte); ok {
+				keys = append(keys, string(b))
+			}
+		}
+
+		if len(keys) > 0 {
+			err = fn(keys)
+			if err != nil {
+				return err
+			}
+		}
+
+		cursor = string(next)
+		if cursor == "0" || cursor == "" {
+			return nil
+		}
+	}
+}
+
+// Close closes the idle connections.
+func (c *Redis) Close() error {
+	for {
+		select {
+		case conn := <-c.pool:
+			conn.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *Redis) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-c.pool:
+		return conn, nil
+	default:
+	}
+
+	dialer := net.Dialer{Timeout: c.timeout}
+
+	netConn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &redisConn{
+		conn: netConn,
+		r:    bufio.NewReader(netConn),
+		w:    bufio.NewWriter(netConn),
+	}
+
+	if c.password != "" {
+		_, err = conn.do(ctx, c.timeout, []string{"AUTH", c.password})
+		if err != nil {
+			netConn.Close()
+			return nil, err
+		}
+	}
+
+	if c.db != 0 {
+		_, err = conn.do(ctx, c.timeout, []string{"SELECT", strconv.Itoa(c.db)})
+		if err != nil {
+			netConn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+func (c *Redis) put(conn *redisConn) {
+	select {
+	case c.pool <- conn:
+	default:
+		conn.conn.Close()
+	}
+}
+
+func (conn *redisConn) do(ctx context.Context, timeout time.Duration, args []string) (any, error) {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.conn.SetDeadline(deadline)
+
+	fmt.Fprintf(conn.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(conn.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	err := conn.w.Flush()
+	if err != nil {
+		return nil, err
+	}
+
+	return conn.readReply()
+}
+
+func (conn *redisConn) readReply() (any, error) {
+	line, err := conn.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, RedisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+
+		b := make([]byte, n+2)
+		_, err = io.ReadFull(conn.r, b)
+		if err != nil {
+			return nil, err
+		}
+
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+
+		items := make([]any, n)
+		for i := range items {
+			items[i], err = conn.readReply()
+			if err != nil {
+				var redisErr RedisError
+				if !errors.As(err, &redisErr) {
+					return nil, err
+				}
+				items[i] = redisErr
+			}
+		}
+
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply type %q", line[0])
+	}
+}
+
+func (conn *redisConn) readLine() (string, error) {
+	line, err := conn.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", errors.New("redis: malformed reply")
+	}
+
+	return line[:len(line)-2], nil
+}
@@ -0,0 +1,447 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  any
+		err   error
+	}{
+		{name: "simple string", input: "+OK\r\n", want: "OK"},
+		{name: "error", input: "-WRONGTYPE wrong kind of value\r\n", err: RedisError("WRONGTYPE wrong kind of value")},
+		{name: "integer", input: ":42\r\n", want: int64(42)},
+		{name: "negative integer", input: ":-1\r\n", want: int64(-1)},
+		{name: "bulk string", input: "$5\r\nhello\r\n", want: []byte("hello")},
+		{name: "bulk string with CRLF", input: "$4\r\na\r\nb\r\n", want: []byte("a\r\nb")},
+		{name: "empty bulk string", input: "$0\r\n\r\n", want: []byte{}},
+		{name: "nil bulk string", input: "$-1\r\n", want: nil},
+		{name: "nil array", input: "*-1\r\n", want: nil},
+		{name: "empty array", input: "*0\r\n", want: []any{}},
+		{
+			name:  "nested array",
+			input: "*3\r\n$1\r\n0\r\n*2\r\n$1\r\na\r\n$1\r\nb\r\n:7\r\n",
+			want:  []any{[]byte("0"), []any{[]byte("a"), []byte("b")}, int64(7)},
+		},
+		{
+			name:  "array holding an error",
+			input: "*2\r\n+OK\r\n-ERR failed\r\n",
+			want:  []any{"OK", RedisError("ERR failed")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &redisConn{r: bufio.NewReader(strings.NewReader(tt.input))}
+
+			got, err := conn.readReply()
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadReplyMalformed(t *testing.T) {
+	inputs := []string{
+		"",
+		"\r\n",
+		"+OK\n",
+		"?what\r\n",
+		":notanumber\r\n",
+		"$5\r\nabc\r\n",
+		"*2\r\n:1\r\n",
+	}
+
+	for _, input := range inputs {
+		conn := &redisConn{r: bufio.NewReader(strings.NewReader(input))}
+
+		_, err := conn.readReply()
+		if err == nil {
+			t.Errorf("readReply(%q) succeeded, want an error", input)
+		}
+
+		var redisErr RedisError
+		if errors.As(err, &redisErr) {
+			t.Errorf("readReply(%q) returned a server error %v, want a protocol error", input, err)
+		}
+	}
+}
+
+// fakeRedis is a server speaking enough RESP2 for the client's commands,
+// backed by a map. It records the commands it receives.
+type fakeRedis struct {
+	t        *testing.T
+	ln       net.Listener
+	password string
+
+	mu       sync.Mutex
+	data     map[string]string
+	commands [][]string
+	scripts  map[string]bool
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &fakeRedis{t: t, ln: ln, password: password, data: make(map[string]string), scripts: make(map[string]bool)}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *fakeRedis) addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *fakeRedis) lastCommand(name string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.commands) - 1; i >= 0; i-- {
+		if s.commands[i][0] == name {
+			return s.commands[i]
+		}
+	}
+
+	return nil
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	authenticated := s.password == ""
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.commands = append(s.commands, args)
+
+		var reply string
+
+		switch {
+		case args[0] == "AUTH":
+			if args[1] == s.password {
+				authenticated = true
+				reply = "+OK\r\n"
+			} else {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authenticated:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case args[0] == "SELECT":
+			reply = "+OK\r\n"
+		case args[0] == "GET":
+			if value, ok := s.data[args[1]]; ok {
+				reply = bulk(value)
+			} else {
+				reply = "$-1\r\n"
+			}
+		case args[0] == "SET":
+			if len(args) == 5 && args[3] == "PX" {
+				if ms, err := strconv.Atoi(args[4]); err != nil || ms <= 0 {
+					reply = "-ERR invalid expire time in 'set' command\r\n"
+					break
+				}
+			}
+			s.data[args[1]] = args[2]
+			reply = "+OK\r\n"
+		case args[0] == "DEL":
+			n := 0
+			for _, key := range args[1:] {
+				if _, ok := s.data[key]; ok {
+					delete(s.data, key)
+					n++
+				}
+			}
+			reply = fmt.Sprintf(":%d\r\n", n)
+		case args[0] == "EXISTS":
+			if _, ok := s.data[args[1]]; ok {
+				reply = ":1\r\n"
+			} else {
+				reply = ":0\r\n"
+			}
+		case args[0] == "SCAN":
+			reply = s.scan(args[1], args[3])
+		case args[0] == "EVALSHA":
+			if s.scripts[args[1]] {
+				reply = ":1\r\n"
+			} else {
+				reply = "-NOSCRIPT No matching script.\r\n"
+			}
+		case args[0] == "EVAL":
+			reply = ":1\r\n"
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		s.mu.Unlock()
+
+		_, err = io.WriteString(conn, reply)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// scan returns the matching keys in batches of two, so that the client has
+// to follow the cursor.
+func (s *fakeRedis) scan(cursor, pattern string) string {
+	var keys []string
+	for key := range s.data {
+		if ok, _ := path.Match(pattern, key); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	start, _ := strconv.Atoi(cursor)
+	end := min(start+2, len(keys))
+
+	next := strconv.Itoa(end)
+	if end == len(keys) {
+		next = "0"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*2\r\n%s*%d\r\n", bulk(next), end-start)
+	for _, key := range keys[start:end] {
+		b.WriteString(bulk(key))
+	}
+
+	return b.String()
+}
+
+func bulk(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	conn := &redisConn{r: r}
+
+	reply, err := conn.readReply()
+	if err != nil {
+		return nil, err
+	}
+
+	items, ok := reply.([]any)
+	if !ok || len(items) == 0 {
+		return nil, errors.New("command isn't an array")
+	}
+
+	args := make([]string, len(items))
+	for i, item := range items {
+		b, ok := item.([]byte)
+		if !ok {
+			return nil, errors.New("command argument isn't a bulk string")
+		}
+		args[i] = string(b)
+	}
+
+	return args, nil
+}
+
+func TestRedisRoundTrip(t *testing.T) {
+	server := newFakeRedis(t, "s3cret")
+
+	c := NewRedis(server.addr(), "s3cret", 2, 2)
+	defer c.Close()
+
+	ctx := context.Background()
+
+	_, err := c.Get(ctx, "missing")
+	if !errors.Is(err, ErrNil) {
+		t.Fatalf("Get of a missing key returned %v, want ErrNil", err)
+	}
+
+	if got := server.lastCommand("SELECT"); !reflect.DeepEqual(got, []string{"SELECT", "2"}) {
+		t.Errorf("got %q, want the database to be selected", got)
+	}
+
+	// Values are binary-safe, including CRLF.
+	value := []byte("line one\r\nline two\x00")
+
+	err = c.Set(ctx, "key", value, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := server.lastCommand("SET"); !reflect.DeepEqual(got[3:], []string{"PX", "60000"}) {
+		t.Errorf("got %q, want PX 60000", got)
+	}
+
+	got, err := c.Get(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != string(value) {
+		t.Errorf("got %q, want %q", got, value)
+	}
+
+	exists, err := c.Exists(ctx, "key")
+	if err != nil || !exists {
+		t.Errorf("Exists returned %v, %v; want true", exists, err)
+	}
+
+	n, err := c.Del(ctx, "key", "missing")
+	if err != nil || n != 1 {
+		t.Errorf("Del returned %d, %v; want 1", n, err)
+	}
+
+	exists, err = c.Exists(ctx, "key")
+	if err != nil || exists {
+		t.Errorf("Exists returned %v, %v; want false", exists, err)
+	}
+}
+
+func TestRedisSetRoundsUpShortTTL(t *testing.T) {
+	server := newFakeRedis(t, "")
+
+	c := NewRedis(server.addr(), "", 0, 1)
+	defer c.Close()
+
+	err := c.Set(context.Background(), "key", []byte("v"), 500*time.Microsecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := server.lastCommand("SET"); !reflect.DeepEqual(got[3:], []string{"PX", "1"}) {
+		t.Errorf("got %q, want PX 1", got)
+	}
+
+	err = c.Set(context.Background(), "key", []byte("v"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := server.lastCommand("SET"); len(got) != 3 {
+		t.Errorf("got %q, want no expiry", got)
+	}
+}
+
+func TestRedisErrors(t *testing.T) {
+	server := newFakeRedis(t, "s3cret")
+	ctx := context.Background()
+
+	c := NewRedis(server.addr(), "wrong", 0, 1)
+	defer c.Close()
+
+	_, err := c.Get(ctx, "key")
+
+	var redisErr RedisError
+	if !errors.As(err, &redisErr) || !strings.HasPrefix(string(redisErr), "WRONGPASS") {
+		t.Errorf("got %v, want a WRONGPASS error", err)
+	}
+
+	c = NewRedis(server.addr(), "s3cret", 0, 1)
+	defer c.Close()
+
+	// An error reply leaves the connection usable.
+	_, err = c.Do(ctx, "NOPE")
+	if !errors.As(err, &redisErr) {
+		t.Fatalf("got %v, want a RedisError", err)
+	}
+
+	err = c.Set(ctx, "key", []byte("v"), 0)
+	if err != nil {
+		t.Errorf("command after an error reply failed: %v", err)
+	}
+}
+
+func TestRedisScan(t *testing.T) {
+	server := newFakeRedis(t, "")
+
+	c := NewRedis(server.addr(), "", 0, 1)
+	defer c.Close()
+
+	ctx := context.Background()
+
+	for _, key := range []string{"cache:a", "cache:b", "cache:c", "cache:d", "cache:e", "other"} {
+		err := c.Set(ctx, key, []byte("v"), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	batches := 0
+
+	err := c.Scan(ctx, "cache:*", func(keys []string) error {
+		got = append(got, keys...)
+		batches++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"cache:a", "cache:b", "cache:c", "cache:d", "cache:e"}
+	if !reflect.DeepEqual(got, want) || batches != 3 {
+		t.Errorf("got %q in %d batches, want %q in 3", got, batches, want)
+	}
+}
+
+func TestScriptFallsBackToEval(t *testing.T) {
+	server := newFakeRedis(t, "")
+
+	c := NewRedis(server.addr(), "", 0, 1)
+	defer c.Close()
+
+	script := NewScript("return 1")
+
+	reply, err := script.Run(context.Background(), c, []string{"key"}, "arg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reply != int64(1) {
+		t.Errorf("got %#v, want 1", reply)
+	}
+
+	want := []string{"EVAL", "return 1", "1", "key", "arg"}
+	if got := server.lastCommand("EVAL"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if got := server.lastCommand("EVALSHA"); got[1] != script.sha {
+		t.Errorf("EVALSHA sent digest %q, want %q", got[1], script.sha)
+	}
+}
@@ -0,0 +1,101 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+
+	"github.com/lib/pq"
+)
+
+// AnalyticsEventSchemas lists the event types clients can send, and the
+// properties each of them accepts. Properties which aren't listed are
+// rejected, so clients can't send (and we can't accidentally store)
+// personal data such as names or email addresses.
+var AnalyticsEventSchemas = map[string][]string{
+	"screen_view": {"screen", "referrer_screen"},
+	"search":      {"term", "results"},
+}
+
+// AnalyticsEvent is a single piece of anonymous client telemetry. It is
+// never linked to a user account; AnonymousID is a random identifier which
+// the client generates, and is hashed before it is stored.
+type AnalyticsEvent struct {
+	Type        string            `json:"type"`
+	AnonymousID string            `json:"anonymous_id"`
+	OccurredAt  time.Time         `json:"occurred_at"`
+	Properties  map[string]string `json:"properties"`
+}
+
+// ValidateAnalyticsEvent checks event against its schema. The key prefixes
+// the field names in error messages, so that errors can be reported for a
+// single event in a batch.
+func ValidateAnalyticsEvent(v *validator.Validator, key string, event *AnalyticsEvent) {
+	properties, ok := AnalyticsEventSchemas[event.Type]
+	v.Check(ok, key+".type", "must be a known event type")
+
+	v.Check(event.AnonymousID != "", key+".anonymous_id", "must be provided")
+	v.Check(len(event.AnonymousID) <= 100, key+".anonymous_id", "must not be more than 100 bytes long")
+
+	v.Check(!event.OccurredAt.IsZero(), key+".occurred_at", "must be provided")
+	v.Check(event.OccurredAt.Before(time.Now().Add(time.Hour)), key+".occurred_at", "must not be in the future")
+	v.Check(event.OccurredAt.After(time.Now().Add(-7*24*time.Hour)), key+".occurred_at", "must not be more than 7 days ago")
+
+	if !ok {
+		return
+	}
+
+	for name, value := range event.Properties {
+		v.Check(validator.PermittedValue(name, properties...), key+".properties."+name, "is not permitted for this event type")
+		v.Check(len(value) <= 200, key+".properties."+name, "must not be more than 200 bytes long")
+	}
+}
+
+type AnalyticsEventModel struct {
+	DB Querier
+}
+
+// InsertBatch stores the events with a single statement.
+func (m AnalyticsEventModel) InsertBatch(events []AnalyticsEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO analytics_events (type, anonymous_id, properties, occurred_at)
+		SELECT * FROM unnest($1::text[], $2::text[], $3::jsonb[], $4::timestamptz[])`
+
+	types := make([]string, len(events))
+	anonymousIDs := make([]string, len(events))
+	properties := make([]string, len(events))
+	occurredAt := make([]string, len(events))
+
+	for i, event := range events {
+		js, err := json.Marshal(event.Properties)
+		if err != nil {
+			return err
+		}
+
+		hash := sha256.Sum256([]byte(event.AnonymousID))
+
+		types[i] = event.Type
+		anonymousIDs[i] = hex.EncodeToString(hash[:16])
+		properties[i] = string(js)
+		occurredAt[i] = event.OccurredAt.Format(time.RFC3339)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, pq.Array(types), pq.Array(anonymousIDs), pq.Array(properties), pq.Array(occurredAt))
+	if err != nil {
+		return fmt.Errorf("inserting %d analytics events: %w", len(events), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,253 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+
+	"github.com/lib/pq"
+)
+
+// The deliverability statuses of a user's email address. Addresses are
+// unchecked until the first email check, and unknown when the check
+// couldn't be completed, such as when DNS timed out.
+const (
+	EmailUnchecked     = "unchecked"
+	EmailDeliverable   = "deliverable"
+	EmailInvalidSyntax = "invalid_syntax"
+	EmailNoMailServer  = "no_mail_server"
+	EmailSuppressed    = "suppressed"
+	EmailUnknown       = "unknown"
+)
+
+// EmailStatuses lists the statuses, in the order they are reported in.
+var EmailStatuses = []string{EmailUnchecked, EmailDeliverable, EmailInvalidSyntax, EmailNoMailServer, EmailSuppressed, EmailUnknown}
+
+// Undeliverable reports whether mail to an address with the status would
+// not arrive.
+func Undeliverable(status string) bool {
+	return status == EmailInvalidSyntax || status == EmailNoMailServer || status == EmailSuppressed
+}
+
+var ErrDuplicateSuppression = errors.New("duplicate suppression")
+
+// EmailCheck is the outcome of checking one user's email address.
+type EmailCheck struct {
+	UserID int64
+	Email  string
+	Status string
+}
+
+// EmailSuppression is an address which must not be sent mail, such as one
+// which hard bounced or whose owner complained.
+type EmailSuppression struct {
+	Email     string    `json:"email"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func ValidateEmailSuppression(v *validator.Validator, suppression *EmailSuppression) {
+	ValidateEmail(v, suppression.Email)
+	v.Check(suppression.Reason != "", "reason", "must be provided")
+	v.Check(len(suppression.Reason) <= 500, "reason", "must not be more than 500 bytes long")
+}
+
+type EmailCheckModel struct {
+	DB Querier
+}
+
+// GetBatch returns up to limit users with an ID greater than afterID, in ID
+// order, with their email address in the Email field.
+func (m EmailCheckModel) GetBatch(afterID int64, limit int) ([]EmailCheck, error) {
+	query := `
+		SELECT id, email
+		FROM users
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checks := []EmailCheck{}
+
+	for rows.Next() {
+		var check EmailCheck
+
+		err := rows.Scan(&check.UserID, &check.Email)
+		if err != nil {
+			return nil, err
+		}
+
+		checks = append(checks, check)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return checks, nil
+}
+
+// Suppressed returns which of the addresses are on the suppression list.
+func (m EmailCheckModel) Suppressed(emails []string) (map[string]bool, error) {
+	query := `
+		SELECT lower(email::text)
+		FROM email_suppressions
+		WHERE email = ANY($1::citext[])`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(emails))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suppressed := make(map[string]bool)
+
+	for rows.Next() {
+		var email string
+
+		err := rows.Scan(&email)
+		if err != nil {
+			return nil, err
+		}
+
+		suppressed[email] = true
+	}
+
+	return suppressed, rows.Err()
+}
+
+// SaveBatch records the statuses of the checks. A user whose email has
+// changed since it was read keeps their status, since it was checked for
+// the old address.
+func (m EmailCheckModel) SaveBatch(checks []EmailCheck) error {
+	if len(checks) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(checks))
+	emails := make([]string, len(checks))
+	statuses := make([]string, len(checks))
+
+	for i, check := range checks {
+		ids[i] = check.UserID
+		emails[i] = check.Email
+		statuses[i] = check.Status
+	}
+
+	query := `
+		UPDATE users
+		SET email_status = checks.status, email_checked_at = NOW()
+		FROM unnest($1::bigint[], $2::text[], $3::text[]) AS checks (id, email, status)
+		WHERE users.id = checks.id AND users.email = checks.email::citext`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, pq.Array(ids), pq.Array(emails), pq.Array(statuses))
+	return err
+}
+
+// CountByStatus returns how many users have each email status. Every
+// status is included, with zero counts.
+func (m EmailCheckModel) CountByStatus() (map[string]int, error) {
+	query := `
+		SELECT email_status, count(*)
+		FROM users
+		GROUP BY email_status`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int, len(EmailStatuses))
+	for _, status := range EmailStatuses {
+		counts[status] = 0
+	}
+
+	for rows.Next() {
+		var (
+			status string
+			count  int
+		)
+
+		err := rows.Scan(&status, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		counts[status] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// InsertSuppression adds an address to the suppression list. It returns
+// ErrDuplicateSuppression if the address is already on it.
+func (m EmailCheckModel) InsertSuppression(suppression *EmailSuppression) error {
+	query := `
+		INSERT INTO email_suppressions (email, reason)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+		RETURNING created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, suppression.Email, suppression.Reason).Scan(&suppression.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrDuplicateSuppression
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteSuppression removes an address from the suppression list. Users
+// with the address stay suppressed until the next email check.
+func (m EmailCheckModel) DeleteSuppression(email string) error {
+	query := `
+		DELETE FROM email_suppressions
+		WHERE email = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, email)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
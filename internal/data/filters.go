@@ -0,0 +1,263 @@
+package data
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+)
+
+const (
+	DefaultMaxPageSize = 100
+	DefaultMaxOffset   = 1_000_000
+)
+
+// SortKeys declares the keys a resource can be sorted by, mapped to the SQL
+// expression used to order by each of them. Expressions can be plain column
+// names or computed values such as function calls or subqueries; they are
+// written by us, never taken from the client, so they are safe to
+// interpolate into a query. Clients prefix a key with "-" to sort in
+// descending order.
+type SortKeys map[string]string
+
+type Filters struct {
+	Page     int
+	PageSize int
+	Sort     string
+	SortKeys SortKeys
+
+	// MaxPageSize and MaxOffset are server-side safety caps on page_size and
+	// on how far into the results a client can page. Zero values mean the
+	// DefaultMaxPageSize and DefaultMaxOffset caps.
+	MaxPageSize int
+	MaxOffset   int
+
+	// After switches from offset to keyset pagination when it is non-nil:
+	// Page is ignored, and results start just after the cursor position. A
+	// zero Cursor starts from the beginning.
+	After *Cursor
+
+	// Snapshot leaves out the records created after it was taken, when it
+	// is non-nil.
+	Snapshot *Snapshot
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is a position in a sorted listing: the sort key, and the sort
+// value and ID of the last record on the previous page. Clients only ever
+// see it encoded, and must treat it as opaque.
+type Cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+// Encode returns the cursor as a URL-safe string.
+func (c Cursor) Encode() string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+// DecodeCursor parses a string returned by Cursor.Encode. An empty string
+// is the zero Cursor.
+func DecodeCursor(s string) (Cursor, error) {
+	var c Cursor
+
+	if s == "" {
+		return c, nil
+	}
+
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	err = json.Unmarshal(js, &c)
+	if err != nil || c.ID <= 0 {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+var ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+// Snapshot pins a listing to the records which had been created when it was
+// taken, so that records inserted while a client pages through the listing
+// don't shift the later pages. Records deleted in the meantime still drop
+// out. Like a Cursor, clients only ever see it encoded.
+type Snapshot struct {
+	CreatedAt time.Time `json:"t"`
+}
+
+// NewSnapshot returns a snapshot taken at now. created_at is stored rounded
+// to the second, so the snapshot is of the second before now's: a record
+// inserted later can't round down to it.
+func NewSnapshot(now time.Time) Snapshot {
+	return Snapshot{CreatedAt: now.UTC().Truncate(time.Second).Add(-time.Second)}
+}
+
+// Encode returns the snapshot as a URL-safe string.
+func (s Snapshot) Encode() string {
+	js, _ := json.Marshal(s)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+// DecodeSnapshot parses a string returned by Snapshot.Encode.
+func DecodeSnapshot(str string) (Snapshot, error) {
+	var s Snapshot
+
+	js, err := base64.RawURLEncoding.DecodeString(str)
+	if err != nil {
+		return s, ErrInvalidSnapshot
+	}
+
+	err = json.Unmarshal(js, &s)
+	if err != nil || s.CreatedAt.IsZero() {
+		return s, ErrInvalidSnapshot
+	}
+
+	return s, nil
+}
+
+// sortExpression returns the SQL expression for the client-provided Sort
+// field, after stripping the leading hyphen character (if one exists). It
+// panics if the key isn't declared in SortKeys, as a backstop against SQL
+// injection should ValidateFilters not have been called.
+func (f Filters) sortExpression() string {
+	expression, ok := f.SortKeys[strings.TrimPrefix(f.Sort, "-")]
+	if !ok {
+		panic("unsafe sort parameter: " + f.Sort)
+	}
+
+	return expression
+}
+
+// sortDirection returns the sort direction ("ASC" or "DESC") depending on
+// the prefix character of the Sort field.
+func (f Filters) sortDirection() string {
+	if strings.HasPrefix(f.Sort, "-") {
+		return "DESC"
+	}
+
+	return "ASC"
+}
+
+// keysetCondition returns the WHERE condition which selects the records
+// after the cursor, using $n for the sort value and $n+1 for the ID, along
+// with those arguments. Records are always ordered by ID after the sort key,
+// so the ID breaks ties. The sort value is passed as text, and PostgreSQL
+// infers its type from the expression it is compared with.
+func (f Filters) keysetCondition(n int) (string, []any) {
+	if f.After == nil || f.After.ID == 0 {
+		return "TRUE", nil
+	}
+
+	op := ">"
+	if f.sortDirection() == "DESC" {
+		op = "<"
+	}
+
+	expression := f.sortExpression()
+
+	condition := fmt.Sprintf("((%s) %s $%d OR ((%s) = $%d AND id > $%d))", expression, op, n, expression, n, n+1)
+
+	return condition, []any{f.After.Value, f.After.ID}
+}
+
+// snapshotCondition returns the WHERE condition which leaves out the
+// records created after the snapshot, using $n for its time, along with
+// that argument.
+func (f Filters) snapshotCondition(n int) (string, []any) {
+	if f.Snapshot == nil {
+		return "TRUE", nil
+	}
+
+	return fmt.Sprintf("created_at <= $%d", n), []any{f.Snapshot.CreatedAt}
+}
+
+// snapshot returns the encoded snapshot to send back with a page, so that
+// the client can ask for the next one from the same snapshot.
+func (f Filters) snapshot() string {
+	if f.Snapshot == nil {
+		return ""
+	}
+
+	return f.Snapshot.Encode()
+}
+
+// nextCursor returns the cursor for the page after the one ending with the
+// given record.
+func (f Filters) nextCursor(sortValue string, id int64) string {
+	return Cursor{Sort: f.Sort, Value: sortValue, ID: id}.Encode()
+}
+
+func (f Filters) limit() int {
+	return f.PageSize
+}
+
+func (f Filters) offset() int {
+	return (f.Page - 1) * f.PageSize
+}
+
+func ValidateFilters(v *validator.Validator, f Filters) {
+	maxPageSize := f.MaxPageSize
+	if maxPageSize <= 0 {
+		maxPageSize = DefaultMaxPageSize
+	}
+
+	maxOffset := f.MaxOffset
+	if maxOffset <= 0 {
+		maxOffset = DefaultMaxOffset
+	}
+
+	v.Check(f.Page > 0, "page", "must be greater than zero")
+	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
+	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
+	v.Check(f.PageSize <= maxPageSize, "page_size", fmt.Sprintf("must be a maximum of %d", maxPageSize))
+
+	if f.After != nil {
+		v.Check(f.Page == 1, "page", "must not be used with after")
+		v.Check(f.After.ID == 0 || f.After.Sort == f.Sort, "after", "was issued for a different sort order")
+	} else if v.Valid() {
+		v.Check(f.offset() <= maxOffset, "page", fmt.Sprintf("must not start more than %d records into the results", maxOffset))
+	}
+
+	_, ok := f.SortKeys[strings.TrimPrefix(f.Sort, "-")]
+	v.Check(ok, "sort", "invalid sort value")
+}
+
+// Metadata holds the pagination metadata returned alongside list responses.
+// Keyset-paginated responses only have PageSize and, unless they are the
+// last page, NextCursor. Snapshot is only set for listings pinned to one.
+type Metadata struct {
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	Snapshot     string `json:"snapshot,omitempty"`
+}
+
+// calculateMetadata calculates the appropriate pagination metadata values
+// given the total number of records, current page, and page size values.
+func calculateMetadata(totalRecords, page, pageSize int) Metadata {
+	if totalRecords == 0 {
+		return Metadata{}
+	}
+
+	return Metadata{
+		CurrentPage:  page,
+		PageSize:     pageSize,
+		FirstPage:    1,
+		LastPage:     int(math.Ceil(float64(totalRecords) / float64(pageSize))),
+		TotalRecords: totalRecords,
+	}
+}
@@ -0,0 +1,59 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// Genre is a genre movies can be filed under, along with how many movies
+// are. The genres are also listed as the genres vocabulary, which is how
+// they are added, relabelled and deleted.
+type Genre struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	Label      string `json:"label,omitempty"`
+	MovieCount int64  `json:"movie_count"`
+}
+
+type GenreModel struct {
+	DB Querier
+}
+
+// GetAll returns every genre, sorted by name, including those which no
+// movie uses yet.
+func (m GenreModel) GetAll() ([]*Genre, error) {
+	query := `
+		SELECT genres.id, genres.name, genres.label, count(movies_genres.movie_id)
+		FROM genres
+		LEFT JOIN movies_genres ON movies_genres.genre_id = genres.id
+		GROUP BY genres.id
+		ORDER BY genres.name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := []*Genre{}
+
+	for rows.Next() {
+		var genre Genre
+
+		err := rows.Scan(&genre.ID, &genre.Name, &genre.Label, &genre.MovieCount)
+		if err != nil {
+			return nil, err
+		}
+
+		genres = append(genres, &genre)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return genres, nil
+}
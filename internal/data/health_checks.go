@@ -0,0 +1,174 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// The statuses a component can be in. Degraded components still count
+// towards uptime; only outages count against it.
+const (
+	StatusOperational = "operational"
+	StatusDegraded    = "degraded"
+	StatusOutage      = "outage"
+)
+
+// HealthCheck is the status of one component at one point in time.
+type HealthCheck struct {
+	Component string
+	Status    string
+	CheckedAt time.Time
+}
+
+// Uptime holds the percentage of health checks over the last day, week and
+// month in which a component wasn't in an outage. A window with no checks
+// is nil.
+type Uptime struct {
+	Day   *float64 `json:"24h"`
+	Week  *float64 `json:"7d"`
+	Month *float64 `json:"30d"`
+}
+
+// HealthPeriod is a run of consecutive health checks in which a component
+// had the same status.
+type HealthPeriod struct {
+	Status string    `json:"status"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Checks int       `json:"checks"`
+}
+
+type HealthCheckModel struct {
+	DB Querier
+}
+
+// InsertBatch stores the checks with a single statement.
+func (m HealthCheckModel) InsertBatch(checks []HealthCheck) error {
+	if len(checks) == 0 {
+		return nil
+	}
+
+	components := make([]string, len(checks))
+	statuses := make([]string, len(checks))
+	checkedAt := make([]string, len(checks))
+
+	for i, check := range checks {
+		components[i] = check.Component
+		statuses[i] = check.Status
+		checkedAt[i] = check.CheckedAt.Format(time.RFC3339)
+	}
+
+	query := `
+		INSERT INTO health_checks (component, status, checked_at)
+		SELECT * FROM unnest($1::text[], $2::text[], $3::timestamptz[])`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, pq.Array(components), pq.Array(statuses), pq.Array(checkedAt))
+	return err
+}
+
+// UptimeByComponent returns the uptime of every component which has been
+// checked in the last 30 days.
+func (m HealthCheckModel) UptimeByComponent() (map[string]Uptime, error) {
+	query := `
+		SELECT component,
+			100 * avg(CASE WHEN status <> 'outage' THEN 1 ELSE 0 END) FILTER (WHERE checked_at > NOW() - INTERVAL '1 day'),
+			100 * avg(CASE WHEN status <> 'outage' THEN 1 ELSE 0 END) FILTER (WHERE checked_at > NOW() - INTERVAL '7 days'),
+			100 * avg(CASE WHEN status <> 'outage' THEN 1 ELSE 0 END)
+		FROM health_checks
+		WHERE checked_at > NOW() - INTERVAL '30 days'
+		GROUP BY component`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uptimes := make(map[string]Uptime)
+
+	for rows.Next() {
+		var (
+			component        string
+			day, week, month sql.NullFloat64
+		)
+
+		err := rows.Scan(&component, &day, &week, &month)
+		if err != nil {
+			return nil, err
+		}
+
+		uptimes[component] = Uptime{
+			Day:   nullFloatPointer(day),
+			Week:  nullFloatPointer(week),
+			Month: nullFloatPointer(month),
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return uptimes, nil
+}
+
+// GetHistory returns the component's checks since the given time, with runs
+// of the same status collapsed into periods, oldest first.
+func (m HealthCheckModel) GetHistory(component string, since time.Time) ([]HealthPeriod, error) {
+	query := `
+		WITH checks AS (
+			SELECT status, checked_at,
+				row_number() OVER (ORDER BY checked_at) -
+				row_number() OVER (PARTITION BY status ORDER BY checked_at) AS run
+			FROM health_checks
+			WHERE component = $1 AND checked_at >= $2
+		)
+		SELECT status, min(checked_at), max(checked_at), count(*)
+		FROM checks
+		GROUP BY status, run
+		ORDER BY min(checked_at)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, component, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	periods := []HealthPeriod{}
+
+	for rows.Next() {
+		var period HealthPeriod
+
+		err := rows.Scan(&period.Status, &period.From, &period.To, &period.Checks)
+		if err != nil {
+			return nil, err
+		}
+
+		periods = append(periods, period)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return periods, nil
+}
+
+func nullFloatPointer(f sql.NullFloat64) *float64 {
+	if !f.Valid {
+		return nil
+	}
+
+	return &f.Float64
+}
@@ -0,0 +1,74 @@
+package data
+
+import (
+	"sync"
+
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+)
+
+// MovieValidationHook is an additional, deployment-specific validation rule
+// for movies, such as "year must be within the licensing window". Hooks
+// report failures through the validator in the same way as ValidateMovie.
+type MovieValidationHook func(v *validator.Validator, movie *Movie)
+
+var movieValidationHooks struct {
+	mu    sync.RWMutex
+	names []string
+	hooks map[string]MovieValidationHook
+}
+
+// RegisterMovieValidationHook adds a named hook which is executed after the
+// built-in checks in ValidateMovie. Hooks run in registration order, and
+// registering a hook under an existing name replaces the previous one. It is
+// intended to be called during program initialization.
+func RegisterMovieValidationHook(name string, hook MovieValidationHook) {
+	if hook == nil {
+		panic("data: RegisterMovieValidationHook hook is nil")
+	}
+
+	movieValidationHooks.mu.Lock()
+	defer movieValidationHooks.mu.Unlock()
+
+	if movieValidationHooks.hooks == nil {
+		movieValidationHooks.hooks = make(map[string]MovieValidationHook)
+	}
+
+	if _, exists := movieValidationHooks.hooks[name]; !exists {
+		movieValidationHooks.names = append(movieValidationHooks.names, name)
+	}
+
+	movieValidationHooks.hooks[name] = hook
+}
+
+// UnregisterMovieValidationHook removes the hook registered under the given
+// name, if any.
+func UnregisterMovieValidationHook(name string) {
+	movieValidationHooks.mu.Lock()
+	defer movieValidationHooks.mu.Unlock()
+
+	if _, exists := movieValidationHooks.hooks[name]; !exists {
+		return
+	}
+
+	delete(movieValidationHooks.hooks, name)
+
+	for i, n := range movieValidationHooks.names {
+		if n == name {
+			movieValidationHooks.names = append(movieValidationHooks.names[:i], movieValidationHooks.names[i+1:]...)
+			break
+		}
+	}
+}
+
+func runMovieValidationHooks(v *validator.Validator, movie *Movie) {
+	movieValidationHooks.mu.RLock()
+	hooks := make([]MovieValidationHook, 0, len(movieValidationHooks.names))
+	for _, name := range movieValidationHooks.names {
+		hooks = append(hooks, movieValidationHooks.hooks[name])
+	}
+	movieValidationHooks.mu.RUnlock()
+
+	for _, hook := range hooks {
+		hook(v, movie)
+	}
+}
@@ -0,0 +1,106 @@
+package data
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The ID generation strategies. Serial leaves IDs to the table's PostgreSQL
+// sequence, which is the default.
+const (
+	IDStrategySerial    = "serial"
+	IDStrategySnowflake = "snowflake"
+)
+
+// IDGenerator generates record IDs in the application, instead of the
+// database, so that several databases can share an ID space. Models which
+// support it use their sequence when they have no generator.
+type IDGenerator interface {
+	NextID() (int64, error)
+}
+
+// NewIDGenerator returns the generator for a strategy, or nil for serial.
+// The node identifies this instance, and must be unique among the instances
+// writing to the same resource.
+func NewIDGenerator(strategy string, node int64) (IDGenerator, error) {
+	switch strategy {
+	case IDStrategySerial:
+		return nil, nil
+	case IDStrategySnowflake:
+		return NewSnowflakeGenerator(node)
+	default:
+		return nil, fmt.Errorf("unknown ID strategy %q", strategy)
+	}
+}
+
+const (
+	snowflakeNodeBits     = 10
+	snowflakeSequenceBits = 12
+	MaxSnowflakeNode      = 1<<snowflakeNodeBits - 1
+	maxSnowflakeSequence  = 1<<snowflakeSequenceBits - 1
+)
+
+// snowflakeEpoch is the zero time of snowflake timestamps, which leaves 41
+// bits of milliseconds enough room until 2093.
+var snowflakeEpoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// SnowflakeGenerator generates Twitter Snowflake-style IDs: 41 bits of
+// milliseconds since snowflakeEpoch, then 10 bits of node and 12 bits of
+// sequence within the millisecond. IDs from one generator always increase,
+// and are unique across nodes. They are far above anything a sequence will
+// reach, so they can be used on tables which already hold serial IDs, but
+// they exceed the 2^53 integers JavaScript numbers hold exactly.
+type SnowflakeGenerator struct {
+	mu       sync.Mutex
+	node     int64
+	last     int64
+	sequence int64
+}
+
+func NewSnowflakeGenerator(node int64) (*SnowflakeGenerator, error) {
+	if node < 0 || node > MaxSnowflakeNode {
+		return nil, fmt.Errorf("snowflake node must be between 0 and %d", MaxSnowflakeNode)
+	}
+
+	return &SnowflakeGenerator{node: node}, nil
+}
+
+// NextID returns a new ID. When the sequence for the current millisecond
+// runs out, or the clock has gone backwards, it borrows from the following
+// milliseconds rather than waiting or repeating an ID.
+func (g *SnowflakeGenerator) NextID() (int64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Since(snowflakeEpoch).Milliseconds()
+
+	if now > g.last {
+		g.last = now
+		g.sequence = 0
+	} else {
+		g.sequence++
+		if g.sequence > maxSnowflakeSequence {
+			g.last++
+			g.sequence = 0
+		}
+	}
+
+	return g.last<<(snowflakeNodeBits+snowflakeSequenceBits) | g.node<<snowflakeSequenceBits | g.sequence, nil
+}
+
+// nextID returns an ID from the generator, or NULL so that the INSERT falls
+// back to the table's sequence when there is no generator.
+func nextID(g IDGenerator) (sql.NullInt64, error) {
+	if g == nil {
+		return sql.NullInt64{}, nil
+	}
+
+	id, err := g.NextID()
+	if err != nil {
+		return sql.NullInt64{}, err
+	}
+
+	return sql.NullInt64{Int64: id, Valid: true}, nil
+}
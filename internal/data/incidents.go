@@ -0,0 +1,230 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+
+	"github.com/lib/pq"
+)
+
+// The stages of an incident, in the order they usually happen.
+const (
+	IncidentInvestigating = "investigating"
+	IncidentIdentified    = "identified"
+	IncidentMonitoring    = "monitoring"
+	IncidentResolved      = "resolved"
+)
+
+var IncidentStatuses = []string{IncidentInvestigating, IncidentIdentified, IncidentMonitoring, IncidentResolved}
+
+// Incident is an annotation on the status page, written by an admin to
+// explain a problem with one or more components.
+type Incident struct {
+	ID         int64      `json:"id"`
+	Title      string     `json:"title"`
+	Body       string     `json:"body"`
+	Status     string     `json:"status"`
+	Components []string   `json:"components"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+	Version    int32      `json:"version"`
+}
+
+// ValidateIncident checks the incident, whose components must be among
+// the given ones.
+func ValidateIncident(v *validator.Validator, incident *Incident, components []string) {
+	v.Check(incident.Title != "", "title", "must be provided")
+	v.Check(len(incident.Title) <= 200, "title", "must not be more than 200 bytes long")
+
+	v.Check(len(incident.Body) <= 10000, "body", "must not be more than 10000 bytes long")
+
+	v.Check(validator.PermittedValue(incident.Status, IncidentStatuses...), "status", "must be a known incident status")
+
+	v.Check(len(incident.Components) >= 1, "components", "must contain at least 1 component")
+	v.Check(validator.Unique(incident.Components), "components", "must not contain duplicate values")
+	for _, component := range incident.Components {
+		v.Check(validator.PermittedValue(component, components...), "components", "contains an unknown component")
+	}
+}
+
+type IncidentModel struct {
+	DB Querier
+}
+
+func (m IncidentModel) Insert(incident *Incident) error {
+	query := `
+		INSERT INTO incidents (title, body, status, components, resolved_at)
+		VALUES ($1, $2, $3, $4, CASE WHEN $3 = 'resolved' THEN NOW() END)
+		RETURNING id, created_at, updated_at, resolved_at, version`
+
+	args := []any{incident.Title, incident.Body, incident.Status, pq.Array(incident.Components)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&incident.ID,
+		&incident.CreatedAt,
+		&incident.UpdatedAt,
+		&incident.ResolvedAt,
+		&incident.Version,
+	)
+}
+
+func (m IncidentModel) Get(id int64) (*Incident, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, title, body, status, components, created_at, updated_at, resolved_at, version
+		FROM incidents
+		WHERE id = $1`
+
+	var incident Incident
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&incident.ID,
+		&incident.Title,
+		&incident.Body,
+		&incident.Status,
+		pq.Array(&incident.Components),
+		&incident.CreatedAt,
+		&incident.UpdatedAt,
+		&incident.ResolvedAt,
+		&incident.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &incident, nil
+}
+
+// GetRecent returns the unresolved incidents and those resolved within the
+// given duration, newest first.
+func (m IncidentModel) GetRecent(resolvedWithin time.Duration) ([]*Incident, error) {
+	query := `
+		SELECT id, title, body, status, components, created_at, updated_at, resolved_at, version
+		FROM incidents
+		WHERE resolved_at IS NULL OR resolved_at > $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT 20`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, time.Now().Add(-resolvedWithin))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	incidents := []*Incident{}
+
+	for rows.Next() {
+		var incident Incident
+
+		err := rows.Scan(
+			&incident.ID,
+			&incident.Title,
+			&incident.Body,
+			&incident.Status,
+			pq.Array(&incident.Components),
+			&incident.CreatedAt,
+			&incident.UpdatedAt,
+			&incident.ResolvedAt,
+			&incident.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		incidents = append(incidents, &incident)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return incidents, nil
+}
+
+// Update saves the incident, using its version for optimistic locking. The
+// resolved_at time is set when the status first becomes resolved, and
+// cleared if the incident is reopened.
+func (m IncidentModel) Update(incident *Incident) error {
+	query := `
+		UPDATE incidents
+		SET title = $1, body = $2, status = $3, components = $4, updated_at = NOW(),
+			resolved_at = CASE WHEN $3 = 'resolved' THEN COALESCE(resolved_at, NOW()) END,
+			version = version + 1
+		WHERE id = $5 AND version = $6
+		RETURNING updated_at, resolved_at, version`
+
+	args := []any{
+		incident.Title,
+		incident.Body,
+		incident.Status,
+		pq.Array(incident.Components),
+		incident.ID,
+		incident.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&incident.UpdatedAt, &incident.ResolvedAt, &incident.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m IncidentModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM incidents
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
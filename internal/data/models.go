@@ -0,0 +1,218 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrRecordNotFound = errors.New("record not found")
+	ErrEditConflict   = errors.New("edit conflict")
+)
+
+// Querier is the subset of methods shared by *sql.DB and *sql.Tx which the
+// models use, so that the same model can run against either.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type Models struct {
+	AnalyticsEvents      AnalyticsEventModel
+	APIKeys              APIKeyModel
+	EmailChecks          EmailCheckModel
+	Genres               GenreModel
+	HealthChecks         HealthCheckModel
+	Incidents            IncidentModel
+	Movies               MovieModel
+	Permissions          PermissionModel
+	PersonalAccessTokens PersonalAccessTokenModel
+	Retention            RetentionModel
+	Reviews              ReviewModel
+	Roles                RoleModel
+	Tokens               TokenModel
+	TOTP                 TOTPModel
+	Users                UserModel
+	Vocabularies         VocabularyModel
+	Watchlist            WatchlistModel
+	WatchProgress        WatchProgressModel
+
+	db   *sql.DB
+	wrap func(Querier) Querier
+}
+
+func NewModels(db *sql.DB) Models {
+	return newModels(db, db, nil)
+}
+
+// NewModelsWithReplica returns models which send writes to db, and send
+// reads which can tolerate replication lag to the replica.
+func NewModelsWithReplica(db, replica *sql.DB) Models {
+	return newModels(db, db, replica)
+}
+
+func newModels(db *sql.DB, q Querier, replica Querier) Models {
+	return Models{
+		AnalyticsEvents:      AnalyticsEventModel{DB: q},
+		APIKeys:              APIKeyModel{DB: q},
+		EmailChecks:          EmailCheckModel{DB: q},
+		Genres:               GenreModel{DB: q},
+		HealthChecks:         HealthCheckModel{DB: q},
+		Incidents:            IncidentModel{DB: q},
+		Movies:               MovieModel{DB: q, ReadDB: replica},
+		Permissions:          PermissionModel{DB: q},
+		PersonalAccessTokens: PersonalAccessTokenModel{DB: q},
+		Retention:            RetentionModel{DB: q},
+		Reviews:              ReviewModel{DB: q},
+		Roles:                RoleModel{DB: q},
+		Tokens:               TokenModel{DB: q},
+		TOTP:                 TOTPModel{DB: q},
+		Users:                UserModel{DB: q},
+		Vocabularies:         VocabularyModel{DB: q},
+		Watchlist:            WatchlistModel{DB: q},
+		WatchProgress:        WatchProgressModel{DB: q},
+		db:                   db,
+	}
+}
+
+// withQuerier returns a copy of the models bound to q, keeping their
+// settings.
+func (m Models) withQuerier(q Querier) Models {
+	if m.wrap != nil {
+		q = m.wrap(q)
+	}
+
+	models := newModels(m.db, q, nil)
+	models.Movies.ListTimeout = m.Movies.ListTimeout
+	models.Movies.IDs = m.Movies.IDs
+	models.Movies.wrap = m.wrap
+	models.Users.IDs = m.Users.IDs
+	models.wrap = m.wrap
+
+	return models
+}
+
+// WrapQueriers returns a copy of the models whose queries go through the
+// Querier returned by wrap, including those made in transactions. It can be
+// called more than once, and the last wrap is outermost.
+func (m Models) WrapQueriers(wrap func(Querier) Querier) Models {
+	var replica Querier
+	if m.Movies.ReadDB != nil {
+		replica = wrap(m.Movies.ReadDB)
+	}
+
+	models := newModels(m.db, wrap(m.Movies.DB), replica)
+	models.Movies.ListTimeout = m.Movies.ListTimeout
+	models.Movies.IDs = m.Movies.IDs
+	models.Users.IDs = m.Users.IDs
+
+	models.wrap = wrap
+	if inner := m.wrap; inner != nil {
+		models.wrap = func(q Querier) Querier { return wrap(inner(q)) }
+	}
+	models.Movies.wrap = models.wrap
+
+	return models
+}
+
+// DB returns the primary database connection pool.
+func (m Models) DB() *sql.DB {
+	return m.db
+}
+
+// Ping checks that the primary database can be reached.
+func (m Models) Ping(ctx context.Context) error {
+	return m.db.PingContext(ctx)
+}
+
+// Transaction calls fn with a set of models bound to a new transaction,
+// which is committed if fn returns nil and rolled back otherwise.
+func (m Models) Transaction(fn func(Models) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	txModels := m.withQuerier(tx)
+
+	err = fn(txModels)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DryRun calls fn with a set of models bound to a new transaction, and then
+// always rolls that transaction back. This means that fn gets the full
+// database-level validation, constraint and conflict checks of a real write,
+// without any of its changes being persisted. The error returned by fn is
+// passed through unchanged.
+func (m Models) DryRun(fn func(Models) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	txModels := m.withQuerier(tx)
+
+	return fn(txModels)
+}
+
+// txBeginner is implemented by connection pools, and by wrapped queriers
+// which pass BeginTx through to one.
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// queryWithStatementTimeout calls fn with a Querier on which PostgreSQL
+// aborts any statement that runs for longer than timeout. When q can begin
+// transactions this is done with SET LOCAL inside a read-only transaction,
+// so the setting doesn't leak onto the pooled connection, and the
+// transaction is passed through wrap if it isn't nil. If q is already a
+// transaction, or timeout is zero, fn is called with q unchanged. Timeouts
+// are rounded up to whole milliseconds, since a statement_timeout of 0
+// would disable the timeout altogether.
+func queryWithStatementTimeout(ctx context.Context, q Querier, wrap func(Querier) Querier, timeout time.Duration, fn func(Querier) error) error {
+	db, ok := q.(txBeginner)
+	if !ok || timeout <= 0 {
+		return fn(q)
+	}
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ms := (timeout + time.Millisecond - 1) / time.Millisecond
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", ms))
+	if err != nil {
+		return err
+	}
+
+	var txq Querier = tx
+	if wrap != nil {
+		txq = wrap(tx)
+	}
+
+	err = fn(txq)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,747 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+
+	"github.com/lib/pq"
+)
+
+// ErrUnknownGenre is returned when a movie is saved with a genre which isn't
+// in the genres table.
+var ErrUnknownGenre = errors.New("unknown genre")
+
+type Movie struct {
+	ID            int64     `json:"id"`
+	CreatedAt     time.Time `json:"-"`
+	Title         string    `json:"title"`
+	Year          int32     `json:"year,omitempty"`
+	Runtime       Runtime   `json:"runtime,omitempty"`
+	Genres        []string  `json:"genres,omitempty"`
+	Certification string    `json:"certification,omitempty"`
+	Language      string    `json:"language,omitempty"`
+	Version       int32     `json:"version"`
+
+	// PosterKey is where the poster image is kept in storage, and PosterURL
+	// is where clients download it from. Both are empty if the movie has no
+	// poster.
+	PosterKey string `json:"-"`
+	PosterURL string `json:"poster_url,omitempty"`
+
+	// AverageRating is the mean rating of the movie's reviews, to one
+	// decimal place, or nil if it has none, and RatingCount is the number
+	// of reviews. Both come from counters which ReviewModel.Insert keeps up
+	// to date, rather than from the reviews themselves. They aren't loaded
+	// by GetAsOf.
+	AverageRating *float64 `json:"average_rating,omitempty"`
+	RatingCount   int32    `json:"rating_count,omitempty"`
+}
+
+func ValidateMovie(v *validator.Validator, movie *Movie) {
+	v.Check(movie.Title != "", "title", "must be provided")
+	v.Check(len(movie.Title) <= 500, "title", "must not be more than 500 bytes long")
+
+	v.Check(movie.Year != 0, "year", "must be provided")
+	v.Check(movie.Year >= 1888, "year", "must be greater than 1888")
+	v.Check(movie.Year <= int32(time.Now().Year()), "year", "must not be in the future")
+
+	v.Check(movie.Runtime != 0, "runtime", "must be provided")
+	v.Check(movie.Runtime > 0, "runtime", "must be a positive integer")
+
+	v.Check(movie.Genres != nil, "genres", "must be provided")
+	v.Check(len(movie.Genres) >= 1, "genres", "must contain at least 1 genre")
+	v.Check(len(movie.Genres) <= 5, "genres", "must not contain more than 5 genres")
+	v.Check(validator.Unique(movie.Genres), "genres", "must not contain duplicate values")
+
+	runMovieValidationHooks(v, movie)
+}
+
+type MovieModel struct {
+	DB Querier
+
+	// IDs generates the IDs of new movies. When it is nil, the movies
+	// table's sequence does.
+	IDs IDGenerator
+
+	// ListTimeout is the statement timeout applied to GetAll queries,
+	// rounded up to whole milliseconds. Zero means no timeout beyond the
+	// usual context deadline.
+	ListTimeout time.Duration
+
+	// ReadDB is an optional read replica used for listing movies. Lookups of
+	// single movies always use DB, because they usually precede an update
+	// and a lagging replica would cause spurious edit conflicts.
+	ReadDB Querier
+
+	// wrap is applied to the transactions which GetAll begins to set the
+	// statement timeout, like WrapQueriers applies it to DB.
+	wrap func(Querier) Querier
+}
+
+func (m MovieModel) reader() Querier {
+	if m.ReadDB != nil {
+		return m.ReadDB
+	}
+
+	return m.DB
+}
+
+func (m MovieModel) Insert(movie *Movie) error {
+	id, err := nextID(m.IDs)
+	if err != nil {
+		return err
+	}
+
+	// The genres are linked in the same statement, so that the revision
+	// recorded by the trigger at the end of it includes them. The movie
+	// isn't inserted if any of the genres is missing from the genres table,
+	// since the join would drop it from the movie without an error.
+	query := `
+		WITH missing AS (
+			SELECT count(*) AS n
+			FROM unnest($5::text[]) AS g(name)
+			WHERE g.name NOT IN (SELECT name FROM genres)
+		), movie AS (
+			INSERT INTO movies (id, title, year, runtime, certification, language)
+			SELECT COALESCE($1::bigint, nextval('movies_id_seq')), $2::text, $3::integer, $4::integer, $6::text, $7::text
+			WHERE (SELECT n FROM missing) = 0
+			RETURNING id, created_at, version
+		), linked AS (
+			INSERT INTO movies_genres (movie_id, genre_id, position)
+			SELECT movie.id, genres.id, g.position
+			FROM movie
+			CROSS JOIN unnest($5::text[]) WITH ORDINALITY AS g(name, position)
+			INNER JOIN genres ON genres.name = g.name
+		)
+		SELECT id, created_at, version FROM movie`
+
+	args := []any{id, movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.Certification, movie.Language}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrUnknownGenre
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m MovieModel) Get(id int64) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, title, year, runtime, movie_genres(id), certification, language, version, poster_key, poster_url,
+			round(rating_sum::numeric / NULLIF(rating_count, 0), 1), rating_count
+		FROM movies
+		WHERE id = $1`
+
+	var movie Movie
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Certification,
+		&movie.Language,
+		&movie.Version,
+		&movie.PosterKey,
+		&movie.PosterURL,
+		&movie.AverageRating,
+		&movie.RatingCount,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &movie, nil
+}
+
+// GetAsOf returns the movie as it was at the given time, reconstructed from
+// its revisions. It returns ErrRecordNotFound if the movie didn't exist then,
+// had been deleted, or changed only before its history was first recorded.
+func (m MovieModel) GetAsOf(id int64, asOf time.Time) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT movie_id, title, year, runtime, genres, certification, language, version, deleted
+		FROM movie_revisions
+		WHERE movie_id = $1 AND valid_from <= $2
+		ORDER BY valid_from DESC, id DESC
+		LIMIT 1`
+
+	var (
+		movie   Movie
+		deleted bool
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, asOf).Scan(
+		&movie.ID,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Certification,
+		&movie.Language,
+		&movie.Version,
+		&deleted,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if deleted {
+		return nil, ErrRecordNotFound
+	}
+
+	return &movie, nil
+}
+
+// MovieSortKeys are the keys movie listings can be sorted by. The relevance
+// key ranks movies by how well their title matches the title search, which
+// is always the first query argument of GetAll.
+var MovieSortKeys = SortKeys{
+	"id":        "id",
+	"title":     "title",
+	"year":      "year",
+	"runtime":   "runtime",
+	"relevance": "ts_rank(to_tsvector('simple', title), to_tsquery('simple', $1))",
+}
+
+// GetAll returns a page of movies matching the title search and genres. It
+// uses keyset pagination when filters.After is set, and offset pagination
+// otherwise.
+func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+	if filters.After != nil {
+		return m.getAllAfter(title, genres, filters)
+	}
+
+	snapshotCondition, snapshotArgs := filters.snapshotCondition(5)
+
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, title, year, runtime, movie_genres(id), certification, language, version, poster_key, poster_url,
+			round(rating_sum::numeric / NULLIF(rating_count, 0), 1), rating_count
+		FROM movies
+		WHERE (to_tsvector('simple', title) @@ to_tsquery('simple', $1) OR $1 = '')
+		AND ($2 = '{}' OR id IN (SELECT movie_id FROM movies_with_genres($2)))
+		AND %s
+		ORDER BY %s %s, id ASC
+		LIMIT $3 OFFSET $4`, snapshotCondition, filters.sortExpression(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{prefixSearchQuery(title), pq.Array(genres), filters.limit(), filters.offset()}
+	args = append(args, snapshotArgs...)
+
+	totalRecords := 0
+	movies := []*Movie{}
+
+	err := queryWithStatementTimeout(ctx, m.reader(), m.wrap, m.ListTimeout, func(q Querier) error {
+		rows, err := q.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var movie Movie
+
+			err := rows.Scan(
+				&totalRecords,
+				&movie.ID,
+				&movie.CreatedAt,
+				&movie.Title,
+				&movie.Year,
+				&movie.Runtime,
+				pq.Array(&movie.Genres),
+				&movie.Certification,
+				&movie.Language,
+				&movie.Version,
+				&movie.PosterKey,
+				&movie.PosterURL,
+				&movie.AverageRating,
+				&movie.RatingCount,
+			)
+			if err != nil {
+				return err
+			}
+
+			movies = append(movies, &movie)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	metadata.Snapshot = filters.snapshot()
+
+	return movies, metadata, nil
+}
+
+// getAllAfter is the keyset-paginated version of GetAll. It skips the total
+// count, which needs the whole result set, and fetches one extra row to find
+// out whether there is a next page.
+func (m MovieModel) getAllAfter(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+	condition, keysetArgs := filters.keysetCondition(4)
+	snapshotCondition, snapshotArgs := filters.snapshotCondition(4 + len(keysetArgs))
+
+	query := fmt.Sprintf(`
+		SELECT id, created_at, title, year, runtime, movie_genres(id), certification, language, version, poster_key, poster_url,
+			round(rating_sum::numeric / NULLIF(rating_count, 0), 1), rating_count, (%s)::text
+		FROM movies
+		WHERE (to_tsvector('simple', title) @@ to_tsquery('simple', $1) OR $1 = '')
+		AND ($2 = '{}' OR id IN (SELECT movie_id FROM movies_with_genres($2)))
+		AND %s
+		AND %s
+		ORDER BY %s %s, id ASC
+		LIMIT $3`, filters.sortExpression(), condition, snapshotCondition, filters.sortExpression(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{prefixSearchQuery(title), pq.Array(genres), filters.limit() + 1}
+	args = append(args, keysetArgs...)
+	args = append(args, snapshotArgs...)
+
+	movies := []*Movie{}
+	sortValues := []string{}
+
+	err := queryWithStatementTimeout(ctx, m.reader(), m.wrap, m.ListTimeout, func(q Querier) error {
+		rows, err := q.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var (
+				movie     Movie
+				sortValue string
+			)
+
+			err := rows.Scan(
+				&movie.ID,
+				&movie.CreatedAt,
+				&movie.Title,
+				&movie.Year,
+				&movie.Runtime,
+				pq.Array(&movie.Genres),
+				&movie.Certification,
+				&movie.Language,
+				&movie.Version,
+				&movie.PosterKey,
+				&movie.PosterURL,
+				&movie.AverageRating,
+				&movie.RatingCount,
+				&sortValue,
+			)
+			if err != nil {
+				return err
+			}
+
+			movies = append(movies, &movie)
+			sortValues = append(sortValues, sortValue)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := Metadata{PageSize: filters.PageSize, Snapshot: filters.snapshot()}
+
+	if len(movies) > filters.limit() {
+		movies = movies[:filters.limit()]
+		last := len(movies) - 1
+		metadata.NextCursor = filters.nextCursor(sortValues[last], movies[last].ID)
+	}
+
+	return movies, metadata, nil
+}
+
+// prefixSearchQuery converts free-form search text into a tsquery string in
+// which every word must match as a prefix, so that "star wa" becomes
+// "star:* & wa:*". Anything other than letters and digits is treated as a
+// word separator, which keeps tsquery operators in the input from being
+// interpreted.
+func prefixSearchQuery(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i, word := range words {
+		words[i] = strings.ToLower(word) + ":*"
+	}
+
+	return strings.Join(words, " & ")
+}
+
+// Update saves the movie, but only if its version number hasn't changed
+// since it was read. This optimistic lock prevents concurrent requests from
+// silently overwriting each other's changes. The movie's genres are
+// replaced in the same statement, and only if the update went through.
+// Like Insert, it changes nothing if any of the genres is missing from the
+// genres table.
+func (m MovieModel) Update(movie *Movie) error {
+	query := `
+		WITH missing AS (
+			SELECT count(*) AS n
+			FROM unnest($4::text[]) AS g(name)
+			WHERE g.name NOT IN (SELECT name FROM genres)
+		), movie AS (
+			UPDATE movies
+			SET title = $1, year = $2, runtime = $3, certification = $5, language = $6, version = version + 1
+			WHERE id = $7 AND version = $8
+			AND (SELECT n FROM missing) = 0
+			RETURNING id, version
+		), wanted AS (
+			SELECT genres.id AS genre_id, g.position
+			FROM unnest($4::text[]) WITH ORDINALITY AS g(name, position)
+			INNER JOIN genres ON genres.name = g.name
+		), unlinked AS (
+			DELETE FROM movies_genres
+			WHERE movie_id IN (SELECT id FROM movie)
+			AND genre_id NOT IN (SELECT genre_id FROM wanted)
+		), linked AS (
+			INSERT INTO movies_genres (movie_id, genre_id, position)
+			SELECT movie.id, wanted.genre_id, wanted.position
+			FROM movie
+			CROSS JOIN wanted
+			ON CONFLICT (movie_id, genre_id) DO UPDATE SET position = EXCLUDED.position
+		)
+		SELECT (SELECT version FROM movie), (SELECT n FROM missing)`
+
+	args := []any{
+		movie.Title,
+		movie.Year,
+		movie.Runtime,
+		pq.Array(movie.Genres),
+		movie.Certification,
+		movie.Language,
+		movie.ID,
+		movie.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var (
+		version sql.NullInt32
+		missing int
+	)
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&version, &missing)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case missing > 0:
+		return ErrUnknownGenre
+	case !version.Valid:
+		return ErrEditConflict
+	}
+
+	movie.Version = version.Int32
+
+	return nil
+}
+
+// UpdatePoster saves the movie's poster key and URL, with the same
+// optimistic lock as Update.
+func (m MovieModel) UpdatePoster(movie *Movie) error {
+	query := `
+		UPDATE movies
+		SET poster_key = $1, poster_url = $2, version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING version`
+
+	args := []any{movie.PosterKey, movie.PosterURL, movie.ID, movie.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete deletes the movie and returns the storage key of its poster, which
+// is empty if it had none, so that the caller can remove the file.
+func (m MovieModel) Delete(id int64) (string, error) {
+	if id < 1 {
+		return "", ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM movies
+		WHERE id = $1
+		RETURNING poster_key`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var posterKey string
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&posterKey)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+
+	return posterKey, nil
+}
+
+// RatingDrift is a movie whose rating counters disagree with its reviews.
+type RatingDrift struct {
+	MovieID     int64 `json:"movie_id"`
+	StoredCount int64 `json:"stored_count"`
+	StoredSum   int64 `json:"stored_sum"`
+	ReviewCount int64 `json:"review_count"`
+	ReviewSum   int64 `json:"review_sum"`
+}
+
+// ReconcileRatings finds the movies whose rating counters disagree with
+// their reviews, which happens when reviews are removed other than through
+// the API, such as by the cascade when a user is deleted, and corrects the
+// counters. The counters are corrected by the difference found, rather than
+// set, so that a review added concurrently isn't lost. Run it in a rolled
+// back transaction to only check the counters.
+func (m MovieModel) ReconcileRatings() ([]RatingDrift, error) {
+	query := `
+		WITH drift AS (
+			SELECT movies.id, movies.rating_count, movies.rating_sum,
+				count(reviews.id) AS review_count, COALESCE(sum(reviews.rating), 0) AS review_sum
+			FROM movies
+			LEFT JOIN reviews ON reviews.movie_id = movies.id
+			GROUP BY movies.id
+			HAVING movies.rating_count <> count(reviews.id) OR movies.rating_sum <> COALESCE(sum(reviews.rating), 0)
+		), corrected AS (
+			UPDATE movies
+			SET rating_count = movies.rating_count + drift.review_count - drift.rating_count,
+				rating_sum = movies.rating_sum + drift.review_sum - drift.rating_sum
+			FROM drift
+			WHERE movies.id = drift.id
+		)
+		SELECT id, rating_count, rating_sum, review_count, review_sum
+		FROM drift
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	drifts := []RatingDrift{}
+
+	for rows.Next() {
+		var drift RatingDrift
+
+		err := rows.Scan(&drift.MovieID, &drift.StoredCount, &drift.StoredSum, &drift.ReviewCount, &drift.ReviewSum)
+		if err != nil {
+			return nil, err
+		}
+
+		drifts = append(drifts, drift)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return drifts, nil
+}
+
+// GetRandom returns a random movie which has all of the genres, and was
+// released in the decade starting at the given year. An empty genres slice
+// or a zero decade don't filter.
+func (m MovieModel) GetRandom(genres []string, decade int) (*Movie, error) {
+	query := `
+		SELECT id, created_at, title, year, runtime, movie_genres(id), certification, language, version, poster_key, poster_url,
+			round(rating_sum::numeric / NULLIF(rating_count, 0), 1), rating_count
+		FROM movies
+		WHERE ($1 = '{}' OR id IN (SELECT movie_id FROM movies_with_genres($1)))
+		AND ($2 = 0 OR year BETWEEN $2 AND $2 + 9)
+		ORDER BY random()
+		LIMIT 1`
+
+	return m.getOne(query, pq.Array(genres), decade)
+}
+
+// GetFeatured returns the featured movie for a day. The movie is picked
+// deterministically from the seed, so every instance features the same movie
+// on the same day for as long as the catalog doesn't change.
+func (m MovieModel) GetFeatured(seed uint32) (*Movie, error) {
+	query := `
+		SELECT id, created_at, title, year, runtime, movie_genres(id), certification, language, version, poster_key, poster_url,
+			round(rating_sum::numeric / NULLIF(rating_count, 0), 1), rating_count
+		FROM movies
+		ORDER BY id
+		OFFSET $1 % GREATEST((SELECT count(*) FROM movies), 1)
+		LIMIT 1`
+
+	return m.getOne(query, int64(seed))
+}
+
+// MovieChange is a movie along with when it was last added or updated.
+type MovieChange struct {
+	Movie     *Movie
+	UpdatedAt time.Time
+}
+
+// GetRecentlyChanged returns the most recently added or updated movies which
+// have all of the genres and are in the language, newest first. An empty
+// genres slice or language don't filter. Movies which haven't changed since
+// their history was first recorded are dated by when they were created.
+func (m MovieModel) GetRecentlyChanged(genres []string, language string, limit int) ([]*MovieChange, error) {
+	query := `
+		SELECT m.id, m.created_at, m.title, m.year, m.runtime, movie_genres(m.id), m.certification, m.language, m.version, m.poster_key, m.poster_url,
+			round(m.rating_sum::numeric / NULLIF(m.rating_count, 0), 1), m.rating_count,
+			GREATEST(m.created_at, COALESCE(r.updated_at, m.created_at)) AS updated_at
+		FROM movies m
+		LEFT JOIN (
+			SELECT movie_id, max(valid_from) AS updated_at
+			FROM movie_revisions
+			GROUP BY movie_id
+		) r ON r.movie_id = m.id
+		WHERE ($1 = '{}' OR m.id IN (SELECT movie_id FROM movies_with_genres($1)))
+		AND ($2 = '' OR m.language = $2)
+		ORDER BY updated_at DESC, m.id DESC
+		LIMIT $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.reader().QueryContext(ctx, query, pq.Array(genres), language, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []*MovieChange{}
+
+	for rows.Next() {
+		var change MovieChange
+		change.Movie = &Movie{}
+
+		err := rows.Scan(
+			&change.Movie.ID,
+			&change.Movie.CreatedAt,
+			&change.Movie.Title,
+			&change.Movie.Year,
+			&change.Movie.Runtime,
+			pq.Array(&change.Movie.Genres),
+			&change.Movie.Certification,
+			&change.Movie.Language,
+			&change.Movie.Version,
+			&change.Movie.PosterKey,
+			&change.Movie.PosterURL,
+			&change.Movie.AverageRating,
+			&change.Movie.RatingCount,
+			&change.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, &change)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// getOne runs a query which returns at most one movie on the read replica,
+// if there is one.
+func (m MovieModel) getOne(query string, args ...any) (*Movie, error) {
+	var movie Movie
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.reader().QueryRowContext(ctx, query, args...).Scan(
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Certification,
+		&movie.Language,
+		&movie.Version,
+		&movie.PosterKey,
+		&movie.PosterURL,
+		&movie.AverageRating,
+		&movie.RatingCount,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &movie, nil
+}
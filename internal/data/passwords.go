@@ -0,0 +1,90 @@
+package data
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// MinPasswordScore is the lowest PasswordScore accepted for a new password.
+const MinPasswordScore = 2
+
+// commonPasswords are some of the most used passwords which are long enough
+// to pass the length check, and which any guessing attack tries first.
+var commonPasswords = []string{
+	"password", "password1", "password12", "password123", "passw0rd", "p@ssw0rd",
+	"12345678", "123456789", "1234567890", "87654321", "11111111", "00000000",
+	"qwertyui", "qwertyuiop", "asdfghjk", "zxcvbnm1", "1q2w3e4r", "1qaz2wsx",
+	"iloveyou", "sunshine", "princess", "football", "baseball", "superman",
+	"trustno1", "whatever", "starwars", "computer", "michelle", "jennifer",
+	"letmein1", "welcome1", "abc12345", "abcd1234", "qwerty123", "monkey123",
+	"dragon12", "master12", "shadow12", "greenlight", "movies123",
+}
+
+// PasswordScore estimates how hard a password is to guess, from 0 (trivial)
+// to 4 (strong), in the spirit of zxcvbn. Common passwords score 0.
+// Otherwise the score comes from an entropy estimate: the size of the
+// character set the password draws from, raised to its length, where
+// characters which repeat or continue a sequence from the one before
+// (as in "aaaa" or "1234") only count for a quarter.
+func PasswordScore(password string) int {
+	if slices.Contains(commonPasswords, strings.ToLower(password)) {
+		return 0
+	}
+
+	var lower, upper, digit, symbol, other bool
+
+	runes := []rune(password)
+	length := 0.0
+
+	for i, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+
+		if i > 0 && math.Abs(float64(r-runes[i-1])) <= 1 {
+			length += 0.25
+		} else {
+			length++
+		}
+	}
+
+	pool := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+		}
+	}
+
+	if pool == 0 {
+		return 0
+	}
+
+	entropy := length * math.Log2(float64(pool))
+
+	switch {
+	case entropy < 28:
+		return 0
+	case entropy < 36:
+		return 1
+	case entropy < 60:
+		return 2
+	case entropy < 80:
+		return 3
+	default:
+		return 4
+	}
+}
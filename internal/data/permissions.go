@@ -0,0 +1,95 @@
+package data
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// PermissionReadMovies allows reading the movie catalog and its
+	// reviews. It is granted to every user when they register.
+	PermissionReadMovies = "movies:read"
+	// PermissionWriteMovies allows creating, updating and deleting movies.
+	PermissionWriteMovies = "movies:write"
+	// PermissionReadEmailStatus allows reading the deliverability status of
+	// users' email addresses. It gates a response field rather than a
+	// route; see the permission struct tag.
+	PermissionReadEmailStatus = "users:read-email-status"
+)
+
+// Permissions are the permission codes granted to a user. They are granted
+// to users directly, such as movies:read on registration, and to roles,
+// such as movies:write to editors and admins.
+type Permissions []string
+
+// Includes reports whether the permission is granted.
+func (p Permissions) Includes(code string) bool {
+	return slices.Contains(p, code)
+}
+
+type PermissionModel struct {
+	DB Querier
+}
+
+// GetAllForUser returns the permissions granted to the user, both directly
+// and through their roles.
+func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+	query := `
+		SELECT code
+		FROM permissions
+		WHERE id IN (
+			SELECT permission_id FROM users_permissions WHERE user_id = $1
+			UNION
+			SELECT roles_permissions.permission_id
+			FROM roles_permissions
+			INNER JOIN users_roles ON users_roles.role = roles_permissions.role
+			WHERE users_roles.user_id = $1
+		)
+		ORDER BY code`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := Permissions{}
+
+	for rows.Next() {
+		var code string
+
+		err := rows.Scan(&code)
+		if err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, code)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// AddForUser grants the permissions to the user directly. Permissions the
+// user already has are left alone.
+func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
+	query := `
+		INSERT INTO users_permissions (user_id, permission_id)
+		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+		ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	return err
+}
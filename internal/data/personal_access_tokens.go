@@ -0,0 +1,254 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+
+	"github.com/lib/pq"
+)
+
+// PersonalAccessTokenPrefix starts the plaintext of every personal access
+// token, which lets the authenticate middleware tell them apart from JWTs
+// and makes leaked tokens easy to scan for.
+const PersonalAccessTokenPrefix = "pat_"
+
+const (
+	ScopeReadMovies     = "read:movies"
+	ScopeWriteMovies    = "write:movies"
+	ScopeWriteReviews   = "write:reviews"
+	ScopeWriteWatchlist = "write:watchlist"
+	ScopeWriteProgress  = "write:progress"
+)
+
+// PersonalAccessTokenScopes lists the scopes a personal access token can be
+// granted.
+var PersonalAccessTokenScopes = []string{ScopeReadMovies, ScopeWriteMovies, ScopeWriteReviews, ScopeWriteWatchlist, ScopeWriteProgress}
+
+// PersonalAccessToken is a long-lived, named token which a user creates for
+// scripts and integrations. Unlike authentication JWTs, it is restricted to
+// the scopes chosen when it was created and can be revoked at any time.
+type PersonalAccessToken struct {
+	ID         int64      `json:"id"`
+	Plaintext  string     `json:"token,omitempty"`
+	Hash       []byte     `json:"-"`
+	UserID     int64      `json:"-"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Expiry     time.Time  `json:"expiry"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// HasScope reports whether the token was granted the given scope.
+func (t *PersonalAccessToken) HasScope(scope string) bool {
+	return validator.PermittedValue(scope, t.Scopes...)
+}
+
+func NewPersonalAccessToken(userID int64, name string, scopes []string, expiry time.Time) (*PersonalAccessToken, error) {
+	token := &PersonalAccessToken{
+		UserID: userID,
+		Name:   name,
+		Scopes: scopes,
+		Expiry: expiry,
+	}
+
+	randomBytes := make([]byte, 32)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Plaintext = PersonalAccessTokenPrefix + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+
+	hash := sha256.Sum256([]byte(token.Plaintext))
+	token.Hash = hash[:]
+
+	return token, nil
+}
+
+func ValidatePersonalAccessToken(v *validator.Validator, token *PersonalAccessToken) {
+	v.Check(token.Name != "", "name", "must be provided")
+	v.Check(len(token.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	v.Check(len(token.Scopes) >= 1, "scopes", "must contain at least 1 scope")
+	v.Check(validator.Unique(token.Scopes), "scopes", "must not contain duplicate values")
+	for _, scope := range token.Scopes {
+		v.Check(validator.PermittedValue(scope, PersonalAccessTokenScopes...), "scopes", "contains an unknown scope")
+	}
+
+	v.Check(token.Expiry.After(time.Now()), "expiry", "must be in the future")
+	v.Check(token.Expiry.Before(time.Now().AddDate(1, 0, 1)), "expiry", "must not be more than 1 year in the future")
+}
+
+type PersonalAccessTokenModel struct {
+	DB Querier
+}
+
+func (m PersonalAccessTokenModel) Insert(token *PersonalAccessToken) error {
+	query := `
+		INSERT INTO personal_access_tokens (user_id, name, hash, scopes, expiry)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	args := []any{token.UserID, token.Name, token.Hash, pq.Array(token.Scopes), token.Expiry}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&token.ID, &token.CreatedAt)
+}
+
+func (m PersonalAccessTokenModel) GetAllForUser(userID int64) ([]*PersonalAccessToken, error) {
+	query := `
+		SELECT id, user_id, name, scopes, created_at, expiry, last_used_at
+		FROM personal_access_tokens
+		WHERE user_id = $1
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*PersonalAccessToken{}
+
+	for rows.Next() {
+		var token PersonalAccessToken
+
+		err := rows.Scan(
+			&token.ID,
+			&token.UserID,
+			&token.Name,
+			pq.Array(&token.Scopes),
+			&token.CreatedAt,
+			&token.Expiry,
+			&token.LastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, &token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// GetForPlaintext returns the unexpired token matching the plaintext, along
+// with the user it belongs to.
+func (m PersonalAccessTokenModel) GetForPlaintext(plaintext string) (*PersonalAccessToken, *User, error) {
+	hash := sha256.Sum256([]byte(plaintext))
+
+	query := `
+		SELECT personal_access_tokens.id, personal_access_tokens.name, personal_access_tokens.scopes,
+			personal_access_tokens.created_at, personal_access_tokens.expiry, personal_access_tokens.last_used_at,
+			users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+		FROM personal_access_tokens
+		INNER JOIN users ON users.id = personal_access_tokens.user_id
+		WHERE personal_access_tokens.hash = $1
+		AND personal_access_tokens.expiry > $2`
+
+	var (
+		token PersonalAccessToken
+		user  User
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, hash[:], time.Now()).Scan(
+		&token.ID,
+		&token.Name,
+		pq.Array(&token.Scopes),
+		&token.CreatedAt,
+		&token.Expiry,
+		&token.LastUsedAt,
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	token.UserID = user.ID
+
+	return &token, &user, nil
+}
+
+// Touch records that the token has just been used.
+func (m PersonalAccessTokenModel) Touch(id int64) error {
+	query := `
+		UPDATE personal_access_tokens
+		SET last_used_at = NOW()
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+func (m PersonalAccessTokenModel) DeleteForUser(id, userID int64) error {
+	query := `
+		DELETE FROM personal_access_tokens
+		WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteAllForUser revokes every token the user has created.
+func (m PersonalAccessTokenModel) DeleteAllForUser(userID int64) error {
+	query := `
+		DELETE FROM personal_access_tokens
+		WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
@@ -0,0 +1,84 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// retentionBatchSize is the number of rows deleted per statement, which
+// keeps each purge transaction and its locks short.
+const retentionBatchSize = 5000
+
+// RetentionRule says that rows of Table whose Column, a timestamp, is older
+// than MaxAge should be deleted.
+type RetentionRule struct {
+	Name   string
+	Table  string
+	Column string
+	MaxAge time.Duration
+}
+
+type RetentionModel struct {
+	DB Querier
+}
+
+// Count returns the number of rows which the rule would delete.
+func (m RetentionModel) Count(rule RetentionRule) (int64, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*)
+		FROM %s
+		WHERE %s < $1`,
+		pq.QuoteIdentifier(rule.Table), pq.QuoteIdentifier(rule.Column))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var count int64
+
+	err := m.DB.QueryRowContext(ctx, query, time.Now().Add(-rule.MaxAge)).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Purge deletes the rows which the rule applies to, in batches, and returns
+// the number of rows deleted.
+func (m RetentionModel) Purge(rule RetentionRule) (int64, error) {
+	query := fmt.Sprintf(`
+		DELETE FROM %[1]s
+		WHERE ctid IN (
+			SELECT ctid FROM %[1]s
+			WHERE %[2]s < $1
+			LIMIT $2
+		)`,
+		pq.QuoteIdentifier(rule.Table), pq.QuoteIdentifier(rule.Column))
+
+	cutoff := time.Now().Add(-rule.MaxAge)
+
+	var total int64
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		result, err := m.DB.ExecContext(ctx, query, cutoff, retentionBatchSize)
+		cancel()
+		if err != nil {
+			return total, err
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+
+		total += n
+
+		if n < retentionBatchSize {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+)
+
+var ErrDuplicateReview = errors.New("duplicate review")
+
+// Review is a user's rating of a movie, from 1 to 5, with an optional
+// write-up. Each user can review a movie once.
+type Review struct {
+	ID        int64     `json:"id"`
+	MovieID   int64     `json:"movie_id"`
+	UserID    int64     `json:"-"`
+	Author    string    `json:"author"`
+	Rating    int32     `json:"rating"`
+	Body      string    `json:"body,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func ValidateReview(v *validator.Validator, review *Review) {
+	v.Check(review.Rating >= 1 && review.Rating <= 5, "rating", "must be between 1 and 5")
+	v.Check(len(review.Body) <= 5000, "body", "must not be more than 5000 bytes long")
+}
+
+// ReviewSortKeys are the keys review listings can be sorted by.
+var ReviewSortKeys = SortKeys{
+	"id":         "id",
+	"rating":     "rating",
+	"created_at": "created_at",
+}
+
+type ReviewModel struct {
+	DB Querier
+}
+
+// Insert adds the review, returning ErrDuplicateReview if the user has
+// already reviewed the movie. The movie's rating counters are updated in the
+// same statement, so they can't miss a review.
+func (m ReviewModel) Insert(review *Review) error {
+	query := `
+		WITH review AS (
+			INSERT INTO reviews (movie_id, user_id, rating, body)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, created_at, movie_id, rating
+		), counted AS (
+			UPDATE movies
+			SET rating_count = rating_count + 1, rating_sum = rating_sum + review.rating
+			FROM review
+			WHERE movies.id = review.movie_id
+		)
+		SELECT id, created_at FROM review`
+
+	args := []any{review.MovieID, review.UserID, review.Rating, review.Body}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&review.ID, &review.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "reviews_movie_id_user_id_key"`:
+			return ErrDuplicateReview
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetAllForMovie returns a page of the reviews of a movie, along with the
+// name of each author.
+func (m ReviewModel) GetAllForMovie(movieID int64, filters Filters) ([]*Review, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), reviews.id, reviews.movie_id, reviews.user_id, users.name,
+			reviews.rating, reviews.body, reviews.created_at
+		FROM reviews
+		INNER JOIN users ON users.id = reviews.user_id
+		WHERE reviews.movie_id = $1
+		ORDER BY reviews.%s %s, reviews.id ASC
+		LIMIT $2 OFFSET $3`, filters.sortExpression(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	reviews := []*Review{}
+
+	for rows.Next() {
+		var review Review
+
+		err := rows.Scan(
+			&totalRecords,
+			&review.ID,
+			&review.MovieID,
+			&review.UserID,
+			&review.Author,
+			&review.Rating,
+			&review.Body,
+			&review.CreatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		reviews = append(reviews, &review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return reviews, metadata, nil
+}
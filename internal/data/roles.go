@@ -0,0 +1,125 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// RoleAdmin can manage other users' roles, and do anything an editor
+	// can.
+	RoleAdmin = "admin"
+	// RoleEditor can create, update and delete movies.
+	RoleEditor = "editor"
+	// RoleViewer is granted to every user when they register.
+	RoleViewer = "viewer"
+)
+
+// roleRanks orders the roles, so that a role implies the ones ranked below
+// it.
+var roleRanks = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+// AllRoles lists the roles which can be assigned.
+var AllRoles = []string{RoleAdmin, RoleEditor, RoleViewer}
+
+// Roles are the roles assigned to a user.
+type Roles []string
+
+// Includes reports whether the roles grant the given role, either directly
+// or through a higher-ranked role.
+func (r Roles) Includes(role string) bool {
+	for _, assigned := range r {
+		if roleRanks[assigned] >= roleRanks[role] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func ValidateRoles(v *validator.Validator, roles Roles) {
+	v.Check(validator.Unique(roles), "roles", "must not contain duplicate values")
+	for _, role := range roles {
+		v.Check(validator.PermittedValue(role, AllRoles...), "roles", "contains an unknown role")
+	}
+}
+
+type RoleModel struct {
+	DB Querier
+}
+
+func (m RoleModel) GetAllForUser(userID int64) (Roles, error) {
+	query := `
+		SELECT role
+		FROM users_roles
+		WHERE user_id = $1
+		ORDER BY role`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := Roles{}
+
+	for rows.Next() {
+		var role string
+
+		err := rows.Scan(&role)
+		if err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, role)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+func (m RoleModel) AddForUser(userID int64, roles ...string) error {
+	query := `
+		INSERT INTO users_roles (user_id, role)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(roles))
+	return err
+}
+
+// SetForUser replaces the user's roles. It should be called in a
+// transaction, so that the user is never left without any roles part way
+// through.
+func (m RoleModel) SetForUser(userID int64, roles Roles) error {
+	query := `
+		DELETE FROM users_roles
+		WHERE user_id = $1 AND NOT (role = ANY($2))`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array([]string(roles)))
+	if err != nil {
+		return err
+	}
+
+	return m.AddForUser(userID, roles...)
+}
@@ -0,0 +1,48 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidRuntimeFormat is returned when a runtime value can't be parsed
+// from its "<runtime> mins" JSON representation.
+var ErrInvalidRuntimeFormat = errors.New("invalid runtime format")
+
+// Runtime is the movie runtime in minutes.
+type Runtime int32
+
+// MarshalJSON encodes the runtime as a JSON string in the format "<runtime> mins".
+func (r Runtime) MarshalJSON() ([]byte, error) {
+	jsonValue := fmt.Sprintf("%d mins", r)
+
+	quotedJSONValue := strconv.Quote(jsonValue)
+
+	return []byte(quotedJSONValue), nil
+}
+
+// UnmarshalJSON decodes a JSON string in the format "<runtime> mins". Because
+// it has to modify the receiver, it must use a pointer receiver.
+func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
+	unquotedJSONValue, err := strconv.Unquote(string(jsonValue))
+	if err != nil {
+		return ErrInvalidRuntimeFormat
+	}
+
+	parts := strings.Split(unquotedJSONValue, " ")
+
+	if len(parts) != 2 || parts[1] != "mins" {
+		return ErrInvalidRuntimeFormat
+	}
+
+	i, err := strconv.ParseInt(parts[0], 10, 32)
+	if err != nil {
+		return ErrInvalidRuntimeFormat
+	}
+
+	*r = Runtime(i)
+
+	return nil
+}
@@ -0,0 +1,241 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+)
+
+// ErrTOTPCodeReused is returned when a code for a time step which has
+// already been used is presented again.
+var ErrTOTPCodeReused = errors.New("totp code reused")
+
+// ErrTOTPLocked is returned when a user has used up their second factor
+// attempts for the current window.
+var ErrTOTPLocked = errors.New("totp locked")
+
+// recoveryCodeCount is the number of recovery codes issued at enrollment.
+const recoveryCodeCount = 10
+
+// TOTP is a user's enrollment in two-factor authentication. It only takes
+// effect once Enabled, which happens when the user proves that their
+// authenticator app produces valid codes.
+type TOTP struct {
+	UserID   int64
+	Secret   string
+	Enabled  bool
+	LastStep int64
+}
+
+func ValidateTOTPCode(v *validator.Validator, code string) {
+	v.Check(code != "", "code", "must be provided")
+	v.Check(len(code) == 6, "code", "must be 6 digits long")
+}
+
+// GenerateRecoveryCodes returns new single-use recovery codes, which let a
+// user log in if they lose their authenticator.
+func GenerateRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		randomBytes := make([]byte, 10)
+
+		_, err := rand.Read(randomBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		code := base32.StdEncoding.EncodeToString(randomBytes)
+		codes[i] = strings.ToLower(code[:8] + "-" + code[8:16])
+	}
+
+	return codes, nil
+}
+
+func hashRecoveryCode(code string) []byte {
+	hash := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hash[:]
+}
+
+type TOTPModel struct {
+	DB Querier
+}
+
+// Enroll stores a new secret and recovery codes for the user, replacing any
+// earlier enrollment which was never enabled. Enabled enrollments are left
+// untouched and ErrEditConflict is returned.
+func (m TOTPModel) Enroll(userID int64, secret string, recoveryCodes []string) error {
+	query := `
+		INSERT INTO totp_secrets (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_step = 0, created_at = NOW()
+		WHERE totp_secrets.enabled = false`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrEditConflict
+	}
+
+	_, err = m.DB.ExecContext(ctx, `DELETE FROM totp_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, code := range recoveryCodes {
+		_, err = m.DB.ExecContext(ctx, `INSERT INTO totp_recovery_codes (hash, user_id) VALUES ($1, $2)`, hashRecoveryCode(code), userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m TOTPModel) Get(userID int64) (*TOTP, error) {
+	query := `
+		SELECT user_id, secret, enabled, last_step
+		FROM totp_secrets
+		WHERE user_id = $1`
+
+	var totp TOTP
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&totp.UserID, &totp.Secret, &totp.Enabled, &totp.LastStep)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &totp, nil
+}
+
+// UseStep records that the code for a time step has been used, enabling the
+// enrollment if it wasn't already. It returns ErrTOTPCodeReused if that
+// step, or a later one, has already been used, so that an intercepted code
+// can't be replayed.
+func (m TOTPModel) UseStep(userID, step int64) error {
+	query := `
+		UPDATE totp_secrets
+		SET last_step = $2, enabled = true
+		WHERE user_id = $1 AND last_step < $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrTOTPCodeReused
+	}
+
+	return nil
+}
+
+// StartAttempt counts a second factor attempt against the user's limit of
+// maxFailures in window, returning ErrTOTPLocked once the limit has been
+// reached. The window starts at the first failure. The attempt counts as a
+// failure until ResetFailures is called, so that concurrent guesses can't
+// all get in under the limit before any of them is recorded.
+func (m TOTPModel) StartAttempt(userID int64, maxFailures int, window time.Duration) error {
+	query := `
+		UPDATE totp_secrets
+		SET failed_attempts = CASE WHEN failures_since > NOW() - make_interval(secs => $3) THEN failed_attempts + 1 ELSE 1 END,
+			failures_since = CASE WHEN failures_since > NOW() - make_interval(secs => $3) THEN failures_since ELSE NOW() END
+		WHERE user_id = $1
+		AND (failures_since IS NULL OR failures_since <= NOW() - make_interval(secs => $3) OR failed_attempts < $2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, maxFailures, window.Seconds())
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrTOTPLocked
+	}
+
+	return nil
+}
+
+// ResetFailures clears the user's failed second factor attempts, after a
+// successful one.
+func (m TOTPModel) ResetFailures(userID int64) error {
+	query := `
+		UPDATE totp_secrets
+		SET failed_attempts = 0, failures_since = NULL
+		WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
+// UseRecoveryCode consumes one of the user's recovery codes, returning
+// ErrRecordNotFound if it isn't valid.
+func (m TOTPModel) UseRecoveryCode(userID int64, code string) error {
+	query := `
+		DELETE FROM totp_recovery_codes
+		WHERE hash = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, hashRecoveryCode(code), userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
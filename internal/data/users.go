@@ -0,0 +1,468 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+)
+
+var (
+	ErrDuplicateEmail = errors.New("duplicate email")
+)
+
+// AnonymousUser represents a client which didn't provide any authentication
+// credentials.
+var AnonymousUser = &User{}
+
+// DefaultLanguage is the language of users who haven't chosen one, and of
+// the untranslated email templates.
+const DefaultLanguage = "en"
+
+// LanguageRX matches language tags made of a language code and an optional
+// region, such as "id" or "pt-BR".
+var LanguageRX = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+
+type User struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Password  password  `json:"-"`
+	Activated bool      `json:"activated"`
+	Language  string    `json:"language"`
+	Version   int       `json:"-"`
+
+	// EmailStatus is the deliverability of the email address, as of the
+	// latest email check. It is only loaded by GetAll.
+	EmailStatus string `json:"email_status,omitempty" permission:"users:read-email-status"`
+
+	// PasswordChangedAt is when the password was last changed, if ever.
+	// Authentication tokens issued before then are no longer accepted. It
+	// is only loaded by Get.
+	PasswordChangedAt *time.Time `json:"-"`
+}
+
+// IsAnonymous checks if a User instance is the AnonymousUser.
+func (u *User) IsAnonymous() bool {
+	return u == AnonymousUser
+}
+
+// password holds the plaintext (if known) and the hash of a user's
+// password. The plaintext is a pointer so that a password which hasn't been
+// set can be told apart from an empty one.
+type password struct {
+	plaintext *string
+	hash      []byte
+}
+
+// Set hashes a plaintext password with the DefaultPasswordHasher, and stores
+// both the hash and the plaintext versions in the struct.
+func (p *password) Set(plaintextPassword string) error {
+	hash, err := DefaultPasswordHasher.Hash(plaintextPassword)
+	if err != nil {
+		return err
+	}
+
+	p.plaintext = &plaintextPassword
+	p.hash = hash
+
+	return nil
+}
+
+// Matches checks whether the provided plaintext password matches the
+// hashed password stored in the struct.
+func (p *password) Matches(plaintextPassword string) (bool, error) {
+	return matchPasswordHash(p.hash, plaintextPassword)
+}
+
+// NeedsRehash reports whether the stored hash was made with a different
+// algorithm or different parameters than the DefaultPasswordHasher uses.
+func (p *password) NeedsRehash() bool {
+	return DefaultPasswordHasher.NeedsRehash(p.hash)
+}
+
+func ValidateEmail(v *validator.Validator, email string) {
+	v.Check(email != "", "email", "must be provided")
+	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
+}
+
+func ValidateLanguage(v *validator.Validator, language string) {
+	v.Check(validator.Matches(language, LanguageRX), "language", "must be a language tag such as en or pt-BR")
+}
+
+func ValidatePasswordPlaintext(v *validator.Validator, password string) {
+	v.Check(password != "", "password", "must be provided")
+	v.Check(len(password) >= 8, "password", "must be at least 8 bytes long")
+	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
+	v.Check(PasswordScore(password) >= MinPasswordScore, "password", "is too easy to guess")
+}
+
+// ValidateUser checks the user's name, email address and language. The
+// password is checked separately with ValidatePasswordPlaintext, before it
+// is hashed, so that an invalid request doesn't cost a hash and a password
+// which bcrypt can't hash is reported as a validation error.
+func ValidateUser(v *validator.Validator, user *User) {
+	v.Check(user.Name != "", "name", "must be provided")
+	v.Check(len(user.Name) <= 500, "name", "must not be more than 500 bytes long")
+
+	ValidateEmail(v, user.Email)
+	ValidateLanguage(v, user.Language)
+}
+
+// UserSortKeys are the keys user listings can be sorted by.
+var UserSortKeys = SortKeys{
+	"id":         "id",
+	"name":       "name",
+	"email":      "email",
+	"created_at": "created_at",
+}
+
+type UserModel struct {
+	DB Querier
+
+	// IDs generates the IDs of new users. When it is nil, the users table's
+	// sequence does.
+	IDs IDGenerator
+}
+
+func (m UserModel) Insert(user *User) error {
+	id, err := nextID(m.IDs)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO users (id, name, email, password_hash, activated, language)
+		VALUES (COALESCE($1, nextval('users_id_seq')), $2, $3, $4, $5, $6)
+		RETURNING id, created_at, version`
+
+	args := []any{id, user.Name, user.Email, user.Password.hash, user.Activated, user.Language}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+			return ErrDuplicateEmail
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m UserModel) Get(id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, name, email, password_hash, activated, language, version, password_changed_at
+		FROM users
+		WHERE id = $1`
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Language,
+		&user.Version,
+		&user.PasswordChangedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func (m UserModel) GetByEmail(email string) (*User, error) {
+	query := `
+		SELECT id, created_at, name, email, password_hash, activated, language, version
+		FROM users
+		WHERE email = $1`
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, email).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Language,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func (m UserModel) Update(user *User) error {
+	query := `
+		UPDATE users
+		SET name = $1, email = $2, password_hash = $3, activated = $4, language = $5, version = version + 1
+		WHERE id = $6 AND version = $7
+		RETURNING version`
+
+	args := []any{
+		user.Name,
+		user.Email,
+		user.Password.hash,
+		user.Activated,
+		user.Language,
+		user.ID,
+		user.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+			return ErrDuplicateEmail
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UpdatePassword saves the user's new password hash and records when it was
+// changed, using the version for optimistic locking. The time comes from
+// the application's clock rather than the database's, because it is
+// compared with the issue times of authentication tokens.
+func (m UserModel) UpdatePassword(user *User) error {
+	query := `
+		UPDATE users
+		SET password_hash = $1, password_changed_at = $2, version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING version`
+
+	changedAt := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, user.Password.hash, changedAt, user.ID, user.Version).Scan(&user.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	user.PasswordChangedAt = &changedAt
+
+	return nil
+}
+
+// GetAll returns a page of users whose email contains the given text (any
+// user if it is empty) and, if emailStatus isn't empty, whose email has that
+// status, along with the pagination metadata.
+func (m UserModel) GetAll(email string, emailStatus string, filters Filters) ([]*User, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, name, email, activated, language, email_status, version
+		FROM users
+		WHERE (strpos(email, $1) > 0 OR $1 = '')
+		AND (email_status = $2 OR $2 = '')
+		ORDER BY %s %s, id ASC
+		LIMIT $3 OFFSET $4`, filters.sortExpression(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, email, emailStatus, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	users := []*User{}
+
+	for rows.Next() {
+		var user User
+
+		err := rows.Scan(
+			&totalRecords,
+			&user.ID,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.Activated,
+			&user.Language,
+			&user.EmailStatus,
+			&user.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return users, metadata, nil
+}
+
+// UpdatePasswordHash replaces the user's password hash with one for the
+// same password, such as after the hashing parameters change. Unlike
+// UpdatePassword, it doesn't sign the user out of other sessions.
+func (m UserModel) UpdatePasswordHash(user *User) error {
+	query := `
+		UPDATE users
+		SET password_hash = $1, version = version + 1
+		WHERE id = $2 AND version = $3
+		RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, user.Password.hash, user.ID, user.Version).Scan(&user.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetPendingEmail records the address the user wants to change their email
+// to. It replaces any earlier pending address, and only takes effect once
+// ConfirmPendingEmail is called.
+func (m UserModel) SetPendingEmail(id int64, email string) error {
+	query := `
+		UPDATE users
+		SET pending_email = $1
+		WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, email, id)
+	return err
+}
+
+// ConfirmPendingEmail swaps the user's email for their pending one, and
+// returns the new address. It returns ErrRecordNotFound if there is no
+// pending email, and ErrDuplicateEmail if another account has taken the
+// address since it was requested.
+func (m UserModel) ConfirmPendingEmail(id int64) (string, error) {
+	query := `
+		UPDATE users
+		SET email = pending_email, pending_email = NULL, version = version + 1
+		WHERE id = $1 AND pending_email IS NOT NULL
+		RETURNING email`
+
+	var email string
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&email)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+			return "", ErrDuplicateEmail
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+
+	return email, nil
+}
+
+// GetForToken returns the user a token of the given scope was issued to,
+// provided the token hasn't expired.
+func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.language, users.version
+		FROM users
+		INNER JOIN tokens
+		ON users.id = tokens.user_id
+		WHERE tokens.hash = $1
+		AND tokens.scope = $2
+		AND tokens.expiry > $3`
+
+	args := []any{tokenHash[:], tokenScope, time.Now()}
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Language,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
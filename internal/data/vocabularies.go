@@ -0,0 +1,270 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+
+	"github.com/lib/pq"
+)
+
+// The controlled vocabularies which movie fields are validated against.
+const (
+	VocabularyGenres         = "genres"
+	VocabularyCertifications = "certifications"
+	VocabularyLanguages      = "languages"
+)
+
+// AllVocabularies lists the vocabularies, in the order they are listed in.
+var AllVocabularies = []string{VocabularyGenres, VocabularyCertifications, VocabularyLanguages}
+
+var (
+	ErrDuplicateTerm = errors.New("duplicate term")
+	ErrTermInUse     = errors.New("term in use")
+)
+
+// Term is one allowed value in a vocabulary, such as "PG-13" among the
+// certifications, with an optional human-readable label.
+type Term struct {
+	Value string `json:"value"`
+	Label string `json:"label,omitempty"`
+}
+
+// Vocabularies maps each vocabulary to its terms, sorted by value.
+type Vocabularies map[string][]Term
+
+// Values returns the values of a vocabulary's terms.
+func (vs Vocabularies) Values(vocabulary string) []string {
+	values := make([]string, len(vs[vocabulary]))
+	for i, term := range vs[vocabulary] {
+		values[i] = term.Value
+	}
+
+	return values
+}
+
+func ValidateTerm(v *validator.Validator, term *Term) {
+	v.Check(term.Value != "", "value", "must be provided")
+	v.Check(len(term.Value) <= 100, "value", "must not be more than 100 bytes long")
+	v.Check(strings.TrimSpace(term.Value) == term.Value, "value", "must not start or end with spaces")
+	v.Check(!strings.Contains(term.Value, ","), "value", "must not contain commas")
+	v.Check(len(term.Label) <= 200, "label", "must not be more than 200 bytes long")
+}
+
+// ValidateMovieVocabularies checks the movie's genres, certification and
+// language against the vocabularies. The error messages list the allowed
+// values, so that clients can correct the request. The certification and
+// language are optional.
+func ValidateMovieVocabularies(v *validator.Validator, movie *Movie, vocabularies Vocabularies) {
+	check := func(key, vocabulary, value string) {
+		allowed := vocabularies.Values(vocabulary)
+		if !validator.PermittedValue(value, allowed...) {
+			v.AddError(key, fmt.Sprintf("contains %q, which is not one of the allowed values: %s", value, strings.Join(allowed, ", ")))
+		}
+	}
+
+	for _, genre := range movie.Genres {
+		check("genres", VocabularyGenres, genre)
+	}
+
+	if movie.Certification != "" {
+		check("certification", VocabularyCertifications, movie.Certification)
+	}
+
+	if movie.Language != "" {
+		check("language", VocabularyLanguages, movie.Language)
+	}
+}
+
+type VocabularyModel struct {
+	DB Querier
+}
+
+// GetAll returns every vocabulary. Vocabularies without terms are included,
+// with an empty list.
+func (m VocabularyModel) GetAll() (Vocabularies, error) {
+	return m.get(AllVocabularies)
+}
+
+// Get returns the terms of one vocabulary.
+func (m VocabularyModel) Get(vocabulary string) ([]Term, error) {
+	vocabularies, err := m.get([]string{vocabulary})
+	if err != nil {
+		return nil, err
+	}
+
+	return vocabularies[vocabulary], nil
+}
+
+// get reads the genres from the genres table, which movies link to, and the
+// other vocabularies from the vocabularies table.
+func (m VocabularyModel) get(names []string) (Vocabularies, error) {
+	query := `
+		SELECT vocabulary, value, label
+		FROM vocabularies
+		WHERE vocabulary = ANY($1)
+		UNION ALL
+		SELECT $2, name, label
+		FROM genres
+		WHERE $2 = ANY($1)
+		ORDER BY 1, 2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(names), VocabularyGenres)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vocabularies := make(Vocabularies, len(names))
+	for _, name := range names {
+		vocabularies[name] = []Term{}
+	}
+
+	for rows.Next() {
+		var (
+			vocabulary string
+			term       Term
+		)
+
+		err := rows.Scan(&vocabulary, &term.Value, &term.Label)
+		if err != nil {
+			return nil, err
+		}
+
+		vocabularies[vocabulary] = append(vocabularies[vocabulary], term)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return vocabularies, nil
+}
+
+// Insert adds a term to a vocabulary. It returns ErrDuplicateTerm if the
+// vocabulary already has a term with the same value.
+func (m VocabularyModel) Insert(vocabulary string, term *Term) error {
+	query := `
+		INSERT INTO vocabularies (vocabulary, value, label)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`
+
+	args := []any{vocabulary, term.Value, term.Label}
+
+	if vocabulary == VocabularyGenres {
+		query = `
+			INSERT INTO genres (name, label)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING`
+
+		args = args[1:]
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrDuplicateTerm
+	}
+
+	return nil
+}
+
+// UpdateLabel changes the label of a term. The value can't be changed,
+// because movies refer to it.
+func (m VocabularyModel) UpdateLabel(vocabulary string, term *Term) error {
+	query := `
+		UPDATE vocabularies
+		SET label = $1
+		WHERE vocabulary = $2 AND value = $3
+		RETURNING value`
+
+	args := []any{term.Label, vocabulary, term.Value}
+
+	if vocabulary == VocabularyGenres {
+		query = `
+			UPDATE genres
+			SET label = $1
+			WHERE name = $2
+			RETURNING name`
+
+		args = []any{term.Label, term.Value}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&term.Value)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes a term from a vocabulary. Movies which already use a
+// certification or language keep it, but must stop using it the next time
+// they are updated. A genre can't be deleted while movies use it, and
+// ErrTermInUse is returned instead.
+func (m VocabularyModel) Delete(vocabulary, value string) error {
+	query := `
+		DELETE FROM vocabularies
+		WHERE vocabulary = $1 AND value = $2`
+
+	args := []any{vocabulary, value}
+
+	if vocabulary == VocabularyGenres {
+		query = `
+			DELETE FROM genres
+			WHERE name = $1`
+
+		args = args[1:]
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), `violates foreign key constraint "movies_genres_genre_id_fkey"`):
+			return ErrTermInUse
+		default:
+			return err
+		}
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
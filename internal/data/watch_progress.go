@@ -0,0 +1,169 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+)
+
+// WatchProgress is how far a user has got through a movie. UpdatedAt is the
+// time the position was recorded on the playing device, not the time it
+// reached the server, so that a device which syncs late can't overwrite
+// more recent progress from another one.
+type WatchProgress struct {
+	MovieID         int64     `json:"movie_id"`
+	UserID          int64     `json:"-"`
+	PositionSeconds int32     `json:"position_seconds"`
+	Completed       bool      `json:"completed"`
+	Device          string    `json:"device,omitempty"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// ValidateWatchProgress checks the progress against the movie it is for. A
+// position past the end of the movie is only rejected when its runtime is
+// known.
+func ValidateWatchProgress(v *validator.Validator, progress *WatchProgress, movie *Movie) {
+	v.Check(progress.PositionSeconds >= 0, "position_seconds", "must not be negative")
+	if movie.Runtime > 0 {
+		v.Check(progress.PositionSeconds <= int32(movie.Runtime)*60, "position_seconds", "must not be past the end of the movie")
+	}
+
+	v.Check(len(progress.Device) <= 100, "device", "must not be more than 100 bytes long")
+
+	v.Check(!progress.UpdatedAt.IsZero(), "updated_at", "must be provided")
+	v.Check(progress.UpdatedAt.Before(time.Now().Add(time.Minute)), "updated_at", "must not be in the future")
+}
+
+type WatchProgressModel struct {
+	DB Querier
+}
+
+// Upsert stores the progress unless the stored progress was recorded more
+// recently, in which case it is left alone. Either way, progress is updated
+// to the values which are now stored.
+func (m WatchProgressModel) Upsert(progress *WatchProgress) error {
+	query := `
+		INSERT INTO watch_progress (user_id, movie_id, position, completed, device, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, movie_id) DO UPDATE
+		SET position = EXCLUDED.position, completed = EXCLUDED.completed,
+			device = EXCLUDED.device, updated_at = EXCLUDED.updated_at
+		WHERE watch_progress.updated_at <= EXCLUDED.updated_at
+		RETURNING position, completed, device, updated_at`
+
+	args := []any{
+		progress.UserID,
+		progress.MovieID,
+		progress.PositionSeconds,
+		progress.Completed,
+		progress.Device,
+		progress.UpdatedAt,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&progress.PositionSeconds,
+		&progress.Completed,
+		&progress.Device,
+		&progress.UpdatedAt,
+	)
+	switch {
+	case err == nil:
+		return nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+
+	// The stored progress was recorded more recently, so the update was
+	// skipped and no row was returned.
+	stored, err := m.Get(progress.UserID, progress.MovieID)
+	if err != nil {
+		return err
+	}
+
+	*progress = *stored
+
+	return nil
+}
+
+func (m WatchProgressModel) Get(userID, movieID int64) (*WatchProgress, error) {
+	query := `
+		SELECT movie_id, user_id, position, completed, device, updated_at
+		FROM watch_progress
+		WHERE user_id = $1 AND movie_id = $2`
+
+	var progress WatchProgress
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, movieID).Scan(
+		&progress.MovieID,
+		&progress.UserID,
+		&progress.PositionSeconds,
+		&progress.Completed,
+		&progress.Device,
+		&progress.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &progress, nil
+}
+
+// GetUnfinishedForUser returns the user's progress on movies they haven't
+// completed, most recently watched first, for a "continue watching" list.
+func (m WatchProgressModel) GetUnfinishedForUser(userID int64, limit int) ([]*WatchProgress, error) {
+	query := `
+		SELECT movie_id, user_id, position, completed, device, updated_at
+		FROM watch_progress
+		WHERE user_id = $1 AND NOT completed
+		ORDER BY updated_at DESC, movie_id
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	progress := []*WatchProgress{}
+
+	for rows.Next() {
+		var p WatchProgress
+
+		err := rows.Scan(
+			&p.MovieID,
+			&p.UserID,
+			&p.PositionSeconds,
+			&p.Completed,
+			&p.Device,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		progress = append(progress, &p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return progress, nil
+}
@@ -0,0 +1,146 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrDuplicateWatchlistItem = errors.New("duplicate watchlist item")
+
+// WatchlistItem is a movie a user has saved to watch later.
+type WatchlistItem struct {
+	Movie   *Movie    `json:"movie"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// WatchlistSortKeys are the keys watchlists can be sorted by.
+var WatchlistSortKeys = SortKeys{
+	"added_at": "watchlist.added_at",
+	"title":    "movies.title",
+	"year":     "movies.year",
+}
+
+type WatchlistModel struct {
+	DB Querier
+}
+
+// Insert adds the movie to the user's watchlist, returning
+// ErrDuplicateWatchlistItem if it is already on it.
+func (m WatchlistModel) Insert(userID, movieID int64) (time.Time, error) {
+	query := `
+		INSERT INTO watchlist (user_id, movie_id)
+		VALUES ($1, $2)
+		RETURNING added_at`
+
+	var addedAt time.Time
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, movieID).Scan(&addedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "watchlist_pkey"`:
+			return time.Time{}, ErrDuplicateWatchlistItem
+		default:
+			return time.Time{}, err
+		}
+	}
+
+	return addedAt, nil
+}
+
+// Delete removes the movie from the user's watchlist, returning
+// ErrRecordNotFound if it wasn't on it.
+func (m WatchlistModel) Delete(userID, movieID int64) error {
+	query := `
+		DELETE FROM watchlist
+		WHERE user_id = $1 AND movie_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAllForUser returns a page of the user's watchlist, with the details of
+// each movie.
+func (m WatchlistModel) GetAllForUser(userID int64, filters Filters) ([]*WatchlistItem, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), movies.id, movies.created_at, movies.title, movies.year, movies.runtime,
+			movie_genres(movies.id), movies.certification, movies.language, movies.version,
+			movies.poster_key, movies.poster_url,
+			round(movies.rating_sum::numeric / NULLIF(movies.rating_count, 0), 1), movies.rating_count,
+			watchlist.added_at
+		FROM watchlist
+		INNER JOIN movies ON movies.id = watchlist.movie_id
+		WHERE watchlist.user_id = $1
+		ORDER BY %s %s, movies.id ASC
+		LIMIT $2 OFFSET $3`, filters.sortExpression(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	items := []*WatchlistItem{}
+
+	for rows.Next() {
+		var item WatchlistItem
+		item.Movie = &Movie{}
+
+		err := rows.Scan(
+			&totalRecords,
+			&item.Movie.ID,
+			&item.Movie.CreatedAt,
+			&item.Movie.Title,
+			&item.Movie.Year,
+			&item.Movie.Runtime,
+			pq.Array(&item.Movie.Genres),
+			&item.Movie.Certification,
+			&item.Movie.Language,
+			&item.Movie.Version,
+			&item.Movie.PosterKey,
+			&item.Movie.PosterURL,
+			&item.Movie.AverageRating,
+			&item.Movie.RatingCount,
+			&item.AddedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		items = append(items, &item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return items, metadata, nil
+}
@@ -0,0 +1,135 @@
+package jsonlog
+
+import (
+	"encoding/json"
+	"io"
+	"maps"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Level represents the severity level for a log entry.
+type Level int8
+
+const (
+	LevelInfo Level = iota
+	LevelError
+	LevelFatal
+	LevelOff
+)
+
+// String returns a human-friendly string for the severity level.
+func (l Level) String() string {
+	switch l {
+	case LevelInfo:
+		return "INFO"
+	case LevelError:
+		return "ERROR"
+	case LevelFatal:
+		return "FATAL"
+	default:
+		return ""
+	}
+}
+
+// Logger writes log entries as JSON, one per line. It holds the output
+// destination, the minimum severity level that entries will be written for,
+// any properties added to every entry, and a mutex for coordinating writes.
+type Logger struct {
+	out        io.Writer
+	minLevel   Level
+	properties map[string]string
+	mu         *sync.Mutex
+}
+
+// New returns a new Logger instance which writes log entries at or above a
+// minimum severity level to a specific output destination.
+func New(out io.Writer, minLevel Level) *Logger {
+	return &Logger{
+		out:      out,
+		minLevel: minLevel,
+		mu:       &sync.Mutex{},
+	}
+}
+
+// With returns a Logger which adds the properties to every entry it writes,
+// in addition to any properties already added by l. It shares the output
+// destination and mutex of l.
+func (l *Logger) With(properties map[string]string) *Logger {
+	merged := make(map[string]string, len(l.properties)+len(properties))
+	maps.Copy(merged, l.properties)
+	maps.Copy(merged, properties)
+
+	return &Logger{
+		out:        l.out,
+		minLevel:   l.minLevel,
+		properties: merged,
+		mu:         l.mu,
+	}
+}
+
+func (l *Logger) PrintInfo(message string, properties map[string]string) {
+	l.print(LevelInfo, message, properties)
+}
+
+func (l *Logger) PrintError(err error, properties map[string]string) {
+	l.print(LevelError, err.Error(), properties)
+}
+
+// PrintFatal writes a FATAL level entry and terminates the application.
+func (l *Logger) PrintFatal(err error, properties map[string]string) {
+	l.print(LevelFatal, err.Error(), properties)
+	os.Exit(1)
+}
+
+func (l *Logger) print(level Level, message string, properties map[string]string) (int, error) {
+	if level < l.minLevel {
+		return 0, nil
+	}
+
+	if len(l.properties) > 0 {
+		merged := make(map[string]string, len(l.properties)+len(properties))
+		maps.Copy(merged, l.properties)
+		maps.Copy(merged, properties)
+		properties = merged
+	}
+
+	aux := struct {
+		Level      string            `json:"level"`
+		Time       string            `json:"time"`
+		Message    string            `json:"message"`
+		Properties map[string]string `json:"properties,omitempty"`
+		Trace      string            `json:"trace,omitempty"`
+	}{
+		Level:      level.String(),
+		Time:       time.Now().UTC().Format(time.RFC3339),
+		Message:    message,
+		Properties: properties,
+	}
+
+	// Include a stack trace for entries at the ERROR and FATAL levels.
+	if level >= LevelError {
+		aux.Trace = string(debug.Stack())
+	}
+
+	var line []byte
+
+	line, err := json.Marshal(aux)
+	if err != nil {
+		line = []byte(LevelError.String() + ": unable to marshal log message: " + err.Error())
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.out.Write(append(line, '\n'))
+}
+
+// Write satisfies the io.Writer interface, so the Logger can be used as the
+// error log of an http.Server. Entries are written at the ERROR level with no
+// additional properties.
+func (l *Logger) Write(message []byte) (n int, err error) {
+	return l.print(LevelError, string(message), nil)
+}
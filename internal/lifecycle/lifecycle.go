@@ -0,0 +1,121 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout is the time a hook's OnStart or OnShutdown function is
+// given to complete when the hook doesn't set its own Timeout.
+const DefaultTimeout = 15 * time.Second
+
+// Hook is a subsystem's start-up and shutdown logic. Either function can be
+// nil. Both are given a context which is cancelled once the timeout expires.
+type Hook struct {
+	Name       string
+	Timeout    time.Duration
+	OnStart    func(context.Context) error
+	OnShutdown func(context.Context) error
+}
+
+// Lifecycle starts hooks in the order they were appended, and shuts them
+// down in the reverse order, so that a subsystem is always stopped before
+// the subsystems it was started after (and may depend on).
+type Lifecycle struct {
+	mu      sync.Mutex
+	pending []Hook
+	started []Hook
+}
+
+func New() *Lifecycle {
+	return &Lifecycle{}
+}
+
+// Append registers a hook. Hooks can be appended after Start has been
+// called; they are started by the next call to Start.
+func (l *Lifecycle) Append(hook Hook) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.pending = append(l.pending, hook)
+}
+
+// Start runs the OnStart function of every hook which hasn't been started
+// yet. It stops at the first error, leaving the hooks which started
+// successfully to be stopped by Shutdown.
+func (l *Lifecycle) Start(ctx context.Context) error {
+	l.mu.Lock()
+	pending := l.pending
+	l.pending = nil
+	l.mu.Unlock()
+
+	for _, hook := range pending {
+		if hook.OnStart != nil {
+			err := run(ctx, hook, hook.OnStart)
+			if err != nil {
+				return fmt.Errorf("lifecycle: starting %s: %w", hook.Name, err)
+			}
+		}
+
+		l.mu.Lock()
+		l.started = append(l.started, hook)
+		l.mu.Unlock()
+	}
+
+	return nil
+}
+
+// Shutdown runs the OnShutdown function of every started hook in reverse
+// order. A failing hook doesn't stop the remaining hooks from being shut
+// down; all the errors are returned together.
+func (l *Lifecycle) Shutdown(ctx context.Context) error {
+	l.mu.Lock()
+	started := l.started
+	l.started = nil
+	l.mu.Unlock()
+
+	var errs []error
+
+	for i := len(started) - 1; i >= 0; i-- {
+		hook := started[i]
+
+		if hook.OnShutdown == nil {
+			continue
+		}
+
+		err := run(ctx, hook, hook.OnShutdown)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("lifecycle: stopping %s: %w", hook.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// run calls fn with a context bounded by the hook's timeout, and returns
+// when either fn returns or the timeout expires, whichever happens first.
+func run(ctx context.Context, hook Hook, fn func(context.Context) error) error {
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result := make(chan error, 1)
+
+	go func() {
+		result <- fn(ctx)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,39 @@
+package mailer
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// LogSender writes messages to an io.Writer instead of sending them. It is
+// meant for development, where it's convenient to read the emails (and
+// follow their links) straight from the terminal.
+type LogSender struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func NewLogSender(out io.Writer) *LogSender {
+	return &LogSender{out: out}
+}
+
+func (s *LogSender) Send(msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := fmt.Fprintf(s.out, "To: %s\nFrom: %s\nSubject: %s\n", msg.To, msg.From, msg.Subject)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range msg.Attachments {
+		_, err = fmt.Fprintf(s.out, "Attachment: %s (%s, %d bytes, inline: %t)\n", a.Filename, a.ContentType, len(a.Content), a.Inline)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(s.out, "\n%s\n", msg.PlainBody)
+	return err
+}
@@ -0,0 +1,212 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+//go:embed "templates"
+var templateFS embed.FS
+
+// timeout bounds the time the API-based backends spend sending a message.
+const timeout = 10 * time.Second
+
+// Message is a rendered email, ready to be handed to a Sender.
+type Message struct {
+	To          string
+	From        string
+	Subject     string
+	PlainBody   string
+	HTMLBody    string
+	Language    string
+	Attachments []Attachment
+}
+
+// Sender delivers rendered messages. Implementations exist for SMTP, the
+// SendGrid API, AWS SES and a development backend which only logs the
+// message.
+type Sender interface {
+	Send(msg *Message) error
+}
+
+// Mailer renders the email templates and passes the result to a Sender,
+// retrying failed sends as its RetryPolicy says. The embedded templates are
+// parsed once, when the Mailer is created.
+type Mailer struct {
+	sender    Sender
+	retry     RetryPolicy
+	from      string
+	templates map[string]*template.Template
+	reloadFS  fs.FS
+}
+
+// New returns a Mailer which sends from the given address. If templateDir
+// isn't empty, the templates are instead re-read from that directory on
+// every send, so they can be edited without restarting the server during
+// development.
+func New(sender Sender, retry RetryPolicy, from, templateDir string) (Mailer, error) {
+	m := Mailer{
+		sender: sender,
+		retry:  retry,
+		from:   from,
+	}
+
+	if templateDir != "" {
+		m.reloadFS = os.DirFS(templateDir)
+		return m, nil
+	}
+
+	templates, err := newTemplateCache(templateFS, "templates/*.tmpl")
+	if err != nil {
+		return Mailer{}, err
+	}
+
+	m.templates = templates
+
+	return m, nil
+}
+
+// newTemplateCache parses every template in fsys matching pattern, keyed by
+// file name.
+func newTemplateCache(fsys fs.FS, pattern string) (map[string]*template.Template, error) {
+	cache := map[string]*template.Template{}
+
+	files, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		tmpl, err := template.New("email").ParseFS(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		cache[path.Base(file)] = tmpl
+	}
+
+	return cache, nil
+}
+
+// ParseTemplates parses every template, so that a broken one is found before
+// the first email which uses it. The embedded templates have already been
+// parsed by New, so there is only work to do when they are re-read from a
+// directory.
+func (m Mailer) ParseTemplates() error {
+	if m.reloadFS == nil {
+		return nil
+	}
+
+	_, err := newTemplateCache(m.reloadFS, "*.tmpl")
+	return err
+}
+
+// template returns the most specific translation of templateFile for the
+// language, falling back from "pt-BR" to "pt" and then to the untranslated
+// template. Translations are named after the language, as in
+// user_welcome.id.tmpl for the Indonesian version of user_welcome.tmpl.
+func (m Mailer) template(templateFile, language string) (*template.Template, error) {
+	for _, name := range localizedNames(templateFile, language) {
+		if m.reloadFS != nil {
+			_, err := fs.Stat(m.reloadFS, name)
+			if err != nil {
+				continue
+			}
+
+			return template.New("email").ParseFS(m.reloadFS, name)
+		}
+
+		tmpl, ok := m.templates[name]
+		if ok {
+			return tmpl, nil
+		}
+	}
+
+	return nil, fmt.Errorf("mailer: the template %s does not exist", templateFile)
+}
+
+// localizedNames returns the file names to look for templateFile under, from
+// the most to the least specific.
+func localizedNames(templateFile, language string) []string {
+	ext := path.Ext(templateFile)
+	base := strings.TrimSuffix(templateFile, ext)
+
+	var names []string
+
+	for language != "" {
+		names = append(names, base+"."+language+ext)
+
+		i := strings.LastIndex(language, "-")
+		if i < 0 {
+			break
+		}
+		language = language[:i]
+	}
+
+	return append(names, templateFile)
+}
+
+// Render executes the "subject", "plainBody" and "htmlBody" templates from
+// templateFile with the dynamic data, and returns the resulting message for
+// recipient, in the language and with the attachments set by the options.
+func (m Mailer) Render(recipient, templateFile string, data any, opts ...Option) (*Message, error) {
+	msg := &Message{
+		To:   recipient,
+		From: m.from,
+	}
+
+	for _, opt := range opts {
+		opt(msg)
+	}
+
+	tmpl, err := m.template(templateFile, msg.Language)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return nil, err
+	}
+
+	plainBody := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlBody := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Subject = subject.String()
+	msg.PlainBody = plainBody.String()
+	msg.HTMLBody = htmlBody.String()
+
+	return msg, nil
+}
+
+// Send renders templateFile and sends the result to recipient, blocking
+// until the backend has accepted the message or the retries have run out.
+// Handlers should use a Queue instead.
+func (m Mailer) Send(ctx context.Context, recipient, templateFile string, data any, opts ...Option) error {
+	msg, err := m.Render(recipient, templateFile, data, opts...)
+	if err != nil {
+		return err
+	}
+
+	return m.retry.do(ctx, func() error {
+		return m.sender.Send(msg)
+	})
+}
@@ -0,0 +1,60 @@
+package mailer
+
+import (
+	"mime"
+	"net/http"
+	"path/filepath"
+)
+
+// Attachment is a file sent with a message. Inline attachments are meant to
+// be shown in the HTML body rather than offered for download, and are
+// referenced from a template by their file name, as in
+// <img src="cid:logo.png">.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+	Inline      bool
+}
+
+// Option sets optional parts of a message, such as its language or
+// attachments.
+type Option func(*Message)
+
+// WithLanguage renders the message from the translation of the template for
+// the language, if there is one. The language is a tag such as "id" or
+// "pt-BR".
+func WithLanguage(language string) Option {
+	return func(msg *Message) {
+		msg.Language = language
+	}
+}
+
+// WithAttachment attaches a file to the message.
+func WithAttachment(filename string, content []byte) Option {
+	return func(msg *Message) {
+		msg.Attachments = append(msg.Attachments, newAttachment(filename, content, false))
+	}
+}
+
+// WithInlineImage embeds an image in the message, for use in the HTML body
+// as cid:<filename>.
+func WithInlineImage(filename string, content []byte) Option {
+	return func(msg *Message) {
+		msg.Attachments = append(msg.Attachments, newAttachment(filename, content, true))
+	}
+}
+
+func newAttachment(filename string, content []byte, inline bool) Attachment {
+	contentType := mime.TypeByExtension(filepath.Ext(filename))
+	if contentType == "" {
+		contentType = http.DetectContentType(content)
+	}
+
+	return Attachment{
+		Filename:    filename,
+		ContentType: contentType,
+		Content:     content,
+		Inline:      inline,
+	}
+}
@@ -0,0 +1,171 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/jsonlog"
+)
+
+var (
+	ErrQueueFull   = errors.New("mailer: queue is full")
+	ErrQueueClosed = errors.New("mailer: queue is closed")
+)
+
+// deadLetterLimit is the number of undeliverable messages kept in memory.
+const deadLetterLimit = 100
+
+// Queue sends messages in the background from a fixed pool of workers, each
+// of which calls Work, so a burst of emails never starts more than a bounded
+// number of goroutines.
+// Failed messages are retried as the Mailer's RetryPolicy says, and those
+// which still fail are logged and moved to an in-memory dead-letter list.
+type Queue struct {
+	mailer Mailer
+	logger *jsonlog.Logger
+	jobs   chan *Message
+
+	mu          sync.RWMutex
+	closed      bool
+	deadLetters []*Message
+
+	sent         atomic.Int64
+	retried      atomic.Int64
+	deadLettered atomic.Int64
+
+	// lastSuccess and lastFailure hold the Unix nanosecond times of the
+	// latest delivery attempts which succeeded and failed.
+	lastSuccess atomic.Int64
+	lastFailure atomic.Int64
+}
+
+// QueueStats reports the activity of a Queue.
+type QueueStats struct {
+	Queued       int   `json:"queued"`
+	Capacity     int   `json:"capacity"`
+	Sent         int64 `json:"sent"`
+	Retried      int64 `json:"retried"`
+	DeadLettered int64 `json:"dead_lettered"`
+}
+
+func NewQueue(mailer Mailer, logger *jsonlog.Logger, size int) *Queue {
+	return &Queue{
+		mailer: mailer,
+		logger: logger,
+		jobs:   make(chan *Message, size),
+	}
+}
+
+// Work sends queued messages until the queue is closed and empty. Once ctx
+// is done, the messages left are each tried only once, without waiting to
+// retry them.
+func (q *Queue) Work(ctx context.Context) {
+	for msg := range q.jobs {
+		q.deliver(ctx, msg)
+	}
+}
+
+// Enqueue renders templateFile for recipient and queues the message for
+// sending. Template errors are returned straight away. If the queue's
+// buffer is full, ErrQueueFull is returned rather than blocking the caller.
+func (q *Queue) Enqueue(recipient, templateFile string, data any, opts ...Option) error {
+	msg, err := q.mailer.Render(recipient, templateFile, data, opts...)
+	if err != nil {
+		return err
+	}
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	select {
+	case q.jobs <- msg:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close stops the queue from accepting messages. The workers return once
+// they have sent the messages which are already queued.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+}
+
+// DeadLetters returns the most recent messages which couldn't be delivered.
+func (q *Queue) DeadLetters() []*Message {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	return append([]*Message(nil), q.deadLetters...)
+}
+
+func (q *Queue) Stats() QueueStats {
+	return QueueStats{
+		Queued:       len(q.jobs),
+		Capacity:     cap(q.jobs),
+		Sent:         q.sent.Load(),
+		Retried:      q.retried.Load(),
+		DeadLettered: q.deadLettered.Load(),
+	}
+}
+
+// Failing reports whether the most recent delivery attempt failed, which
+// usually means the email provider is unavailable or rejecting messages.
+func (q *Queue) Failing() bool {
+	return q.lastFailure.Load() > q.lastSuccess.Load()
+}
+
+func (q *Queue) deliver(ctx context.Context, msg *Message) {
+	attempted := false
+
+	err := q.mailer.retry.do(ctx, func() error {
+		if attempted {
+			q.retried.Add(1)
+		}
+		attempted = true
+
+		err := q.mailer.sender.Send(msg)
+		if err != nil {
+			q.lastFailure.Store(time.Now().UnixNano())
+			return err
+		}
+
+		q.lastSuccess.Store(time.Now().UnixNano())
+		q.sent.Add(1)
+		return nil
+	})
+	if err != nil {
+		q.deadLetter(msg, err)
+	}
+}
+
+func (q *Queue) deadLetter(msg *Message, err error) {
+	q.deadLettered.Add(1)
+
+	q.logger.PrintError(err, map[string]string{
+		"mail_queue": "dead letter",
+		"to":         msg.To,
+		"subject":    msg.Subject,
+	})
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.deadLetters = append(q.deadLetters, msg)
+	if len(q.deadLetters) > deadLetterLimit {
+		q.deadLetters = q.deadLetters[len(q.deadLetters)-deadLetterLimit:]
+	}
+}
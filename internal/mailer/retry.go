@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy is how sends which fail are retried. The wait before the
+// first retry is Backoff, and it doubles with every further retry up to
+// MaxBackoff. Each wait is jittered down by up to half, so that messages
+// which failed together don't all retry together.
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+}
+
+// do calls send until it succeeds, the attempts run out or ctx is done. The
+// error of the last attempt is returned wrapped, once there won't be any
+// more.
+func (p RetryPolicy) do(ctx context.Context, send func() error) error {
+	backoff := p.Backoff
+
+	for attempt := 1; ; attempt++ {
+		err := send()
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= p.MaxAttempts || ctx.Err() != nil {
+			return fmt.Errorf("mailer: giving up after %d attempt(s): %w", attempt, err)
+		}
+
+		timer := time.NewTimer(jitter(backoff))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("mailer: giving up after %d attempt(s): %w", attempt, err)
+		case <-timer.C:
+		}
+
+		backoff = min(backoff*2, p.MaxBackoff)
+	}
+}
+
+// jitter returns a random duration between half of d and d.
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+
+	return d/2 + rand.N(d/2+1)
+}
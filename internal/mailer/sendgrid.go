@@ -0,0 +1,120 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+)
+
+const sendGridURL = "https://api.sendgrid.com/v3/mail/send"
+
+// SendGridSender sends messages through the SendGrid v3 mail API.
+type SendGridSender struct {
+	apiKey string
+	client *http.Client
+}
+
+func NewSendGridSender(apiKey string) *SendGridSender {
+	return &SendGridSender{
+		apiKey: apiKey,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendGridAttachment struct {
+	Content     string `json:"content"`
+	Type        string `json:"type"`
+	Filename    string `json:"filename"`
+	Disposition string `json:"disposition"`
+	ContentID   string `json:"content_id,omitempty"`
+}
+
+type sendGridRequest struct {
+	Personalizations []struct {
+		To []sendGridAddress `json:"to"`
+	} `json:"personalizations"`
+	From        sendGridAddress      `json:"from"`
+	Subject     string               `json:"subject"`
+	Content     []sendGridContent    `json:"content"`
+	Attachments []sendGridAttachment `json:"attachments,omitempty"`
+}
+
+func (s *SendGridSender) Send(msg *Message) error {
+	from, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return err
+	}
+
+	var req sendGridRequest
+
+	req.Personalizations = make([]struct {
+		To []sendGridAddress `json:"to"`
+	}, 1)
+	req.Personalizations[0].To = []sendGridAddress{{Email: msg.To}}
+	req.From = sendGridAddress{Email: from.Address, Name: from.Name}
+	req.Subject = msg.Subject
+	req.Content = []sendGridContent{
+		{Type: "text/plain", Value: msg.PlainBody},
+		{Type: "text/html", Value: msg.HTMLBody},
+	}
+
+	for _, a := range msg.Attachments {
+		attachment := sendGridAttachment{
+			Content:     base64.StdEncoding.EncodeToString(a.Content),
+			Type:        a.ContentType,
+			Filename:    a.Filename,
+			Disposition: "attachment",
+		}
+
+		if a.Inline {
+			attachment.Disposition = "inline"
+			attachment.ContentID = a.Filename
+		}
+
+		req.Attachments = append(req.Attachments, attachment)
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, sendGridURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	r.Header.Set("Authorization", "Bearer "+s.apiKey)
+	r.Header.Set("Content-Type", "application/json")
+
+	res, err := s.client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("mailer: sendgrid responded with %s: %s", res.Status, bytes.TrimSpace(detail))
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// SESSender sends messages through the AWS SES v2 API. Credentials are
+// loaded from the usual AWS sources, such as the environment or an instance
+// role.
+type SESSender struct {
+	client *sesv2.Client
+}
+
+func NewSESSender(region string) (*SESSender, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+
+	return &SESSender{client: sesv2.NewFromConfig(cfg)}, nil
+}
+
+// Send uses a simple SES message, or a raw MIME message when msg has
+// attachments, since simple messages can't carry them.
+func (s *SESSender) Send(msg *Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if len(msg.Attachments) > 0 {
+		var raw bytes.Buffer
+
+		_, err := newMIMEMessage(msg).WriteTo(&raw)
+		if err != nil {
+			return err
+		}
+
+		_, err = s.client.SendEmail(ctx, &sesv2.SendEmailInput{
+			Content: &types.EmailContent{
+				Raw: &types.RawMessage{Data: raw.Bytes()},
+			},
+		})
+
+		return err
+	}
+
+	_, err := s.client.SendEmail(ctx, &sesv2.SendEmailInput{
+		FromEmailAddress: aws.String(msg.From),
+		Destination: &types.Destination{
+			ToAddresses: []string{msg.To},
+		},
+		Content: &types.EmailContent{
+			Simple: &types.Message{
+				Subject: &types.Content{Data: aws.String(msg.Subject)},
+				Body: &types.Body{
+					Text: &types.Content{Data: aws.String(msg.PlainBody)},
+					Html: &types.Content{Data: aws.String(msg.HTMLBody)},
+				},
+			},
+		},
+	})
+
+	return err
+}
@@ -0,0 +1,50 @@
+package mailer
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/go-mail/mail/v2"
+)
+
+// SMTPSender sends messages through an SMTP server.
+type SMTPSender struct {
+	dialer *mail.Dialer
+}
+
+func NewSMTPSender(host string, port int, username, password string) *SMTPSender {
+	dialer := mail.NewDialer(host, port, username, password)
+	dialer.Timeout = 5 * time.Second
+
+	return &SMTPSender{dialer: dialer}
+}
+
+func (s *SMTPSender) Send(msg *Message) error {
+	return s.dialer.DialAndSend(newMIMEMessage(msg))
+}
+
+// newMIMEMessage converts msg into a MIME message, which is also used to
+// send messages with attachments through SES.
+func newMIMEMessage(msg *Message) *mail.Message {
+	m := mail.NewMessage()
+	m.SetHeader("To", msg.To)
+	m.SetHeader("From", msg.From)
+	m.SetHeader("Subject", msg.Subject)
+	if msg.Language != "" {
+		m.SetHeader("Content-Language", msg.Language)
+	}
+	m.SetBody("text/plain", msg.PlainBody)
+	m.AddAlternative("text/html", msg.HTMLBody)
+
+	for _, a := range msg.Attachments {
+		header := mail.SetHeader(map[string][]string{"Content-Type": {a.ContentType}})
+
+		if a.Inline {
+			m.EmbedReader(a.Filename, bytes.NewReader(a.Content), header)
+		} else {
+			m.AttachReader(a.Filename, bytes.NewReader(a.Content), header)
+		}
+	}
+
+	return m
+}
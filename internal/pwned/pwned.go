@@ -0,0 +1,76 @@
+// Package pwned checks passwords against the Have I Been Pwned Pwned
+// Passwords range API, using its k-anonymity model: only the first five
+// characters of the password's SHA-1 hash are sent, and the match is made
+// locally against the suffixes which come back.
+package pwned
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is the address of the public Pwned Passwords API.
+const DefaultBaseURL = "https://api.pwnedpasswords.com"
+
+type Client struct {
+	baseURL string
+	client  *http.Client
+}
+
+func New(baseURL string, timeout time.Duration) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// Count returns the number of times the password appears in known data
+// breaches, which is zero if it hasn't been seen.
+func (c *Client) Count(ctx context.Context, password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/range/"+prefix, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	// Padding hides the real number of matching suffixes from anyone
+	// watching the response size. Padded entries have a count of zero.
+	req.Header.Set("Add-Padding", "true")
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("pwned: unexpected response status %d", res.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		candidate, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || candidate != suffix {
+			continue
+		}
+
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return 0, fmt.Errorf("pwned: invalid count %q", count)
+		}
+
+		return n, nil
+	}
+
+	return 0, scanner.Err()
+}
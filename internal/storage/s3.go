@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// S3Storage keeps the files in an S3 bucket, or in a bucket of an
+// S3-compatible store such as MinIO when an endpoint is given. Credentials
+// are loaded from the usual AWS sources, such as the environment or an
+// instance role. The objects are requested directly with signed PUT and
+// DELETE requests, since those are the only two operations needed.
+type S3Storage struct {
+	client      *http.Client
+	credentials aws.CredentialsProvider
+	signer      *v4.Signer
+	region      string
+	objectURL   string
+	baseURL     string
+}
+
+// NewS3Storage returns an S3Storage for the bucket. Without an endpoint, the
+// bucket is addressed as https://<bucket>.s3.<region>.amazonaws.com, and
+// with one, as <endpoint>/<bucket>. Files are downloaded from baseURL, or
+// from the bucket itself if baseURL is empty, in which case the bucket must
+// allow public reads.
+func NewS3Storage(bucket, region, endpoint, baseURL string) (*S3Storage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+
+	objectURL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, region)
+	if endpoint != "" {
+		objectURL = joinURL(endpoint, url.PathEscape(bucket))
+	}
+
+	if baseURL == "" {
+		baseURL = objectURL
+	}
+
+	return &S3Storage{
+		client:      &http.Client{Timeout: timeout},
+		credentials: cfg.Credentials,
+		signer:      v4.NewSigner(),
+		region:      region,
+		objectURL:   objectURL,
+		baseURL:     baseURL,
+	}, nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, key, contentType string, data []byte) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.keyURL(key), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+
+	return s.do(req, data)
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.keyURL(key), nil)
+	if err != nil {
+		return err
+	}
+
+	return s.do(req, nil)
+}
+
+func (s *S3Storage) URL(key string) string {
+	return joinURL(s.baseURL, key)
+}
+
+// keyURL returns the object's URL, escaping each segment of the key.
+func (s *S3Storage) keyURL(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	return joinURL(s.objectURL, strings.Join(segments, "/"))
+}
+
+// do signs the request with Signature Version 4 and sends it. S3 responds
+// to DELETE with 204 No Content, whether or not the object existed.
+func (s *S3Storage) do(req *http.Request, payload []byte) error {
+	credentials, err := s.credentials.Retrieve(req.Context())
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(payload)
+	payloadHash := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	err = s.signer.SignHTTP(req.Context(), credentials, req, payloadHash, "s3", s.region, time.Now())
+	if err != nil {
+		return err
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("s3 %s %s responded with %s: %s", req.Method, req.URL.Path, res.Status, bytes.TrimSpace(body))
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+// Package storage keeps uploaded files, such as movie posters, and says
+// where clients can download them from.
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// timeout bounds the time the remote backends spend on one operation.
+const timeout = 30 * time.Second
+
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// Storage stores files under slash-separated keys, such as
+// "posters/123-5f3a.jpg". Implementations exist for a local directory and
+// for S3-compatible object stores.
+type Storage interface {
+	// Put stores the file, replacing any file with the same key.
+	Put(ctx context.Context, key, contentType string, data []byte) error
+
+	// Delete removes the file. Deleting a missing file isn't an error.
+	Delete(ctx context.Context, key string) error
+
+	// URL returns the address clients download the file from.
+	URL(key string) string
+}
+
+// validKey reports whether the key is relative and stays inside the
+// storage root once its segments are resolved.
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, `\`) {
+		return false
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+
+	return true
+}
+
+func joinURL(base, key string) string {
+	return strings.TrimSuffix(base, "/") + "/" + key
+}
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS analytics_events (
+    id bigserial PRIMARY KEY,
+    type text NOT NULL,
+    anonymous_id text NOT NULL,
+    properties jsonb NOT NULL,
+    occurred_at timestamp(0) with time zone NOT NULL,
+    received_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS analytics_events_type_occurred_at_idx ON analytics_events (type, occurred_at);
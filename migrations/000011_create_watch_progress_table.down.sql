@@ -0,0 +1 @@
+DROP TABLE IF EXISTS watch_progress;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS watch_progress (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    position integer NOT NULL CHECK (position >= 0),
+    completed bool NOT NULL DEFAULT false,
+    device text NOT NULL DEFAULT '',
+    updated_at timestamp(0) with time zone NOT NULL,
+    PRIMARY KEY (user_id, movie_id)
+);
+
+CREATE INDEX IF NOT EXISTS watch_progress_user_id_updated_at_idx ON watch_progress (user_id, updated_at DESC);
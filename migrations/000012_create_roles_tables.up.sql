@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS roles (
+    name text PRIMARY KEY
+);
+
+CREATE TABLE IF NOT EXISTS users_roles (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    role text NOT NULL REFERENCES roles ON DELETE CASCADE,
+    PRIMARY KEY (user_id, role)
+);
+
+INSERT INTO roles (name)
+VALUES ('admin'), ('editor'), ('viewer')
+ON CONFLICT DO NOTHING;
+
+-- Movie writes now need the editor role. Grant it to the users who could
+-- already make them, so that nobody loses access.
+INSERT INTO users_roles (user_id, role)
+SELECT id, 'editor' FROM users WHERE activated
+ON CONFLICT DO NOTHING;
+
+INSERT INTO users_roles (user_id, role)
+SELECT id, 'viewer' FROM users
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS incidents;
+DROP TABLE IF EXISTS health_checks;
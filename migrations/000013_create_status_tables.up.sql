@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS health_checks (
+    id bigserial PRIMARY KEY,
+    component text NOT NULL,
+    status text NOT NULL,
+    checked_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS health_checks_component_checked_at_idx ON health_checks (component, checked_at);
+
+CREATE TABLE IF NOT EXISTS incidents (
+    id bigserial PRIMARY KEY,
+    title text NOT NULL,
+    body text NOT NULL DEFAULT '',
+    status text NOT NULL,
+    components text[] NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    resolved_at timestamp(0) with time zone,
+    version integer NOT NULL DEFAULT 1
+);
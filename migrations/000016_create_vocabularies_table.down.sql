@@ -0,0 +1,4 @@
+ALTER TABLE movies DROP COLUMN IF EXISTS language;
+ALTER TABLE movies DROP COLUMN IF EXISTS certification;
+
+DROP TABLE IF EXISTS vocabularies;
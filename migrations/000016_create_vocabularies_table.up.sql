@@ -0,0 +1,52 @@
+CREATE TABLE IF NOT EXISTS vocabularies (
+    vocabulary text NOT NULL,
+    value text NOT NULL,
+    label text NOT NULL DEFAULT '',
+    PRIMARY KEY (vocabulary, value)
+);
+
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS certification text NOT NULL DEFAULT '';
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS language text NOT NULL DEFAULT '';
+
+INSERT INTO vocabularies (vocabulary, value, label)
+VALUES
+    ('genres', 'action', 'Action'),
+    ('genres', 'adventure', 'Adventure'),
+    ('genres', 'animation', 'Animation'),
+    ('genres', 'comedy', 'Comedy'),
+    ('genres', 'crime', 'Crime'),
+    ('genres', 'documentary', 'Documentary'),
+    ('genres', 'drama', 'Drama'),
+    ('genres', 'family', 'Family'),
+    ('genres', 'fantasy', 'Fantasy'),
+    ('genres', 'horror', 'Horror'),
+    ('genres', 'musical', 'Musical'),
+    ('genres', 'mystery', 'Mystery'),
+    ('genres', 'romance', 'Romance'),
+    ('genres', 'sci-fi', 'Science fiction'),
+    ('genres', 'thriller', 'Thriller'),
+    ('genres', 'war', 'War'),
+    ('genres', 'western', 'Western'),
+    ('certifications', 'G', 'General audiences'),
+    ('certifications', 'PG', 'Parental guidance suggested'),
+    ('certifications', 'PG-13', 'Parents strongly cautioned'),
+    ('certifications', 'R', 'Restricted'),
+    ('certifications', 'NC-17', 'Adults only'),
+    ('languages', 'de', 'German'),
+    ('languages', 'en', 'English'),
+    ('languages', 'es', 'Spanish'),
+    ('languages', 'fr', 'French'),
+    ('languages', 'hi', 'Hindi'),
+    ('languages', 'it', 'Italian'),
+    ('languages', 'ja', 'Japanese'),
+    ('languages', 'ko', 'Korean'),
+    ('languages', 'pt', 'Portuguese'),
+    ('languages', 'ru', 'Russian'),
+    ('languages', 'zh', 'Chinese')
+ON CONFLICT DO NOTHING;
+
+-- Movies are now validated against the genres vocabulary. Add the genres
+-- already in use, so that existing movies stay valid.
+INSERT INTO vocabularies (vocabulary, value)
+SELECT DISTINCT 'genres', unnest(genres) FROM movies
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS users_email_status_idx;
+
+ALTER TABLE users DROP COLUMN IF EXISTS email_checked_at;
+ALTER TABLE users DROP COLUMN IF EXISTS email_status;
+
+DROP TABLE IF EXISTS email_suppressions;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS email_suppressions (
+    email citext PRIMARY KEY,
+    reason text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_status text NOT NULL DEFAULT 'unchecked';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_checked_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS users_email_status_idx ON users (email_status);
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS movies_record_revision ON movies;
+DROP FUNCTION IF EXISTS record_movie_revision();
+DROP TABLE IF EXISTS movie_revisions;
@@ -0,0 +1,41 @@
+CREATE TABLE IF NOT EXISTS movie_revisions (
+    id bigserial PRIMARY KEY,
+    movie_id bigint NOT NULL,
+    valid_from timestamp with time zone NOT NULL DEFAULT clock_timestamp(),
+    deleted boolean NOT NULL DEFAULT false,
+    title text NOT NULL,
+    year integer NOT NULL,
+    runtime integer NOT NULL,
+    genres text[] NOT NULL,
+    certification text NOT NULL,
+    language text NOT NULL,
+    version integer NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS movie_revisions_movie_id_valid_from_idx ON movie_revisions (movie_id, valid_from);
+
+-- Record every write to movies, whichever code path makes it. A deletion
+-- is recorded as a final revision holding the movie's last state.
+CREATE OR REPLACE FUNCTION record_movie_revision() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO movie_revisions (movie_id, deleted, title, year, runtime, genres, certification, language, version)
+        VALUES (OLD.id, true, OLD.title, OLD.year, OLD.runtime, OLD.genres, OLD.certification, OLD.language, OLD.version);
+        RETURN OLD;
+    END IF;
+
+    INSERT INTO movie_revisions (movie_id, title, year, runtime, genres, certification, language, version)
+    VALUES (NEW.id, NEW.title, NEW.year, NEW.runtime, NEW.genres, NEW.certification, NEW.language, NEW.version);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER movies_record_revision
+AFTER INSERT OR UPDATE OR DELETE ON movies
+FOR EACH ROW EXECUTE FUNCTION record_movie_revision();
+
+-- The history of existing movies starts now, since their earlier states
+-- weren't kept.
+INSERT INTO movie_revisions (movie_id, title, year, runtime, genres, certification, language, version)
+SELECT id, title, year, runtime, genres, certification, language, version
+FROM movies;
@@ -0,0 +1,28 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS genres text[] NOT NULL DEFAULT '{}';
+
+UPDATE movies SET genres = movie_genres(id);
+
+CREATE INDEX IF NOT EXISTS movies_genres_idx ON movies USING GIN (genres);
+
+CREATE OR REPLACE FUNCTION record_movie_revision() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO movie_revisions (movie_id, deleted, title, year, runtime, genres, certification, language, version)
+        VALUES (OLD.id, true, OLD.title, OLD.year, OLD.runtime, OLD.genres, OLD.certification, OLD.language, OLD.version);
+        RETURN OLD;
+    END IF;
+
+    INSERT INTO movie_revisions (movie_id, title, year, runtime, genres, certification, language, version)
+    VALUES (NEW.id, NEW.title, NEW.year, NEW.runtime, NEW.genres, NEW.certification, NEW.language, NEW.version);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+INSERT INTO vocabularies (vocabulary, value, label)
+SELECT 'genres', name, label FROM genres
+ON CONFLICT DO NOTHING;
+
+DROP FUNCTION IF EXISTS movies_with_genres(text[]);
+DROP FUNCTION IF EXISTS movie_genres(bigint);
+DROP TABLE IF EXISTS movies_genres;
+DROP TABLE IF EXISTS genres;
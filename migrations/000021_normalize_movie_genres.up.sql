@@ -0,0 +1,77 @@
+CREATE TABLE IF NOT EXISTS genres (
+    id bigserial PRIMARY KEY,
+    name text NOT NULL UNIQUE,
+    label text NOT NULL DEFAULT ''
+);
+
+-- The genres vocabulary moves from the vocabularies table to genres, along
+-- with any genre which movies use but the vocabulary has since lost.
+INSERT INTO genres (name, label)
+SELECT value, label FROM vocabularies WHERE vocabulary = 'genres'
+ORDER BY value;
+
+INSERT INTO genres (name)
+SELECT DISTINCT unnest(genres) FROM movies
+ON CONFLICT DO NOTHING;
+
+DELETE FROM vocabularies WHERE vocabulary = 'genres';
+
+-- A genre can't be deleted while movies use it. The position keeps the
+-- genres of a movie in the order they were given.
+CREATE TABLE IF NOT EXISTS movies_genres (
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    genre_id bigint NOT NULL REFERENCES genres ON DELETE RESTRICT,
+    position smallint NOT NULL,
+    PRIMARY KEY (movie_id, genre_id)
+);
+
+CREATE INDEX IF NOT EXISTS movies_genres_genre_id_idx ON movies_genres (genre_id);
+
+INSERT INTO movies_genres (movie_id, genre_id, position)
+SELECT movies.id, genres.id, min(g.position)
+FROM movies
+CROSS JOIN unnest(movies.genres) WITH ORDINALITY AS g(name, position)
+INNER JOIN genres ON genres.name = g.name
+GROUP BY movies.id, genres.id;
+
+-- movie_genres returns the names of a movie's genres, in order. The queries
+-- which used to read the genres column call it instead.
+CREATE OR REPLACE FUNCTION movie_genres(movie_id bigint) RETURNS text[] AS $$
+    SELECT COALESCE(array_agg(genres.name ORDER BY movies_genres.position), '{}')
+    FROM movies_genres
+    INNER JOIN genres ON genres.id = movies_genres.genre_id
+    WHERE movies_genres.movie_id = $1
+$$ LANGUAGE sql STABLE;
+
+-- movies_with_genres returns the movies which have all of the named genres,
+-- for filtering listings by genre.
+CREATE OR REPLACE FUNCTION movies_with_genres(names text[]) RETURNS TABLE (movie_id bigint) AS $$
+    SELECT movies_genres.movie_id
+    FROM movies_genres
+    INNER JOIN genres ON genres.id = movies_genres.genre_id
+    WHERE genres.name = ANY($1)
+    GROUP BY movies_genres.movie_id
+    HAVING count(*) = (SELECT count(DISTINCT name) FROM unnest($1) AS name)
+$$ LANGUAGE sql STABLE;
+
+-- Revisions keep a snapshot of the genres. The trigger runs after the whole
+-- statement which wrote the movie, so it sees the movie's new genres. By
+-- the time a deletion is recorded, the genres have already been removed by
+-- the cascade, so they're taken from the previous revision instead.
+CREATE OR REPLACE FUNCTION record_movie_revision() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO movie_revisions (movie_id, deleted, title, year, runtime, genres, certification, language, version)
+        VALUES (OLD.id, true, OLD.title, OLD.year, OLD.runtime,
+            COALESCE((SELECT genres FROM movie_revisions WHERE movie_id = OLD.id ORDER BY valid_from DESC, id DESC LIMIT 1), '{}'),
+            OLD.certification, OLD.language, OLD.version);
+        RETURN OLD;
+    END IF;
+
+    INSERT INTO movie_revisions (movie_id, title, year, runtime, genres, certification, language, version)
+    VALUES (NEW.id, NEW.title, NEW.year, NEW.runtime, movie_genres(NEW.id), NEW.certification, NEW.language, NEW.version);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE movies DROP COLUMN IF EXISTS genres;
@@ -0,0 +1,2 @@
+ALTER TABLE totp_secrets DROP COLUMN IF EXISTS failures_since;
+ALTER TABLE totp_secrets DROP COLUMN IF EXISTS failed_attempts;
@@ -0,0 +1,2 @@
+ALTER TABLE totp_secrets ADD COLUMN IF NOT EXISTS failed_attempts integer NOT NULL DEFAULT 0;
+ALTER TABLE totp_secrets ADD COLUMN IF NOT EXISTS failures_since timestamp(0) with time zone;
@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS movies_record_revision_update ON movies;
+DROP TRIGGER IF EXISTS movies_record_revision ON movies;
+
+CREATE TRIGGER movies_record_revision
+AFTER INSERT OR UPDATE OR DELETE ON movies
+FOR EACH ROW EXECUTE FUNCTION record_movie_revision();
+
+ALTER TABLE movies DROP COLUMN IF EXISTS rating_sum;
+ALTER TABLE movies DROP COLUMN IF EXISTS rating_count;
@@ -0,0 +1,25 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS rating_count integer NOT NULL DEFAULT 0;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS rating_sum bigint NOT NULL DEFAULT 0;
+
+-- Updating the rating counters doesn't change the movie's version, and
+-- isn't a revision of the movie, so updates are only recorded when the
+-- version changes.
+DROP TRIGGER IF EXISTS movies_record_revision ON movies;
+
+CREATE TRIGGER movies_record_revision
+AFTER INSERT OR DELETE ON movies
+FOR EACH ROW EXECUTE FUNCTION record_movie_revision();
+
+CREATE TRIGGER movies_record_revision_update
+AFTER UPDATE ON movies
+FOR EACH ROW WHEN (OLD.version IS DISTINCT FROM NEW.version)
+EXECUTE FUNCTION record_movie_revision();
+
+UPDATE movies
+SET rating_count = r.count, rating_sum = r.sum
+FROM (
+    SELECT movie_id, count(*) AS count, sum(rating) AS sum
+    FROM reviews
+    GROUP BY movie_id
+) r
+WHERE r.movie_id = movies.id;
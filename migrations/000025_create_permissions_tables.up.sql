@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS permissions (
+    id bigserial PRIMARY KEY,
+    code text NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS users_permissions (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (user_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS roles_permissions (
+    role text NOT NULL REFERENCES roles ON DELETE CASCADE,
+    permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (role, permission_id)
+);
+
+INSERT INTO permissions (code)
+VALUES ('movies:read'), ('movies:write')
+ON CONFLICT DO NOTHING;
+
+-- Editors and admins could write movies before through their role.
+INSERT INTO roles_permissions (role, permission_id)
+SELECT roles.name, permissions.id
+FROM roles, permissions
+WHERE roles.name IN ('editor', 'admin') AND permissions.code = 'movies:write'
+ON CONFLICT DO NOTHING;
+
+-- Every user could read the movies before.
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT users.id, permissions.id
+FROM users, permissions
+WHERE permissions.code = 'movies:read'
+ON CONFLICT DO NOTHING;
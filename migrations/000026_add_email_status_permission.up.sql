@@ -0,0 +1,10 @@
+INSERT INTO permissions (code)
+VALUES ('users:read-email-status')
+ON CONFLICT DO NOTHING;
+
+-- Admins could read email statuses before through their role.
+INSERT INTO roles_permissions (role, permission_id)
+SELECT 'admin', permissions.id
+FROM permissions
+WHERE permissions.code = 'users:read-email-status'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,113 @@
+// Package plugin is a build-time extension point for forks and embedders of
+// the API. A plugin registers itself from an init function, typically in a
+// package of its own module, and is enabled by blank-importing that package
+// into the program which runs the server, whether that is a new file in
+// cmd/api or an embedder's own main package:
+//
+//	package main
+//
+//	import _ "example.com/greenlight-extras/plugin"
+//
+// Only this package's types cross the boundary, so plugins don't depend on
+// the API's internal packages.
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// User is the user a request was authenticated as.
+type User struct {
+	ID        int64
+	Name      string
+	Email     string
+	Activated bool
+}
+
+// Querier is the subset of methods shared by *sql.DB and *sql.Tx which the
+// application's models run their queries through.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Host gives plugins access to the application's shared services and HTTP
+// helpers, so their handlers behave consistently with the built-in ones.
+type Host interface {
+	// DB returns the primary database connection pool.
+	DB() *sql.DB
+
+	LogInfo(message string, properties map[string]string)
+	LogError(err error, properties map[string]string)
+
+	// User returns the user the request was authenticated as, and false for
+	// unauthenticated requests.
+	User(r *http.Request) (User, bool)
+	RequireActivatedUser(next http.HandlerFunc) http.HandlerFunc
+
+	ReadJSON(w http.ResponseWriter, r *http.Request, dst any) error
+	WriteJSON(w http.ResponseWriter, status int, data map[string]any, headers http.Header) error
+	ErrorResponse(w http.ResponseWriter, r *http.Request, status int, message any)
+	ServerErrorResponse(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// Route is an additional endpoint. Path uses the router's syntax, such as
+// "/v1/extras/:id", and must not conflict with the built-in routes.
+type Route struct {
+	Method  string
+	Path    string
+	Handler http.Handler
+}
+
+// Plugin describes an extension. Every field other than Name is optional.
+type Plugin struct {
+	Name string
+
+	// Routes returns the plugin's additional endpoints.
+	Routes func(host Host) []Route
+
+	// Middleware returns middleware which wraps every route. It runs after
+	// authentication, so host.User can be called from it.
+	Middleware func(host Host) []func(http.Handler) http.Handler
+
+	// WrapQuerier can wrap the querier the application's models use, for
+	// example to log or time every query. It is applied at start-up, and to
+	// the transactions the models begin. A wrapper of a connection pool
+	// should pass BeginTx through to it as well, since the movie listing's
+	// statement timeout needs a transaction and is skipped without one.
+	WrapQuerier func(q Querier) Querier
+}
+
+var (
+	mu      sync.Mutex
+	plugins []Plugin
+	names   = make(map[string]bool)
+)
+
+// Register adds a plugin to the registry. It panics if a plugin with the
+// same name has already been registered, and is intended to be called from
+// an init function.
+func Register(p Plugin) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if names[p.Name] {
+		panic(fmt.Sprintf("plugin: Register called twice for plugin %q", p.Name))
+	}
+
+	names[p.Name] = true
+	plugins = append(plugins, p)
+}
+
+// All returns the registered plugins in registration order.
+func All() []Plugin {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return append([]Plugin(nil), plugins...)
+}
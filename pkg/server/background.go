@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// workers runs the application's background goroutines under a single
+// errgroup whose context is tied to the server lifecycle. The context is
+// cancelled when the server shuts down, or when a critical worker fails, in
+// which case Run notices and shuts the whole server down in a controlled
+// way instead of carrying on without the worker.
+type workers struct {
+	group *errgroup.Group
+	ctx   context.Context
+	stop  context.CancelFunc
+}
+
+func newWorkers() *workers {
+	ctx, stop := context.WithCancel(context.Background())
+	group, ctx := errgroup.WithContext(ctx)
+
+	return &workers{
+		group: group,
+		ctx:   ctx,
+		stop:  stop,
+	}
+}
+
+// done returns a channel which is closed once the workers' context is
+// cancelled.
+func (w *workers) done() <-chan struct{} {
+	return w.ctx.Done()
+}
+
+// err returns the error of the critical worker which cancelled the workers'
+// context, or nil.
+func (w *workers) err() error {
+	err := context.Cause(w.ctx)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// shutdown cancels the workers' context and waits for them to return.
+func (w *workers) shutdown(ctx context.Context) error {
+	w.stop()
+
+	done := make(chan struct{})
+
+	go func() {
+		w.group.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// background runs fn in a goroutine under the application's errgroup. fn
+// should return when its context is cancelled. Panics are recovered and
+// treated as errors. Errors are logged; if the worker is critical, the
+// error also cancels the other workers and triggers a shutdown.
+func (app *application) background(name string, critical bool, fn func(ctx context.Context) error) {
+	app.workers.group.Go(func() (err error) {
+		defer func() {
+			if pv := recover(); pv != nil {
+				err = fmt.Errorf("panic: %v", pv)
+			}
+
+			if err == nil || errors.Is(err, context.Canceled) {
+				err = nil
+				return
+			}
+
+			app.logger.PrintError(err, map[string]string{"worker": name})
+
+			if !critical {
+				err = nil
+				return
+			}
+
+			err = fmt.Errorf("background worker %s: %w", name, err)
+		}()
+
+		return fn(app.workers.ctx)
+	})
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+)
+
+// cardMeta is one <meta> tag of a preview card. OpenGraph tags use the
+// property attribute, and Twitter card tags use name.
+type cardMeta struct {
+	Property string `json:"property,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Content  string `json:"content"`
+}
+
+var cardTemplate = template.Must(template.New("card").Parse(
+	`{{range .}}{{if .Property}}<meta property="{{.Property}}" content="{{.Content}}">{{else}}<meta name="{{.Name}}" content="{{.Content}}">{{end}}
+{{end}}`))
+
+// movieCard returns the OpenGraph and Twitter card tags describing a movie,
+// for link previews of its page on the website. The og:url tag is only
+// included when -site-url is set.
+func (app *application) movieCard(movie *data.Movie) []cardMeta {
+	details := []string{}
+	if movie.Year != 0 {
+		details = append(details, fmt.Sprint(movie.Year))
+	}
+	if movie.Runtime != 0 {
+		details = append(details, fmt.Sprintf("%d mins", movie.Runtime))
+	}
+	if len(movie.Genres) > 0 {
+		details = append(details, strings.Join(movie.Genres, ", "))
+	}
+	if movie.Certification != "" {
+		details = append(details, movie.Certification)
+	}
+	description := strings.Join(details, " · ")
+
+	meta := []cardMeta{
+		{Property: "og:type", Content: "video.movie"},
+		{Property: "og:site_name", Content: app.config.Site.Name},
+		{Property: "og:title", Content: movie.Title},
+		{Property: "og:description", Content: description},
+	}
+
+	if app.config.Site.URL != "" {
+		url := fmt.Sprintf("%s/movies/%d", strings.TrimSuffix(app.config.Site.URL, "/"), movie.ID)
+		meta = append(meta, cardMeta{Property: "og:url", Content: url})
+	}
+
+	if movie.Year != 0 {
+		meta = append(meta, cardMeta{Property: "video:release_date", Content: fmt.Sprint(movie.Year)})
+	}
+	if movie.Runtime != 0 {
+		meta = append(meta, cardMeta{Property: "video:duration", Content: fmt.Sprint(int(movie.Runtime) * 60)})
+	}
+	for _, genre := range movie.Genres {
+		meta = append(meta, cardMeta{Property: "video:tag", Content: genre})
+	}
+
+	meta = append(meta,
+		cardMeta{Name: "twitter:card", Content: "summary"},
+		cardMeta{Name: "twitter:title", Content: movie.Title},
+		cardMeta{Name: "twitter:description", Content: description},
+	)
+
+	return meta
+}
+
+// showMovieCardHandler returns a movie's link preview card, both as a list
+// of tags and pre-rendered as HTML to paste into a page's <head>, so that
+// the website doesn't need to know the card format.
+func (app *application) showMovieCardHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.getMovieCoalesced(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	meta := app.movieCard(movie)
+
+	var html strings.Builder
+
+	err = cardTemplate.Execute(&html, meta)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"card": envelope{"meta": meta, "html": html.String()}}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,23 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+)
+
+// getMovieCoalesced fetches a movie for read-only use. Concurrent calls for
+// the same movie ID share a single database query, so a burst of identical
+// requests doesn't translate into a burst of identical queries. The returned
+// movie may be shared between requests and must not be modified; handlers
+// that update the movie should call app.models.Movies.Get directly.
+func (app *application) getMovieCoalesced(id int64) (*data.Movie, error) {
+	v, err, _ := app.reads.Do(fmt.Sprintf("movie:%d", id), func() (any, error) {
+		return app.models.Movies.Get(id)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*data.Movie), nil
+}
@@ -0,0 +1,275 @@
+package server
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// compressibleType reports whether responses with the Content-Type are
+// worth compressing. Only textual formats are, since the API doesn't serve
+// anything which is already compressed.
+func compressibleType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "application/json" ||
+		strings.HasSuffix(mediaType, "+json") ||
+		strings.HasSuffix(mediaType, "+xml") ||
+		strings.HasPrefix(mediaType, "text/")
+}
+
+// negotiateEncoding picks the content coding to use from an Accept-Encoding
+// header, preferring gzip to deflate when the client accepts both equally.
+// A "*" applies to the codings the header doesn't list. It returns an empty
+// string if neither is acceptable.
+func negotiateEncoding(acceptEncoding string) string {
+	qvalues := make(map[string]float64)
+
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		qvalues[coding] = q
+	}
+
+	best, bestQ := "", 0.0
+
+	for _, coding := range []string{"gzip", "deflate"} {
+		q, ok := qvalues[coding]
+		if !ok {
+			q = qvalues["*"]
+		}
+
+		if q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+
+	return best
+}
+
+// compressors pools the gzip and deflate writers, which are expensive to
+// allocate, at the configured compression level.
+type compressors struct {
+	gzip    sync.Pool
+	deflate sync.Pool
+}
+
+func newCompressors(level int) *compressors {
+	c := &compressors{}
+
+	c.gzip.New = func() any {
+		w, _ := gzip.NewWriterLevel(io.Discard, level)
+		return w
+	}
+
+	c.deflate.New = func() any {
+		w, _ := zlib.NewWriterLevel(io.Discard, level)
+		return w
+	}
+
+	return c
+}
+
+// compress compresses response bodies with gzip or deflate, when the client
+// accepts one of them and the body is textual and at least
+// -compression-min-size bytes long. Smaller bodies aren't worth the CPU time
+// or the encoding overhead. Every response gets Vary: Accept-Encoding, since
+// whether it was compressed depends on the header.
+func (app *application) compress(next http.Handler) http.Handler {
+	pool := newCompressors(app.config.Compression.Level)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.config.Compression.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressResponseWriter{
+			ResponseWriter: w,
+			encoding:       encoding,
+			minSize:        app.config.Compression.MinSize,
+			pool:           pool,
+		}
+
+		next.ServeHTTP(cw, r)
+
+		// Not deferred, so that if the handler panics, whatever it buffered
+		// is dropped and recoverPanic can send a clean error response.
+		cw.close()
+	})
+}
+
+// compressResponseWriter buffers the start of the body until it knows
+// whether the body reaches the minimum size, and then either compresses
+// the rest on the fly or passes it through untouched.
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+	pool     *compressors
+
+	status  int
+	buf     []byte
+	decided bool
+	writer  io.Writer
+	closer  func() error
+}
+
+func (cw *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressResponseWriter) WriteHeader(status int) {
+	if cw.status == 0 && status >= http.StatusOK {
+		cw.status = status
+	}
+}
+
+func (cw *compressResponseWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) < cw.minSize {
+			return len(b), nil
+		}
+
+		err := cw.decide()
+		if err != nil {
+			return 0, err
+		}
+
+		return len(b), nil
+	}
+
+	return cw.writer.Write(b)
+}
+
+// Flush sends what has been written so far, which settles whether the body
+// is compressed if that hasn't been decided yet.
+func (cw *compressResponseWriter) Flush() {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+
+		if cw.decide() != nil {
+			return
+		}
+	}
+
+	if f, ok := cw.writer.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// decide starts the response, compressed if the buffered body is big
+// enough and of a compressible type, and writes out the buffer.
+func (cw *compressResponseWriter) decide() error {
+	cw.decided = true
+	cw.writer = cw.ResponseWriter
+
+	h := cw.Header()
+
+	compressible := len(cw.buf) >= cw.minSize &&
+		cw.status != http.StatusNoContent && cw.status != http.StatusNotModified &&
+		h.Get("Content-Encoding") == "" &&
+		compressibleType(h.Get("Content-Type"))
+
+	if compressible {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+
+		// The compressed bytes differ from the uncompressed ones, so the
+		// validator can only be a weak one.
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+
+		switch cw.encoding {
+		case "gzip":
+			gw := cw.pool.gzip.Get().(*gzip.Writer)
+			gw.Reset(cw.ResponseWriter)
+			cw.writer = gw
+			cw.closer = func() error {
+				err := gw.Close()
+				cw.pool.gzip.Put(gw)
+				return err
+			}
+		case "deflate":
+			// The deflate coding is the zlib format, not a raw deflate
+			// stream.
+			fw := cw.pool.deflate.Get().(*zlib.Writer)
+			fw.Reset(cw.ResponseWriter)
+			cw.writer = fw
+			cw.closer = func() error {
+				err := fw.Close()
+				cw.pool.deflate.Put(fw)
+				return err
+			}
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+
+	if len(buf) == 0 {
+		return nil
+	}
+
+	_, err := cw.writer.Write(buf)
+	return err
+}
+
+// close finishes the response once the handler has returned.
+func (cw *compressResponseWriter) close() error {
+	if !cw.decided {
+		if cw.status == 0 {
+			// Nothing was written, so leave it to net/http.
+			return nil
+		}
+
+		err := cw.decide()
+		if err != nil {
+			return err
+		}
+	}
+
+	if cw.closer != nil {
+		return cw.closer()
+	}
+
+	return nil
+}
@@ -0,0 +1,662 @@
+package server
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	ModeReadWrite = "read-write"
+	ModeReadOnly  = "read-only"
+)
+
+const (
+	MailerSMTP     = "smtp"
+	MailerSendGrid = "sendgrid"
+	MailerSES      = "ses"
+	MailerLog      = "log"
+)
+
+const (
+	StorageDisk = "disk"
+	StorageS3   = "s3"
+)
+
+const (
+	PasswordHasherBcrypt   = "bcrypt"
+	PasswordHasherArgon2id = "argon2id"
+)
+
+// Config holds the application settings. The cmd/api binary sets them from
+// command-line flags; programs embedding the API should start from
+// DefaultConfig and override the fields they need.
+type Config struct {
+	Port         int
+	Env          string
+	Mode         string
+	WarmUp       bool
+	EnvelopeMeta bool
+	Region       string
+	FastCrypto   bool
+	DB           struct {
+		DSN          string
+		ReadDSN      string
+		MaxOpenConns int
+		MaxIdleConns int
+		MaxIdleTime  string
+		Schema       string
+	}
+	Limiter struct {
+		RPS          float64
+		Burst        int
+		Enabled      bool
+		GraceWindows int
+		Backend      string
+	}
+	// Guest lets anonymous clients read the movie catalog, within a rate
+	// limit of their own which should be tighter than Limiter's.
+	Guest struct {
+		Enabled bool
+		RPS     float64
+		Burst   int
+	}
+	Limits struct {
+		MaxPageSize int
+		MaxOffset   int
+		ListTimeout time.Duration
+		MaxBodySize int64
+		// MaxPosterSize bounds the size of an uploaded poster image, which
+		// is read into memory before it is stored.
+		MaxPosterSize int64
+	}
+	Session struct {
+		Enabled bool
+	}
+	OTel struct {
+		Endpoint    string
+		Insecure    bool
+		ServiceName string
+	}
+	CORS struct {
+		TrustedOrigins []string
+	}
+	JWT struct {
+		Secret            string
+		Issuer            string
+		Audience          string
+		TTL               time.Duration
+		Leeway            time.Duration
+		RevocationBackend string
+
+		// Keys maps key IDs to PEM files of RSA or Ed25519 keys. When
+		// SigningKeyID names one of them, which must be a private key,
+		// tokens are signed with it, using RS256 or EdDSA, instead of with
+		// Secret. The other keys, and Secret if it is set, still check the
+		// tokens they signed, so that keys can be rotated without signing
+		// anyone out.
+		Keys         map[string]string
+		SigningKeyID string
+	}
+	Mailer struct {
+		Backend     string
+		Sender      string
+		TemplateDir string
+		Workers     int
+		QueueSize   int
+		MaxAttempts int
+		// RetryBackoff is the wait before the first retry of a failed
+		// send, which doubles up to RetryMaxBackoff.
+		RetryBackoff    time.Duration
+		RetryMaxBackoff time.Duration
+		SMTP            struct {
+			Host     string
+			Port     int
+			Username string
+			Password string
+		}
+		SendGrid struct {
+			APIKey string
+		}
+		SES struct {
+			Region string
+		}
+	}
+	Cache struct {
+		Enabled              bool
+		Backend              string
+		Size                 int
+		TTL                  time.Duration
+		StaleWhileRevalidate time.Duration
+	}
+	Compression struct {
+		Enabled bool
+		MinSize int
+		Level   int
+	}
+	// Redis is the server used for state shared between instances. It is
+	// only connected to when a feature is configured to use it.
+	Redis struct {
+		Addr     string
+		Password string
+		DB       int
+		// PoolSize is the number of idle connections kept open.
+		PoolSize int
+	}
+	Analytics struct {
+		Enabled       bool
+		SampleRate    float64
+		BufferSize    int
+		BatchSize     int
+		FlushInterval time.Duration
+	}
+	Status struct {
+		CheckInterval time.Duration
+		ProbeInterval time.Duration
+		ReadinessRise int
+		ReadinessFall int
+	}
+	Examples struct {
+		Dir string
+	}
+	// Feed configures the Atom and RSS feeds of movies. BaseURL is the
+	// public URL of the API, which the feeds link to, and WebSubHub is a
+	// hub to notify when the catalog changes.
+	Feed struct {
+		BaseURL   string
+		WebSubHub string
+	}
+	// Storage is where uploaded movie posters are kept. The disk backend
+	// writes them to Disk.Dir, which the API serves at /uploads unless
+	// Disk.URL points elsewhere, and the s3 backend puts them in S3.Bucket.
+	Storage struct {
+		Backend string
+		Disk    struct {
+			Dir string
+			URL string
+		}
+		S3 struct {
+			Bucket   string
+			Region   string
+			Endpoint string
+			URL      string
+		}
+	}
+	// Docs mounts Swagger UI at /docs, outside production.
+	Docs struct {
+		Enabled bool
+	}
+	Passwords struct {
+		BreachCheck bool
+		Hasher      string
+		BcryptCost  int
+		Argon2      struct {
+			Memory  uint // KiB
+			Time    uint
+			Threads uint
+		}
+	}
+	// Site describes the public website, for links in movie preview cards.
+	Site struct {
+		Name string
+		URL  string
+	}
+	Tokens struct {
+		CleanupInterval time.Duration
+	}
+	// TOTP limits the failed second factor attempts per user, on top of
+	// the per-IP rate limiter, which guesses spread over many addresses get
+	// around.
+	TOTP struct {
+		MaxFailures   int
+		FailureWindow time.Duration
+	}
+	IDs struct {
+		// Node must be unique among the instances sharing a database when
+		// any resource uses the snowflake strategy.
+		Node int64
+
+		// Strategies maps a resource in idResources to its ID strategy.
+		// Resources which aren't listed use serial IDs.
+		Strategies map[string]string
+	}
+	Retention struct {
+		Enabled  bool
+		DryRun   bool
+		Interval time.Duration
+		Rules    []RetentionRule
+	}
+}
+
+// RetentionRule deletes the rows of Table whose timestamp Column is older
+// than MaxAge.
+type RetentionRule struct {
+	Name   string
+	Table  string
+	Column string
+	MaxAge time.Duration
+}
+
+// ParseRetentionRule parses a rule written as name=table.column:max-age, such
+// as "expired_personal_access_tokens=personal_access_tokens.expiry:30d". The
+// maximum age is a Go duration, or a whole number of days followed by "d".
+func ParseRetentionRule(s string) (RetentionRule, error) {
+	name, rest, ok1 := strings.Cut(s, "=")
+	target, age, ok2 := strings.Cut(rest, ":")
+	table, column, ok3 := strings.Cut(target, ".")
+
+	if !ok1 || !ok2 || !ok3 || name == "" || table == "" || column == "" {
+		return RetentionRule{}, fmt.Errorf("invalid retention rule %q: must have the form name=table.column:max-age", s)
+	}
+
+	var maxAge time.Duration
+
+	if days, found := strings.CutSuffix(age, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return RetentionRule{}, fmt.Errorf("invalid retention rule %q: %w", s, err)
+		}
+		maxAge = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		maxAge, err = time.ParseDuration(age)
+		if err != nil {
+			return RetentionRule{}, fmt.Errorf("invalid retention rule %q: %w", s, err)
+		}
+	}
+
+	if maxAge <= 0 {
+		return RetentionRule{}, fmt.Errorf("invalid retention rule %q: max age must be positive", s)
+	}
+
+	return RetentionRule{Name: name, Table: table, Column: column, MaxAge: maxAge}, nil
+}
+
+// SetRetentionRule adds rule to the configuration, replacing any existing
+// rule with the same name.
+func (cfg *Config) SetRetentionRule(rule RetentionRule) {
+	for i := range cfg.Retention.Rules {
+		if cfg.Retention.Rules[i].Name == rule.Name {
+			cfg.Retention.Rules[i] = rule
+			return
+		}
+	}
+
+	cfg.Retention.Rules = append(cfg.Retention.Rules, rule)
+}
+
+// DefaultConfig returns the configuration used when no flags are given.
+// DB.DSN and either JWT.Secret or JWT.SigningKeyID have no defaults and
+// must always be set.
+func DefaultConfig() Config {
+	var cfg Config
+
+	cfg.Port = 4000
+	cfg.Env = "development"
+	cfg.Mode = ModeReadWrite
+
+	cfg.DB.MaxOpenConns = 25
+	cfg.DB.MaxIdleConns = 25
+	cfg.DB.MaxIdleTime = "15m"
+
+	cfg.Limiter.RPS = 2
+	cfg.Limiter.Burst = 4
+	cfg.Limiter.Enabled = true
+	cfg.Limiter.Backend = LimiterBackendMemory
+
+	cfg.Guest.RPS = 0.5
+	cfg.Guest.Burst = 2
+
+	cfg.Limits.MaxPageSize = data.DefaultMaxPageSize
+	cfg.Limits.MaxOffset = data.DefaultMaxOffset
+	cfg.Limits.ListTimeout = 2 * time.Second
+	cfg.Limits.MaxBodySize = 1_048_576
+	cfg.Limits.MaxPosterSize = 5 * 1_048_576
+
+	cfg.JWT.Issuer = "greenlight.alexedwards.net"
+	cfg.JWT.Audience = "greenlight.alexedwards.net"
+	cfg.JWT.TTL = 24 * time.Hour
+	cfg.JWT.Leeway = 30 * time.Second
+	cfg.JWT.RevocationBackend = RevocationBackendMemory
+
+	cfg.OTel.ServiceName = "greenlight"
+
+	cfg.Compression.Enabled = true
+	cfg.Docs.Enabled = true
+	cfg.Compression.MinSize = 1024
+	cfg.Compression.Level = gzip.DefaultCompression
+
+	cfg.Cache.Backend = CacheBackendMemory
+	cfg.Cache.Size = 1000
+	cfg.Cache.TTL = 10 * time.Second
+	cfg.Cache.StaleWhileRevalidate = time.Minute
+
+	cfg.Redis.PoolSize = 10
+
+	cfg.Analytics.Enabled = true
+	cfg.Analytics.SampleRate = 1
+	cfg.Analytics.BufferSize = 10000
+	cfg.Analytics.BatchSize = 500
+	cfg.Analytics.FlushInterval = 5 * time.Second
+
+	cfg.Status.CheckInterval = time.Minute
+	cfg.Status.ProbeInterval = 5 * time.Second
+	cfg.Status.ReadinessRise = 2
+	cfg.Status.ReadinessFall = 3
+
+	// The argon2id defaults are the OWASP minimum recommendation.
+	cfg.Passwords.Hasher = PasswordHasherBcrypt
+	cfg.Passwords.BcryptCost = 12
+	cfg.Passwords.Argon2.Memory = 19 * 1024
+	cfg.Passwords.Argon2.Time = 2
+	cfg.Passwords.Argon2.Threads = 1
+
+	cfg.Site.Name = "Greenlight"
+
+	cfg.Tokens.CleanupInterval = time.Hour
+
+	cfg.TOTP.MaxFailures = 5
+	cfg.TOTP.FailureWindow = 15 * time.Minute
+
+	cfg.Retention.Enabled = true
+	cfg.Retention.Interval = time.Hour
+	cfg.Retention.Rules = []RetentionRule{
+		{
+			Name:   "expired_personal_access_tokens",
+			Table:  "personal_access_tokens",
+			Column: "expiry",
+			MaxAge: 30 * 24 * time.Hour,
+		},
+		{
+			Name:   "old_health_checks",
+			Table:  "health_checks",
+			Column: "checked_at",
+			MaxAge: 90 * 24 * time.Hour,
+		},
+	}
+
+	cfg.Mailer.Backend = MailerSMTP
+	cfg.Mailer.Sender = "Greenlight <no-reply@greenlight.alexedwards.net>"
+	cfg.Mailer.Workers = 4
+	cfg.Mailer.QueueSize = 100
+	cfg.Mailer.MaxAttempts = 3
+	cfg.Mailer.RetryBackoff = time.Second
+	cfg.Mailer.RetryMaxBackoff = 30 * time.Second
+	cfg.Mailer.SMTP.Host = "sandbox.smtp.mailtrap.io"
+	cfg.Mailer.SMTP.Port = 25
+
+	cfg.Storage.Backend = StorageDisk
+	cfg.Storage.Disk.Dir = "./uploads"
+	cfg.Storage.Disk.URL = uploadsPath
+
+	return cfg
+}
+
+// idResources are the resources whose ID strategy can be configured.
+var idResources = []string{"movies", "users"}
+
+// ParseJWTKey parses a kid=path pair, such as 2024-06=/etc/greenlight/jwt.pem.
+func ParseJWTKey(s string) (kid, path string, err error) {
+	kid, path, ok := strings.Cut(s, "=")
+	if !ok || kid == "" || path == "" {
+		return "", "", fmt.Errorf("invalid JWT key %q: must have the form kid=path", s)
+	}
+
+	return kid, path, nil
+}
+
+// ParseIDStrategy parses a resource=strategy pair, such as
+// movies=snowflake.
+func ParseIDStrategy(s string) (resource, strategy string, err error) {
+	resource, strategy, ok := strings.Cut(s, "=")
+	if !ok || resource == "" || strategy == "" {
+		return "", "", fmt.Errorf("invalid ID strategy %q: must have the form resource=strategy", s)
+	}
+
+	return resource, strategy, nil
+}
+
+// idGenerators returns the ID generator for each resource which doesn't use
+// serial IDs. Resources using the snowflake strategy share one generator.
+func (cfg Config) idGenerators() (map[string]data.IDGenerator, error) {
+	generators := make(map[string]data.IDGenerator)
+	shared := make(map[string]data.IDGenerator)
+
+	for resource, strategy := range cfg.IDs.Strategies {
+		if !slices.Contains(idResources, resource) {
+			return nil, fmt.Errorf("ID strategies can't be set for %q, only for %s", resource, strings.Join(idResources, ", "))
+		}
+
+		g, ok := shared[strategy]
+		if !ok {
+			var err error
+			g, err = data.NewIDGenerator(strategy, cfg.IDs.Node)
+			if err != nil {
+				return nil, err
+			}
+			shared[strategy] = g
+		}
+
+		if g != nil {
+			generators[resource] = g
+		}
+	}
+
+	return generators, nil
+}
+
+// maxJWTLeeway caps the configurable clock skew tolerance, since a generous
+// leeway extends the life of every token.
+const maxJWTLeeway = 5 * time.Minute
+
+// fastCryptoMaxJWTTTL caps the JWT lifetime in fast crypto mode, so that
+// test suites can exercise token expiry without waiting a day.
+const fastCryptoMaxJWTTTL = 5 * time.Minute
+
+// schemaNameRX matches the schema names accepted for DB.Schema: unquoted
+// Postgres identifiers, which are safe to put in a search_path as they are.
+var schemaNameRX = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+
+func (cfg Config) validate() error {
+	if cfg.Mode != ModeReadWrite && cfg.Mode != ModeReadOnly {
+		return fmt.Errorf("invalid mode %q", cfg.Mode)
+	}
+
+	if cfg.DB.Schema != "" && !schemaNameRX.MatchString(cfg.DB.Schema) {
+		return fmt.Errorf("invalid database schema %q: use lowercase letters, digits and underscores", cfg.DB.Schema)
+	}
+
+	if cfg.FastCrypto && cfg.Env == "production" {
+		return errors.New("fast crypto mode must not be used in production")
+	}
+
+	if cfg.JWT.Leeway < 0 || cfg.JWT.Leeway > maxJWTLeeway {
+		return fmt.Errorf("the JWT leeway must be between 0 and %s", maxJWTLeeway)
+	}
+
+	if cfg.JWT.SigningKeyID == "" && cfg.JWT.Secret == "" {
+		return errors.New("either a JWT secret or a JWT signing key is required")
+	}
+
+	if _, ok := cfg.JWT.Keys[cfg.JWT.SigningKeyID]; cfg.JWT.SigningKeyID != "" && !ok {
+		return fmt.Errorf("the JWT signing key %q is not one of the JWT keys", cfg.JWT.SigningKeyID)
+	}
+
+	for name, value := range map[string]string{"feed base URL": cfg.Feed.BaseURL, "WebSub hub": cfg.Feed.WebSubHub} {
+		if value == "" {
+			continue
+		}
+
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid %s %q: use an absolute http or https URL", name, value)
+		}
+	}
+
+	if cfg.Feed.WebSubHub != "" && cfg.Feed.BaseURL == "" {
+		return errors.New("a WebSub hub requires a feed base URL")
+	}
+
+	if cfg.Examples.Dir != "" && cfg.Env == "production" {
+		return errors.New("example recording must not be used in production")
+	}
+
+	if cfg.Redis.PoolSize < 1 {
+		return errors.New("the redis pool size must be positive")
+	}
+
+	switch cfg.Cache.Backend {
+	case CacheBackendMemory:
+	case CacheBackendRedis:
+		if cfg.Redis.Addr == "" {
+			return errors.New("the redis cache backend requires -redis-addr")
+		}
+	default:
+		return fmt.Errorf("invalid cache backend %q", cfg.Cache.Backend)
+	}
+
+	if cfg.Compression.Level < gzip.HuffmanOnly || cfg.Compression.Level > gzip.BestCompression {
+		return fmt.Errorf("the compression level must be between %d and %d", gzip.HuffmanOnly, gzip.BestCompression)
+	}
+
+	switch cfg.Limiter.Backend {
+	case LimiterBackendMemory:
+	case LimiterBackendRedis:
+		if cfg.Redis.Addr == "" {
+			return errors.New("the redis rate limiter backend requires -redis-addr")
+		}
+	default:
+		return fmt.Errorf("invalid rate limiter backend %q", cfg.Limiter.Backend)
+	}
+
+	switch cfg.JWT.RevocationBackend {
+	case RevocationBackendMemory:
+	case RevocationBackendRedis:
+		if cfg.Redis.Addr == "" {
+			return errors.New("the redis token revocation backend requires -redis-addr")
+		}
+	default:
+		return fmt.Errorf("invalid token revocation backend %q", cfg.JWT.RevocationBackend)
+	}
+
+	if cfg.Analytics.Enabled {
+		if cfg.Analytics.SampleRate < 0 || cfg.Analytics.SampleRate > 1 {
+			return errors.New("the analytics sample rate must be between 0 and 1")
+		}
+		if cfg.Analytics.BatchSize < 1 || cfg.Analytics.FlushInterval <= 0 {
+			return errors.New("the analytics batch size and flush interval must be positive")
+		}
+	}
+
+	if cfg.Limits.MaxBodySize < 1 {
+		return errors.New("the maximum request body size must be positive")
+	}
+
+	if cfg.Limits.MaxPosterSize < 1 {
+		return errors.New("the maximum poster size must be positive")
+	}
+
+	// PostgreSQL's statement_timeout is in whole milliseconds, and 0
+	// disables it, so a shorter list timeout wouldn't mean what it says.
+	if cfg.Limits.ListTimeout < time.Millisecond {
+		return errors.New("the list timeout must be at least 1ms")
+	}
+
+	if cfg.Limiter.GraceWindows < 0 {
+		return errors.New("the rate limiter grace windows must not be negative")
+	}
+
+	if cfg.Guest.Enabled && (cfg.Guest.RPS <= 0 || cfg.Guest.Burst < 1) {
+		return errors.New("the guest rate limiter rps and burst must be positive")
+	}
+
+	if cfg.Status.CheckInterval <= 0 {
+		return errors.New("the status check interval must be positive")
+	}
+
+	if cfg.Status.ProbeInterval <= 0 {
+		return errors.New("the readiness probe interval must be positive")
+	}
+
+	if cfg.Status.ReadinessRise < 1 || cfg.Status.ReadinessFall < 1 {
+		return errors.New("the readiness rise and fall thresholds must be at least 1")
+	}
+
+	switch cfg.Passwords.Hasher {
+	case PasswordHasherBcrypt:
+		if cfg.Passwords.BcryptCost < bcrypt.MinCost || cfg.Passwords.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("the bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case PasswordHasherArgon2id:
+		a := cfg.Passwords.Argon2
+		if a.Memory < 8*a.Threads || a.Memory > math.MaxUint32 || a.Time < 1 || a.Time > math.MaxUint32 || a.Threads < 1 || a.Threads > math.MaxUint8 {
+			return errors.New("invalid argon2id parameters: time and threads (at most 255) must be at least 1, and memory at least 8 KiB per thread")
+		}
+	default:
+		return fmt.Errorf("invalid password hasher %q", cfg.Passwords.Hasher)
+	}
+
+	if _, err := cfg.idGenerators(); err != nil {
+		return err
+	}
+
+	if cfg.Tokens.CleanupInterval < 0 {
+		return errors.New("the token cleanup interval must not be negative")
+	}
+
+	if cfg.TOTP.MaxFailures < 1 || cfg.TOTP.FailureWindow <= 0 {
+		return errors.New("the TOTP maximum failures and failure window must be positive")
+	}
+
+	if cfg.Retention.Enabled && cfg.Retention.Interval <= 0 {
+		return errors.New("the retention interval must be positive")
+	}
+
+	if cfg.Mailer.MaxAttempts < 1 {
+		return errors.New("the mailer must make at least 1 attempt")
+	}
+
+	if cfg.Mailer.RetryBackoff <= 0 || cfg.Mailer.RetryMaxBackoff < cfg.Mailer.RetryBackoff {
+		return errors.New("the mailer retry backoff must be positive, and no more than the maximum backoff")
+	}
+
+	switch cfg.Mailer.Backend {
+	case MailerSMTP, MailerLog:
+	case MailerSendGrid:
+		if cfg.Mailer.SendGrid.APIKey == "" {
+			return errors.New("the sendgrid mailer backend requires an API key")
+		}
+	case MailerSES:
+		if cfg.Mailer.SES.Region == "" {
+			return errors.New("the ses mailer backend requires a region")
+		}
+	default:
+		return fmt.Errorf("invalid mailer backend %q", cfg.Mailer.Backend)
+	}
+
+	switch cfg.Storage.Backend {
+	case StorageDisk:
+		if cfg.Storage.Disk.Dir == "" {
+			return errors.New("the disk storage backend requires a directory")
+		}
+	case StorageS3:
+		if cfg.Storage.S3.Bucket == "" || cfg.Storage.S3.Region == "" {
+			return errors.New("the s3 storage backend requires a bucket and a region")
+		}
+	default:
+		return fmt.Errorf("invalid storage backend %q", cfg.Storage.Backend)
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+	"github.com/agung-learns/ebook-go-further/internal/jsonlog"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+// contextKey is the type of the keys this package stores in request
+// contexts. Because it is unexported, and its values aren't strings, no
+// other package can read or overwrite them; all access goes through the
+// helpers in this file.
+type contextKey int
+
+const (
+	userContextKey contextKey = iota
+	tokenContextKey
+	apiKeyContextKey
+	jwtContextKey
+	sessionContextKey
+	requestIDContextKey
+	loggerContextKey
+)
+
+// contextSetUser returns a new copy of the request with the provided User
+// struct added to the context.
+func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// contextGetUser retrieves the User struct from the request context. The only
+// time that we'll use this helper is when we logically expect there to be a
+// User struct value in the context, and if it doesn't exist it will firmly be
+// an 'unexpected' error, so it's OK to panic.
+func (app *application) contextGetUser(r *http.Request) *data.User {
+	user, ok := r.Context().Value(userContextKey).(*data.User)
+	if !ok {
+		panic("missing user value in request context")
+	}
+
+	return user
+}
+
+// contextSetPersonalAccessToken returns a new copy of the request with the
+// personal access token it was authenticated with added to the context.
+func (app *application) contextSetPersonalAccessToken(r *http.Request, token *data.PersonalAccessToken) *http.Request {
+	ctx := context.WithValue(r.Context(), tokenContextKey, token)
+	return r.WithContext(ctx)
+}
+
+// contextGetPersonalAccessToken returns the personal access token the
+// request was authenticated with, or nil if it wasn't authenticated with one.
+func (app *application) contextGetPersonalAccessToken(r *http.Request) *data.PersonalAccessToken {
+	token, _ := r.Context().Value(tokenContextKey).(*data.PersonalAccessToken)
+	return token
+}
+
+// contextSetSessionAuthenticated returns a new copy of the request marked as
+// authenticated with the session cookie rather than a bearer token.
+func (app *application) contextSetSessionAuthenticated(r *http.Request) *http.Request {
+	ctx := context.WithValue(r.Context(), sessionContextKey, true)
+	return r.WithContext(ctx)
+}
+
+// contextIsSessionAuthenticated reports whether the request was
+// authenticated with the session cookie.
+func (app *application) contextIsSessionAuthenticated(r *http.Request) bool {
+	authenticated, _ := r.Context().Value(sessionContextKey).(bool)
+	return authenticated
+}
+
+// contextSetAPIKey returns a new copy of the request with the API key it
+// was authenticated with added to the context.
+func (app *application) contextSetAPIKey(r *http.Request, key *data.APIKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+	return r.WithContext(ctx)
+}
+
+// contextGetAPIKey returns the API key the request was authenticated with,
+// or nil if it was authenticated some other way.
+func (app *application) contextGetAPIKey(r *http.Request) *data.APIKey {
+	key, _ := r.Context().Value(apiKeyContextKey).(*data.APIKey)
+	return key
+}
+
+// contextSetAuthenticationJWT returns a new copy of the request with the
+// claims of the authentication JWT it was authenticated with added to the
+// context.
+func (app *application) contextSetAuthenticationJWT(r *http.Request, claims *jwt.Claims) *http.Request {
+	ctx := context.WithValue(r.Context(), jwtContextKey, claims)
+	return r.WithContext(ctx)
+}
+
+// contextGetAuthenticationJWT returns the claims of the authentication JWT
+// the request was authenticated with, or nil if it wasn't authenticated with
+// one.
+func (app *application) contextGetAuthenticationJWT(r *http.Request) *jwt.Claims {
+	claims, _ := r.Context().Value(jwtContextKey).(*jwt.Claims)
+	return claims
+}
+
+// contextSetRequestID returns a new copy of the request with the request ID
+// added to the context.
+func (app *application) contextSetRequestID(r *http.Request, requestID string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, requestID)
+	return r.WithContext(ctx)
+}
+
+// contextGetRequestID returns the ID of the request, or an empty string if
+// it doesn't have one.
+func (app *application) contextGetRequestID(r *http.Request) string {
+	requestID, _ := r.Context().Value(requestIDContextKey).(string)
+	return requestID
+}
+
+// contextSetLogger returns a new copy of the request with a request-scoped
+// logger added to the context.
+func (app *application) contextSetLogger(r *http.Request, logger *jsonlog.Logger) *http.Request {
+	ctx := context.WithValue(r.Context(), loggerContextKey, logger)
+	return r.WithContext(ctx)
+}
+
+// contextGetLogger returns the request-scoped logger, or nil if the request
+// doesn't have one.
+func (app *application) contextGetLogger(r *http.Request) *jsonlog.Logger {
+	logger, _ := r.Context().Value(loggerContextKey).(*jsonlog.Logger)
+	return logger
+}
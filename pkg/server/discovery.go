@@ -0,0 +1,126 @@
+package server
+
+import (
+	"errors"
+	"hash/fnv"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// featuredCacheTTL is how long the featured movie is cached before it is
+// looked up again, so that edits to it show up within the day.
+const featuredCacheTTL = 10 * time.Minute
+
+// featuredCache holds the featured movie for the current day.
+type featuredCache struct {
+	mu      sync.Mutex
+	day     string
+	expires time.Time
+	movie   *data.Movie
+}
+
+// showMovieOrDiscoveryHandler serves GET /v1/movies/:id. The router doesn't
+// allow static segments alongside the :id wildcard, so the random and
+// featured endpoints are dispatched from here.
+func (app *application) showMovieOrDiscoveryHandler(w http.ResponseWriter, r *http.Request) {
+	switch httprouter.ParamsFromContext(r.Context()).ByName("id") {
+	case "random":
+		app.validateQuery(randomMovieQuery, app.randomMovieHandler)(w, r)
+	case "featured":
+		app.featuredMovieHandler(w, r)
+	default:
+		app.showMovieHandler(w, r)
+	}
+}
+
+func (app *application) randomMovieHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	genres := app.readCSV(qs, "genres", []string{})
+	decade := app.readInt(qs, "decade", 0, v)
+
+	if decade != 0 {
+		v.Check(decade%10 == 0, "decade", "must be the first year of a decade, such as 1990")
+		v.Check(decade >= 1880, "decade", "must be 1880 or later")
+		v.Check(decade <= time.Now().Year(), "decade", "must not be in the future")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := app.models.Movies.GetRandom(genres, decade)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "no-store")
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) featuredMovieHandler(w http.ResponseWriter, r *http.Request) {
+	day := time.Now().UTC().Format(time.DateOnly)
+
+	movie, err := app.featuredMovie(day)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"date": day, "movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// featuredMovie returns the featured movie for day, which is a date in UTC,
+// from the cache if possible.
+func (app *application) featuredMovie(day string) (*data.Movie, error) {
+	c := &app.featured
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.day == day && time.Now().Before(c.expires) {
+		return c.movie, nil
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(day))
+
+	movie, err := app.models.Movies.GetFeatured(h.Sum32())
+	if err != nil {
+		return nil, err
+	}
+
+	c.day = day
+	c.expires = time.Now().Add(featuredCacheTTL)
+	c.movie = movie
+
+	return movie, nil
+}
@@ -0,0 +1,341 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	emailCheckBatchSize     = 500
+	emailCheckConcurrency   = 8
+	emailCheckLookupTimeout = 5 * time.Second
+)
+
+// emailCheckJob records the progress of the latest email check. Only one
+// check runs at a time.
+type emailCheckJob struct {
+	mu    sync.Mutex
+	state emailCheckState
+}
+
+type emailCheckState struct {
+	Running       bool           `json:"running"`
+	StartedAt     *time.Time     `json:"started_at,omitempty"`
+	FinishedAt    *time.Time     `json:"finished_at,omitempty"`
+	Checked       int            `json:"checked"`
+	Undeliverable int            `json:"undeliverable"`
+	Results       map[string]int `json:"results,omitempty"`
+	Error         string         `json:"error,omitempty"`
+}
+
+// start marks a check as running, and reports false if one already is.
+func (j *emailCheckJob) start() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.state.Running {
+		return false
+	}
+
+	now := time.Now()
+	j.state = emailCheckState{
+		Running:   true,
+		StartedAt: &now,
+		Results:   make(map[string]int),
+	}
+
+	return true
+}
+
+func (j *emailCheckJob) record(checks []data.EmailCheck) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, check := range checks {
+		j.state.Checked++
+		j.state.Results[check.Status]++
+
+		if data.Undeliverable(check.Status) {
+			j.state.Undeliverable++
+		}
+	}
+}
+
+func (j *emailCheckJob) finish(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	j.state.Running = false
+	j.state.FinishedAt = &now
+
+	if err != nil {
+		j.state.Error = err.Error()
+	}
+}
+
+func (j *emailCheckJob) snapshot() emailCheckState {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	state := j.state
+	state.Results = make(map[string]int, len(j.state.Results))
+	for status, count := range j.state.Results {
+		state.Results[status] = count
+	}
+
+	return state
+}
+
+// checkEmails re-validates the email address of every user, in batches in
+// ID order, and records the status of each. It stops early if ctx is
+// cancelled.
+func (app *application) checkEmails(ctx context.Context) error {
+	checker := newEmailChecker(net.DefaultResolver)
+
+	var afterID int64
+
+	for {
+		checks, err := app.models.EmailChecks.GetBatch(afterID, emailCheckBatchSize)
+		if err != nil {
+			return err
+		}
+
+		if len(checks) == 0 {
+			return nil
+		}
+
+		err = checker.check(ctx, app.models.EmailChecks, checks)
+		if err != nil {
+			return err
+		}
+
+		err = app.models.EmailChecks.SaveBatch(checks)
+		if err != nil {
+			return err
+		}
+
+		app.emailChecks.record(checks)
+
+		afterID = checks[len(checks)-1].UserID
+	}
+}
+
+// emailChecker works out the status of email addresses. The mail server
+// lookup for each domain is only done once per checker, since many users
+// share a handful of domains.
+type emailChecker struct {
+	resolver *net.Resolver
+
+	mu      sync.Mutex
+	domains map[string]string
+}
+
+func newEmailChecker(resolver *net.Resolver) *emailChecker {
+	return &emailChecker{
+		resolver: resolver,
+		domains:  make(map[string]string),
+	}
+}
+
+// check sets the Status of each of the checks. Suppression takes
+// precedence over the domain's mail servers, so that a suppressed address
+// is reported as such even if its domain has since disappeared.
+func (c *emailChecker) check(ctx context.Context, model data.EmailCheckModel, checks []data.EmailCheck) error {
+	emails := make([]string, len(checks))
+	for i, check := range checks {
+		emails[i] = check.Email
+	}
+
+	suppressed, err := model.Suppressed(emails)
+	if err != nil {
+		return err
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(emailCheckConcurrency)
+
+	for i := range checks {
+		check := &checks[i]
+
+		switch {
+		case !validator.Matches(check.Email, validator.EmailRX):
+			check.Status = data.EmailInvalidSyntax
+		case suppressed[strings.ToLower(check.Email)]:
+			check.Status = data.EmailSuppressed
+		default:
+			g.Go(func() error {
+				check.Status = c.domainStatus(ctx, check.Email[strings.LastIndex(check.Email, "@")+1:])
+				return ctx.Err()
+			})
+		}
+	}
+
+	return g.Wait()
+}
+
+// domainStatus reports whether the domain accepts mail. A domain without MX
+// records still does if it has an address, since senders fall back to
+// delivering to it directly.
+func (c *emailChecker) domainStatus(ctx context.Context, domain string) string {
+	domain = strings.ToLower(domain)
+
+	c.mu.Lock()
+	status, ok := c.domains[domain]
+	c.mu.Unlock()
+
+	if ok {
+		return status
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, emailCheckLookupTimeout)
+	defer cancel()
+
+	mxs, err := c.resolver.LookupMX(ctx, domain)
+	switch {
+	case err == nil && len(mxs) == 1 && mxs[0].Host == ".":
+		// A null MX record means the domain explicitly accepts no mail.
+		status = data.EmailNoMailServer
+	case err == nil && len(mxs) > 0:
+		status = data.EmailDeliverable
+	case err != nil && !isNotFound(err):
+		status = data.EmailUnknown
+	default:
+		_, err = c.resolver.LookupHost(ctx, domain)
+		switch {
+		case err == nil:
+			status = data.EmailDeliverable
+		case isNotFound(err):
+			status = data.EmailNoMailServer
+		default:
+			status = data.EmailUnknown
+		}
+	}
+
+	// Don't remember failed lookups, so that a later user with the same
+	// domain gets another try.
+	if status != data.EmailUnknown {
+		c.mu.Lock()
+		c.domains[domain] = status
+		c.mu.Unlock()
+	}
+
+	return status
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// startEmailCheckHandler starts an email check in the background. The
+// check runs until every user has been checked, or the server shuts down.
+func (app *application) startEmailCheckHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.emailChecks.start() {
+		app.errorResponse(w, r, http.StatusConflict, "an email check is already running")
+		return
+	}
+
+	// The response is the check as it starts, rather than however far the
+	// background check has got by the time it is written.
+	state := app.emailChecks.snapshot()
+
+	app.background("email check", false, func(ctx context.Context) error {
+		err := app.checkEmails(ctx)
+		app.emailChecks.finish(err)
+		return err
+	})
+
+	err := app.writeJSON(w, http.StatusAccepted, envelope{"email_check": state}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showEmailCheckHandler reports on the latest email check, along with how
+// many users have each email status.
+func (app *application) showEmailCheckHandler(w http.ResponseWriter, r *http.Request) {
+	counts, err := app.models.EmailChecks.CountByStatus()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"email_check": app.emailChecks.snapshot(), "statuses": counts}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createEmailSuppressionHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email  string `json:"email"`
+		Reason string `json:"reason"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	suppression := &data.EmailSuppression{
+		Email:  input.Email,
+		Reason: input.Reason,
+	}
+
+	v := validator.New()
+
+	if data.ValidateEmailSuppression(v, suppression); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.EmailChecks.InsertSuppression(suppression)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateSuppression):
+			v.AddError("email", "is already suppressed")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"suppression": suppression}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteEmailSuppressionHandler(w http.ResponseWriter, r *http.Request) {
+	email := httprouter.ParamsFromContext(r.Context()).ByName("email")
+
+	err := app.models.EmailChecks.DeleteSuppression(email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "suppression successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+)
+
+// maxEventBatch is the maximum number of events in one request.
+const maxEventBatch = 100
+
+// analyticsBuffer queues accepted analytics events until the exporter writes
+// them to the analytics store in batches. When the buffer is full, new
+// events are dropped rather than slowing down the request.
+type analyticsBuffer struct {
+	events chan data.AnalyticsEvent
+
+	received      atomic.Int64
+	sampledOut    atomic.Int64
+	dropped       atomic.Int64
+	exported      atomic.Int64
+	exportFailed  atomic.Int64
+	exportBatches atomic.Int64
+}
+
+func newAnalyticsBuffer(size int) *analyticsBuffer {
+	return &analyticsBuffer{events: make(chan data.AnalyticsEvent, size)}
+}
+
+func (b *analyticsBuffer) add(event data.AnalyticsEvent) bool {
+	select {
+	case b.events <- event:
+		return true
+	default:
+		b.dropped.Add(1)
+		return false
+	}
+}
+
+func (b *analyticsBuffer) snapshot() any {
+	return map[string]int64{
+		"received":       b.received.Load(),
+		"sampled_out":    b.sampledOut.Load(),
+		"dropped":        b.dropped.Load(),
+		"buffered":       int64(len(b.events)),
+		"exported":       b.exported.Load(),
+		"export_failed":  b.exportFailed.Load(),
+		"export_batches": b.exportBatches.Load(),
+	}
+}
+
+func (app *application) createEventsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Events []data.AnalyticsEvent `json:"events"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(len(input.Events) >= 1, "events", "must contain at least 1 event")
+	v.Check(len(input.Events) <= maxEventBatch, "events", fmt.Sprintf("must not contain more than %d events", maxEventBatch))
+
+	for i := range input.Events {
+		data.ValidateAnalyticsEvent(v, fmt.Sprintf("events[%d]", i), &input.Events[i])
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	app.analytics.received.Add(int64(len(input.Events)))
+
+	accepted := 0
+
+	for _, event := range input.Events {
+		if rand.Float64() >= app.config.Analytics.SampleRate {
+			app.analytics.sampledOut.Add(1)
+			continue
+		}
+
+		if app.analytics.add(event) {
+			accepted++
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"received": len(input.Events), "accepted": accepted}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// analyticsExporter writes buffered events to the analytics store whenever
+// a full batch is ready, or the flush interval has passed. When ctx is
+// cancelled it exports whatever is still buffered before returning.
+func (app *application) analyticsExporter(ctx context.Context) error {
+	ticker := time.NewTicker(app.config.Analytics.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]data.AnalyticsEvent, 0, app.config.Analytics.BatchSize)
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		err := app.models.AnalyticsEvents.InsertBatch(batch)
+		if err != nil {
+			app.analytics.exportFailed.Add(int64(len(batch)))
+			app.logger.PrintError(err, map[string]string{"analytics_events": strconv.Itoa(len(batch))})
+		} else {
+			app.analytics.exported.Add(int64(len(batch)))
+			app.analytics.exportBatches.Add(1)
+		}
+
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case event := <-app.analytics.events:
+			batch = append(batch, event)
+			if len(batch) >= app.config.Analytics.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-ctx.Done():
+			for {
+				select {
+				case event := <-app.analytics.events:
+					batch = append(batch, event)
+				default:
+					flush()
+					return nil
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// redactedExampleFields are the JSON fields whose values are replaced in
+// recorded examples, because they hold credentials or personal data.
+var redactedExampleFields = map[string]string{
+	"anonymous_id":     "<anonymous_id>",
+	"api_key":          "<api_key>",
+	"csrf_token":       "<csrf_token>",
+	"current_password": "<password>",
+	"email":            "user@example.com",
+	"key":              "<key>",
+	"password":         "<password>",
+	"provisioning_uri": "<provisioning_uri>",
+	"recovery_code":    "<recovery_code>",
+	"recovery_codes":   "<recovery_codes>",
+	"request_id":       "<request_id>",
+	"secret":           "<secret>",
+	"token":            "<token>",
+	"totp_code":        "<totp_code>",
+}
+
+// example is a recorded request and response, stored as a JSON fixture for
+// the API documentation.
+type example struct {
+	Method   string          `json:"method"`
+	Route    string          `json:"route"`
+	Status   int             `json:"status"`
+	Request  exampleRequest  `json:"request"`
+	Response exampleResponse `json:"response"`
+}
+
+type exampleRequest struct {
+	Path          string `json:"path"`
+	Query         string `json:"query,omitempty"`
+	Authorization string `json:"authorization,omitempty"`
+	Body          any    `json:"body,omitempty"`
+}
+
+type exampleResponse struct {
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    any               `json:"body,omitempty"`
+}
+
+// exampleResponseWriter passes the response through while keeping a copy of
+// its status and body.
+type exampleResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (ew *exampleResponseWriter) WriteHeader(status int) {
+	ew.status = status
+	ew.ResponseWriter.WriteHeader(status)
+}
+
+func (ew *exampleResponseWriter) Write(b []byte) (int, error) {
+	ew.body.Write(b)
+	return ew.ResponseWriter.Write(b)
+}
+
+func (ew *exampleResponseWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
+
+// recordExamples saves an anonymized copy of every JSON request and
+// response to the -examples-dir directory, as one file per route and
+// status code. Each file is overwritten by the latest request, so the
+// examples in the documentation always match what the handlers return.
+// It is meant for development, and refused in production.
+func (app *application) recordExamples(router *httprouter.Router, next http.Handler) http.Handler {
+	var mu sync.Mutex
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handle, params, _ := router.Lookup(r.Method, r.URL.Path)
+		if handle == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		requestBody, err := io.ReadAll(r.Body)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(requestBody))
+
+		ew := &exampleResponseWriter{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(ew, r)
+
+		if !strings.HasPrefix(ew.Header().Get("Content-Type"), "application/json") {
+			return
+		}
+
+		ex := example{
+			Method: r.Method,
+			Route:  exampleRoute(r.URL.Path, params),
+			Status: ew.status,
+			Request: exampleRequest{
+				Path:  r.URL.Path,
+				Query: r.URL.RawQuery,
+				Body:  anonymizeExampleJSON(requestBody),
+			},
+			Response: exampleResponse{
+				Headers: make(map[string]string),
+				Body:    anonymizeExampleJSON(ew.body.Bytes()),
+			},
+		}
+
+		if scheme, _, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok {
+			ex.Request.Authorization = scheme + " <credentials>"
+		}
+
+		for _, header := range []string{"Content-Type", "Location", "Link"} {
+			if value := ew.Header().Get(header); value != "" {
+				ex.Response.Headers[header] = value
+			}
+		}
+
+		// HTML escaping is turned off, so placeholders such as <token> stay
+		// readable in the files.
+		var js bytes.Buffer
+
+		enc := json.NewEncoder(&js)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "\t")
+
+		err = enc.Encode(ex)
+		if err != nil {
+			app.logError(r, err)
+			return
+		}
+
+		name := strings.NewReplacer("/", "_", ":", "").Replace(fmt.Sprintf("%s%s_%d.json", r.Method, ex.Route, ex.Status))
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		err = os.WriteFile(filepath.Join(app.config.Examples.Dir, name), js.Bytes(), 0o644)
+		if err != nil {
+			app.logError(r, err)
+		}
+	})
+}
+
+// exampleRoute turns a request path back into the route pattern it matched,
+// by replacing the values of its parameters with their names. Parameters
+// which aren't numeric IDs are left as they are, so that GET
+// /v1/movies/random and /v1/movies/featured, which are served by the
+// /v1/movies/:id route, are recorded as routes of their own.
+func exampleRoute(path string, params httprouter.Params) string {
+	segments := strings.Split(path, "/")
+
+	for _, param := range params {
+		if _, err := strconv.ParseInt(param.Value, 10, 64); err != nil {
+			continue
+		}
+
+		for i, segment := range segments {
+			if segment == param.Value {
+				segments[i] = ":" + param.Key
+				break
+			}
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// anonymizeExampleJSON decodes a JSON body and redacts its sensitive fields
+// at any depth. Bodies which are empty or aren't JSON return nil. The meta
+// object is dropped, because it changes with every request. The error of an
+// error response is kept as it is, since validation errors are keyed by the
+// very fields which are redacted elsewhere, such as "email".
+func anonymizeExampleJSON(body []byte) any {
+	var v any
+
+	if len(body) == 0 || json.Unmarshal(body, &v) != nil {
+		return nil
+	}
+
+	object, ok := v.(map[string]any)
+	if !ok {
+		return anonymizeExampleValue(v)
+	}
+
+	delete(object, "meta")
+
+	errorValue, hasError := object["error"]
+	delete(object, "error")
+
+	anonymizeExampleValue(object)
+
+	if hasError {
+		object["error"] = errorValue
+	}
+
+	return object
+}
+
+func anonymizeExampleValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if replacement, ok := redactedExampleFields[key]; ok {
+				if _, isObject := value.(map[string]any); !isObject {
+					v[key] = replacement
+					continue
+				}
+			}
+
+			v[key] = anonymizeExampleValue(value)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = anonymizeExampleValue(value)
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,353 @@
+package server
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+)
+
+// The movie feeds list the most recently added or updated movies, newest
+// first, for aggregators to syndicate. The query string filters the feed,
+// so that each filter combination is a feed URL of its own:
+//
+//	/v1/feeds/movies.atom?genres=drama,crime&language=en&limit=20
+var movieFeedQuery = querySpec{
+	{name: "genres", kind: queryCSV},
+	{name: "language", kind: queryString},
+	{name: "limit", kind: queryInt, def: "50", min: 1, max: 100},
+}
+
+const (
+	feedFormatAtom = "atom"
+	feedFormatRSS  = "rss"
+)
+
+// webSubMinInterval is the shortest time between two rounds of WebSub
+// pings, so that a burst of edits results in one notification.
+const webSubMinInterval = 10 * time.Second
+
+// feedBaseURL returns the URL the feed links are relative to: the
+// configured -feed-base-url, or otherwise the one the request was made to.
+func (app *application) feedBaseURL(r *http.Request) string {
+	if app.config.Feed.BaseURL != "" {
+		return strings.TrimSuffix(app.config.Feed.BaseURL, "/")
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return scheme + "://" + r.Host
+}
+
+// movieFeedHandler serves the movie feed in the given format. The WebSub
+// hub is only advertised on the unfiltered feed, since that is the only
+// topic the hub is told about.
+func (app *application) movieFeedHandler(format string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		qs := r.URL.Query()
+
+		genres := app.readCSV(qs, "genres", []string{})
+		language := app.readString(qs, "language", "")
+		limit := app.readInt(qs, "limit", 50, validator.New())
+
+		changes, err := app.models.Movies.GetRecentlyChanged(genres, language, limit)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		unfiltered := len(genres) == 0 && language == "" && limit == 50
+
+		// The unfiltered feed's URL is left without the default limit added
+		// by validateQuery, so that it matches the topic the hub knows.
+		base := app.feedBaseURL(r)
+		self := base + r.URL.Path
+		if !unfiltered {
+			self += "?" + r.URL.RawQuery
+		}
+
+		var hub string
+		if unfiltered {
+			hub = app.config.Feed.WebSubHub
+		}
+
+		var (
+			body        any
+			contentType string
+		)
+
+		switch format {
+		case feedFormatAtom:
+			body = newAtomFeed(base, self, hub, changes)
+			contentType = "application/atom+xml; charset=utf-8"
+		default:
+			body = newRSSFeed(base, self, hub, changes)
+			contentType = "application/rss+xml; charset=utf-8"
+		}
+
+		out, err := xml.MarshalIndent(body, "", "\t")
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		if hub != "" {
+			w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="hub"`, hub))
+			w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="self"`, self))
+		}
+
+		w.Write([]byte(xml.Header))
+		w.Write(out)
+		w.Write([]byte("\n"))
+	}
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  atomPerson  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Updated    string         `xml:"updated"`
+	Links      []atomLink     `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+	Summary    string         `xml:"summary"`
+}
+
+// newAtomFeed builds an Atom feed of the changes. The feed's ID is its own
+// URL, filters included, so that each filtered feed is distinct. An empty
+// feed is dated at the Unix epoch, since it has never been updated.
+func newAtomFeed(base, self, hub string, changes []*data.MovieChange) atomFeed {
+	feed := atomFeed{
+		Title:   "Greenlight: recently added and updated movies",
+		ID:      self,
+		Updated: time.Unix(0, 0).UTC().Format(time.RFC3339),
+		Author:  atomPerson{Name: "Greenlight"},
+		Links:   []atomLink{{Href: self, Rel: "self", Type: "application/atom+xml"}},
+	}
+
+	if hub != "" {
+		feed.Links = append(feed.Links, atomLink{Href: hub, Rel: "hub"})
+	}
+
+	if len(changes) > 0 {
+		feed.Updated = changes[0].UpdatedAt.UTC().Format(time.RFC3339)
+	}
+
+	for _, change := range changes {
+		link := fmt.Sprintf("%s/v1/movies/%d", base, change.Movie.ID)
+
+		entry := atomEntry{
+			Title:   feedTitle(change.Movie),
+			ID:      link,
+			Updated: change.UpdatedAt.UTC().Format(time.RFC3339),
+			Links:   []atomLink{{Href: link, Rel: "alternate", Type: "application/json"}},
+			Summary: feedSummary(change.Movie),
+		}
+
+		for _, genre := range change.Movie.Genres {
+			entry.Categories = append(entry.Categories, atomCategory{Term: genre})
+		}
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	return feed
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string     `xml:"title"`
+	Link          string     `xml:"link"`
+	Description   string     `xml:"description"`
+	LastBuildDate string     `xml:"lastBuildDate,omitempty"`
+	AtomLinks     []atomLink `xml:"atom:link"`
+	Items         []rssItem  `xml:"item"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+// newRSSFeed builds an RSS 2.0 feed of the changes. Each update to a movie
+// gets its own GUID, so that readers show it as a new item.
+func newRSSFeed(base, self, hub string, changes []*data.MovieChange) rssFeed {
+	feed := rssFeed{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:       "Greenlight: recently added and updated movies",
+			Link:        base + "/v1/movies",
+			Description: "The movies most recently added to or updated in the Greenlight catalog.",
+			AtomLinks:   []atomLink{{Href: self, Rel: "self", Type: "application/rss+xml"}},
+		},
+	}
+
+	if hub != "" {
+		feed.Channel.AtomLinks = append(feed.Channel.AtomLinks, atomLink{Href: hub, Rel: "hub"})
+	}
+
+	if len(changes) > 0 {
+		feed.Channel.LastBuildDate = changes[0].UpdatedAt.UTC().Format(time.RFC1123Z)
+	}
+
+	for _, change := range changes {
+		link := fmt.Sprintf("%s/v1/movies/%d", base, change.Movie.ID)
+
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       feedTitle(change.Movie),
+			Link:        link,
+			GUID:        rssGUID{Value: fmt.Sprintf("%s#v%d", link, change.Movie.Version)},
+			PubDate:     change.UpdatedAt.UTC().Format(time.RFC1123Z),
+			Categories:  change.Movie.Genres,
+			Description: feedSummary(change.Movie),
+		})
+	}
+
+	return feed
+}
+
+func feedTitle(movie *data.Movie) string {
+	if movie.Year == 0 {
+		return movie.Title
+	}
+
+	return fmt.Sprintf("%s (%d)", movie.Title, movie.Year)
+}
+
+// feedSummary describes a movie in one line, such as "102 mins, drama,
+// crime, PG-13, en".
+func feedSummary(movie *data.Movie) string {
+	var parts []string
+
+	if movie.Runtime != 0 {
+		parts = append(parts, fmt.Sprintf("%d mins", movie.Runtime))
+	}
+
+	parts = append(parts, movie.Genres...)
+
+	for _, part := range []string{movie.Certification, movie.Language} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// moviesChanged is called after every write to the catalog. It drops the
+// cached movie listings and feeds, and lets the WebSub hub know the feeds
+// have changed.
+func (app *application) moviesChanged() {
+	app.responseCache.invalidate("/v1/movies", "/v1/feeds/movies")
+
+	if app.webSubPending != nil {
+		select {
+		case app.webSubPending <- struct{}{}:
+		default:
+			// A ping is already pending, and will cover this change.
+		}
+	}
+}
+
+// webSubPublisher pings the WebSub hub about the unfiltered movie feeds
+// whenever the catalog changes, at most once every webSubMinInterval. A
+// failed ping is logged and not retried, since the next change pings again
+// and subscribers still poll as a fallback.
+func (app *application) webSubPublisher(ctx context.Context) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	base := strings.TrimSuffix(app.config.Feed.BaseURL, "/")
+	topics := []string{base + "/v1/feeds/movies.atom", base + "/v1/feeds/movies.rss"}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-app.webSubPending:
+		}
+
+		for _, topic := range topics {
+			err := publishToWebSubHub(ctx, client, app.config.Feed.WebSubHub, topic)
+			if err != nil {
+				app.logger.PrintError(err, map[string]string{"worker": "websub publisher", "topic": topic})
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(webSubMinInterval):
+		}
+	}
+}
+
+func publishToWebSubHub(ctx context.Context, client *http.Client, hub, topic string) error {
+	form := url.Values{"hub.mode": {"publish"}, "hub.url": {topic}}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hub, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("websub hub responded with %s", res.Status)
+	}
+
+	return nil
+}
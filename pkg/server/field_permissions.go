@@ -0,0 +1,231 @@
+package server
+
+import (
+	"net/http"
+	"reflect"
+	"slices"
+	"sync"
+)
+
+// Struct fields in responses can be restricted to requesters holding a
+// permission with a struct tag, such as:
+//
+//	EmailStatus string `json:"email_status,omitempty" permission:"users:read-email-status"`
+//
+// writeJSON zeroes restricted fields the requester doesn't hold the
+// permission for, wherever they appear in the envelope, so handlers don't
+// need to remember to. Restricted fields should be omitempty, so that they
+// are left out rather than sent as zero values.
+
+// grantedPermissions are the permissions of the requesting user. They are
+// only loaded when a response contains a restricted field, since most
+// don't.
+type grantedPermissions struct {
+	once        sync.Once
+	load        func() []string
+	permissions []string
+}
+
+// Has reports whether the permission is granted. A nil grantedPermissions
+// grants nothing.
+func (g *grantedPermissions) Has(permission string) bool {
+	if g == nil {
+		return false
+	}
+
+	g.once.Do(func() {
+		g.permissions = g.load()
+	})
+
+	return slices.Contains(g.permissions, permission)
+}
+
+// permissionsResponseWriter carries the requester's permissions through to
+// writeJSON.
+type permissionsResponseWriter struct {
+	http.ResponseWriter
+	permissions *grantedPermissions
+}
+
+func (pw *permissionsResponseWriter) Unwrap() http.ResponseWriter {
+	return pw.ResponseWriter
+}
+
+// permissionsFromWriter returns the permissions carried by w, looking
+// through any other wrapping response writers, or nil if there aren't any.
+func permissionsFromWriter(w http.ResponseWriter) *grantedPermissions {
+	for {
+		switch rw := w.(type) {
+		case *permissionsResponseWriter:
+			return rw.permissions
+		case *responseRecorder:
+			return rw.permissions
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+// fieldPermissions makes the requesting user's permissions available to
+// writeJSON. A failure to load them is logged, and treated as granting
+// nothing.
+func (app *application) fieldPermissions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		permissions := &grantedPermissions{
+			load: func() []string {
+				if user.IsAnonymous() {
+					return nil
+				}
+
+				permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+				if err != nil {
+					app.logError(r, err)
+					return nil
+				}
+
+				return permissions
+			},
+		}
+
+		next.ServeHTTP(&permissionsResponseWriter{ResponseWriter: w, permissions: permissions}, r)
+	})
+}
+
+// restrictedTypes caches whether each type can contain a restricted field.
+var restrictedTypes sync.Map
+
+// mayBeRestricted reports whether values of type t can contain a restricted
+// field. Interfaces might hold anything, so they have to be checked value by
+// value.
+func mayBeRestricted(t reflect.Type) bool {
+	if restricted, ok := restrictedTypes.Load(t); ok {
+		return restricted.(bool)
+	}
+
+	restricted := typeMayBeRestricted(t, make(map[reflect.Type]bool))
+	restrictedTypes.Store(t, restricted)
+
+	return restricted
+}
+
+// typeMayBeRestricted works out mayBeRestricted for t, treating the types
+// already being visited as unrestricted, so that recursive types terminate.
+func typeMayBeRestricted(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	if visiting[t] {
+		return false
+	}
+	visiting[t] = true
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return typeMayBeRestricted(t.Elem(), visiting)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			if field.Tag.Get("permission") != "" || typeMayBeRestricted(field.Type, visiting) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// redactFields returns v with the restricted fields the requester doesn't
+// have the permission for zeroed. Values which need redacting are copied,
+// so that v itself is left unchanged.
+func redactFields(v any, permissions *grantedPermissions) any {
+	if v == nil || !mayBeRestricted(reflect.TypeOf(v)) {
+		return v
+	}
+
+	return redactValue(reflect.ValueOf(v), permissions).Interface()
+}
+
+func redactValue(v reflect.Value, permissions *grantedPermissions) reflect.Value {
+	if !mayBeRestricted(v.Type()) {
+		return v
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+
+		redacted := reflect.New(v.Type()).Elem()
+		redacted.Set(redactValue(v.Elem(), permissions))
+		return redacted
+
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+
+		redacted := reflect.New(v.Type().Elem())
+		redacted.Elem().Set(redactValue(v.Elem(), permissions))
+		return redacted
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+
+		redacted := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			redacted.Index(i).Set(redactValue(v.Index(i), permissions))
+		}
+		return redacted
+
+	case reflect.Array:
+		redacted := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			redacted.Index(i).Set(redactValue(v.Index(i), permissions))
+		}
+		return redacted
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+
+		redacted := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			redacted.SetMapIndex(iter.Key(), redactValue(iter.Value(), permissions))
+		}
+		return redacted
+
+	case reflect.Struct:
+		redacted := reflect.New(v.Type()).Elem()
+		redacted.Set(v)
+
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			if permission := field.Tag.Get("permission"); permission != "" && !permissions.Has(permission) {
+				redacted.Field(i).SetZero()
+				continue
+			}
+
+			redacted.Field(i).Set(redactValue(v.Field(i), permissions))
+		}
+		return redacted
+	}
+
+	return v
+}
@@ -0,0 +1,480 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+	"github.com/agung-learns/ebook-go-further/internal/totp"
+)
+
+// The golden tests snapshot the JSON responses of the endpoints, so that a
+// change to a response's shape shows up as a failing test and a diff of the
+// golden file. After reviewing an intended change, regenerate the files
+// with:
+//
+//	go test ./pkg/server -run TestGolden -update
+//
+// The responses are normalized like the -examples-dir recordings, and IDs
+// and timestamps are replaced by placeholders, so that the files only
+// change when the output's shape does.
+var update = flag.Bool("update", false, "rewrite the golden files with the current responses")
+
+// goldenDSNEnv names the environment variable with the DSN of a migrated
+// database for the cases which need one. Those cases are skipped when it
+// isn't set. The database is emptied and loaded with the fixtures in
+// testdata/golden/fixtures.sql before each of them.
+const goldenDSNEnv = "GREENLIGHT_TEST_DB_DSN"
+
+// The fixture users, whose password is goldenPassword.
+const (
+	goldenAdmin    = 1
+	goldenViewer   = 2
+	goldenInactive = 3
+)
+
+// The secrets the fixtures were made with.
+const (
+	goldenPassword         = "pa55word-golden"
+	goldenActivationToken  = "GOLDENACTIVATE234567ABCDEF"
+	goldenEmailChangeToken = "GOLDENEMAILCHANGE234567ABC"
+	goldenResetToken       = "GOLDENPASSWORDRESET234567A"
+	goldenTOTPSecret       = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+)
+
+// goldenPoster is a multipart body with a poster, which is just enough of a
+// PNG for its content type to be detected.
+const goldenPoster = "--golden\r\n" +
+	"Content-Disposition: form-data; name=\"poster\"; filename=\"poster.png\"\r\n" +
+	"Content-Type: image/png\r\n" +
+	"\r\n" +
+	"\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\r\n" +
+	"--golden--\r\n"
+
+type goldenCase struct {
+	name   string
+	method string
+	path   string
+	header map[string]string
+
+	// body can contain the placeholders {{now}}, {{next_month}} and
+	// {{totp_code}}, which are replaced when the request is made.
+	body string
+
+	// user is the ID of the fixture user the request is authenticated as,
+	// or 0 for an anonymous request.
+	user int64
+
+	// needsDB marks the cases whose response depends on the database.
+	needsDB bool
+
+	// setup is SQL which is run after the fixtures are loaded.
+	setup string
+
+	// readOnly runs the case against a read-only server, which doesn't
+	// record health checks of its own next to the fixtures'.
+	readOnly bool
+
+	// guest runs the case with guest access to the catalog enabled.
+	guest bool
+}
+
+var goldenCases = []goldenCase{
+	{name: "healthcheck", method: http.MethodGet, path: "/v1/healthcheck"},
+	{name: "readyz", method: http.MethodGet, path: "/v1/readyz"},
+	{name: "openapi", method: http.MethodGet, path: "/v1/openapi.json"},
+	{name: "not_found", method: http.MethodGet, path: "/v1/nonexistent"},
+	{name: "method_not_allowed", method: http.MethodPatch, path: "/v1/healthcheck"},
+	{name: "movies_invalid_query", method: http.MethodGet, path: "/v1/movies?page=0&page_size=1000&sort=-rating"},
+	{name: "feed_invalid_query", method: http.MethodGet, path: "/v1/feeds/movies.atom?limit=1000"},
+	{name: "list_movies_unauthenticated", method: http.MethodGet, path: "/v1/movies"},
+	{name: "create_movie_unauthenticated", method: http.MethodPost, path: "/v1/movies", body: `{"title":"Moana"}`},
+	{name: "invalid_authorization_header", method: http.MethodGet, path: "/v1/movies", header: map[string]string{"Authorization": "Basic abc"}},
+	{name: "register_user_malformed", method: http.MethodPost, path: "/v1/users", body: `{"name":`},
+	{name: "register_user_unknown_field", method: http.MethodPost, path: "/v1/users", body: `{"nickname":"bob"}`},
+	{name: "register_user_invalid", method: http.MethodPost, path: "/v1/users", body: `{"name":"","email":"not-an-email","password":"short"}`},
+	{name: "register_user_password_too_long", method: http.MethodPost, path: "/v1/users", body: `{"name":"Golden","email":"golden@example.com","password":"` + strings.Repeat("pa55word", 10) + `"}`},
+	{name: "authentication_token_invalid", method: http.MethodPost, path: "/v1/tokens/authentication", body: `{"email":"","password":""}`},
+	{name: "reset_user_password_invalid", method: http.MethodPut, path: "/v1/users/password", body: `{"password":"short","token":"abc"}`},
+	{name: "create_events", method: http.MethodPost, path: "/v1/events", body: `{"events":[{"type":"screen_view","anonymous_id":"golden","occurred_at":"{{now}}","properties":{"screen":"home"}}]}`},
+	{name: "csrf_token", method: http.MethodPost, path: "/v1/tokens/csrf"},
+	{name: "debug_vars_unauthenticated", method: http.MethodGet, path: "/debug/vars"},
+
+	{name: "list_movies", method: http.MethodGet, path: "/v1/movies?page_size=2", user: goldenViewer, needsDB: true},
+	{name: "list_movies_snapshot_invalid", method: http.MethodGet, path: "/v1/movies?snapshot=bogus", user: goldenViewer, needsDB: true},
+	{name: "list_movies_guest", method: http.MethodGet, path: "/v1/movies?page_size=2", needsDB: true, guest: true},
+	{name: "show_movie", method: http.MethodGet, path: "/v1/movies/1", user: goldenViewer, needsDB: true},
+	{name: "show_movie_missing", method: http.MethodGet, path: "/v1/movies/9223372036854775807", user: goldenViewer, needsDB: true},
+	{name: "random_movie", method: http.MethodGet, path: "/v1/movies/random?genres=action", user: goldenViewer, needsDB: true},
+	{name: "featured_movie", method: http.MethodGet, path: "/v1/movies/featured", user: goldenViewer, needsDB: true, setup: `DELETE FROM movies WHERE id <> 1`},
+	{name: "create_movie", method: http.MethodPost, path: "/v1/movies", user: goldenAdmin, needsDB: true,
+		body: `{"title":"Arrival","year":2016,"runtime":"116 mins","genres":["drama"],"certification":"PG","language":"en"}`},
+	{name: "update_movie", method: http.MethodPut, path: "/v1/movies/2", user: goldenAdmin, needsDB: true,
+		body: `{"title":"Moana","year":2016,"runtime":"107 mins","genres":["action","comedy"],"certification":"PG","language":"fr"}`},
+	{name: "patch_movie", method: http.MethodPatch, path: "/v1/movies/3", user: goldenAdmin, needsDB: true, body: `{"runtime":"95 mins"}`},
+	{name: "delete_movie", method: http.MethodDelete, path: "/v1/movies/2", user: goldenAdmin, needsDB: true},
+	{name: "upload_poster", method: http.MethodPost, path: "/v1/movies/2/poster", user: goldenAdmin, needsDB: true,
+		header: map[string]string{"Content-Type": "multipart/form-data; boundary=golden"}, body: goldenPoster},
+	{name: "movie_feed_atom", method: http.MethodGet, path: "/v1/feeds/movies.atom", user: goldenViewer, needsDB: true},
+	{name: "movie_feed_rss", method: http.MethodGet, path: "/v1/feeds/movies.rss", user: goldenViewer, needsDB: true},
+	{name: "movie_card", method: http.MethodGet, path: "/v1/movies/1/card", user: goldenViewer, needsDB: true},
+	{name: "list_reviews", method: http.MethodGet, path: "/v1/movies/1/reviews", user: goldenViewer, needsDB: true},
+	{name: "create_review", method: http.MethodPost, path: "/v1/movies/2/reviews", user: goldenViewer, needsDB: true, body: `{"rating":4,"body":"Great songs."}`},
+	{name: "show_watch_progress", method: http.MethodGet, path: "/v1/movies/1/progress", user: goldenViewer, needsDB: true},
+	{name: "update_watch_progress", method: http.MethodPut, path: "/v1/movies/2/progress", user: goldenViewer, needsDB: true, body: `{"position_seconds":1200,"device":"laptop"}`},
+	{name: "continue_watching", method: http.MethodGet, path: "/v1/users/me/progress", user: goldenViewer, needsDB: true},
+	{name: "list_watchlist", method: http.MethodGet, path: "/v1/me/watchlist", user: goldenViewer, needsDB: true},
+	{name: "add_to_watchlist", method: http.MethodPost, path: "/v1/me/watchlist", user: goldenViewer, needsDB: true, body: `{"movie_id":2}`},
+	{name: "remove_from_watchlist", method: http.MethodDelete, path: "/v1/me/watchlist/1", user: goldenViewer, needsDB: true},
+
+	{name: "register_user", method: http.MethodPost, path: "/v1/users", needsDB: true, body: `{"name":"Golden","email":"golden@example.com","password":"` + goldenPassword + `"}`},
+	{name: "register_user_duplicate", method: http.MethodPost, path: "/v1/users", needsDB: true, body: `{"name":"Golden","email":"admin@example.com","password":"` + goldenPassword + `"}`},
+	{name: "activate_user", method: http.MethodPut, path: "/v1/users/activated", needsDB: true, body: `{"token":"` + goldenActivationToken + `"}`},
+	{name: "confirm_email_change", method: http.MethodPut, path: "/v1/users/email/verified", needsDB: true, body: `{"token":"` + goldenEmailChangeToken + `"}`},
+	{name: "reset_user_password", method: http.MethodPut, path: "/v1/users/password", needsDB: true, body: `{"password":"n3w-pa55word-golden","token":"` + goldenResetToken + `"}`},
+	{name: "update_user_email", method: http.MethodPut, path: "/v1/users/me/email", user: goldenAdmin, needsDB: true, body: `{"email":"admin.new@example.com","password":"` + goldenPassword + `"}`},
+	{name: "update_user_password", method: http.MethodPut, path: "/v1/users/me/password", user: goldenAdmin, needsDB: true, body: `{"current_password":"` + goldenPassword + `","password":"n3w-pa55word-golden"}`},
+	{name: "enroll_totp", method: http.MethodPost, path: "/v1/users/me/totp", user: goldenAdmin, needsDB: true, body: `{"current_password":"` + goldenPassword + `"}`},
+	{name: "confirm_totp", method: http.MethodPost, path: "/v1/users/me/totp/confirm", user: goldenViewer, needsDB: true, body: `{"code":"{{totp_code}}"}`},
+	{name: "list_personal_access_tokens", method: http.MethodGet, path: "/v1/users/me/tokens", user: goldenAdmin, needsDB: true},
+	{name: "create_personal_access_token", method: http.MethodPost, path: "/v1/users/me/tokens", user: goldenAdmin, needsDB: true, body: `{"name":"Deploy","scopes":["read:movies"],"expiry":"{{next_month}}"}`},
+	{name: "revoke_personal_access_token", method: http.MethodDelete, path: "/v1/users/me/tokens/1", user: goldenAdmin, needsDB: true},
+	{name: "list_api_keys", method: http.MethodGet, path: "/v1/users/me/api-keys", user: goldenAdmin, needsDB: true},
+	{name: "create_api_key", method: http.MethodPost, path: "/v1/users/me/api-keys", user: goldenAdmin, needsDB: true, body: `{"name":"Worker","scopes":["read:movies"]}`},
+	{name: "revoke_api_key", method: http.MethodDelete, path: "/v1/users/me/api-keys/1", user: goldenAdmin, needsDB: true},
+	{name: "authentication_token", method: http.MethodPost, path: "/v1/tokens/authentication", needsDB: true, body: `{"email":"admin@example.com","password":"` + goldenPassword + `"}`},
+	{name: "authentication_token_inactive", method: http.MethodPost, path: "/v1/tokens/authentication", needsDB: true, body: `{"email":"inactive@example.com","password":"` + goldenPassword + `"}`},
+	{name: "revoke_authentication_token", method: http.MethodDelete, path: "/v1/tokens/authentication", user: goldenAdmin, needsDB: true},
+	{name: "password_reset_token", method: http.MethodPost, path: "/v1/tokens/password-reset", needsDB: true, body: `{"email":"viewer@example.com"}`},
+
+	{name: "list_users", method: http.MethodGet, path: "/v1/admin/users", user: goldenAdmin, needsDB: true},
+	{name: "show_user_roles", method: http.MethodGet, path: "/v1/admin/users/2/roles", user: goldenAdmin, needsDB: true},
+	{name: "update_user_roles", method: http.MethodPut, path: "/v1/admin/users/2/roles", user: goldenAdmin, needsDB: true, body: `{"roles":["editor","viewer"]}`},
+	{name: "list_genres", method: http.MethodGet, path: "/v1/genres", needsDB: true},
+	{name: "list_vocabularies", method: http.MethodGet, path: "/v1/vocabularies", needsDB: true},
+	{name: "show_vocabulary", method: http.MethodGet, path: "/v1/vocabularies/certifications", needsDB: true},
+	{name: "create_term", method: http.MethodPost, path: "/v1/admin/vocabularies/languages", user: goldenAdmin, needsDB: true, body: `{"value":"de","label":"German"}`},
+	{name: "update_term", method: http.MethodPatch, path: "/v1/admin/vocabularies/genres/western", user: goldenAdmin, needsDB: true, body: `{"label":"Westerns"}`},
+	{name: "delete_term", method: http.MethodDelete, path: "/v1/admin/vocabularies/genres/western", user: goldenAdmin, needsDB: true},
+	{name: "show_email_check", method: http.MethodGet, path: "/v1/admin/email-checks", user: goldenAdmin, needsDB: true},
+	// Every address is suppressed, so that the check doesn't look up any
+	// mail servers.
+	{name: "start_email_check", method: http.MethodPost, path: "/v1/admin/email-checks", user: goldenAdmin, needsDB: true,
+		setup: `INSERT INTO email_suppressions (email, reason) SELECT email, 'golden' FROM users`},
+	{name: "create_email_suppression", method: http.MethodPost, path: "/v1/admin/email-suppressions", user: goldenAdmin, needsDB: true, body: `{"email":"complained@example.com","reason":"spam complaint"}`},
+	{name: "delete_email_suppression", method: http.MethodDelete, path: "/v1/admin/email-suppressions/bounced@example.com", user: goldenAdmin, needsDB: true},
+	{name: "reconcile_ratings", method: http.MethodPost, path: "/v1/admin/ratings/reconcile", user: goldenAdmin, needsDB: true,
+		setup: `UPDATE movies SET rating_count = 0, rating_sum = 0 WHERE id = 3`},
+	{name: "create_incident", method: http.MethodPost, path: "/v1/admin/incidents", user: goldenAdmin, needsDB: true, body: `{"title":"Database maintenance","components":["database"]}`},
+	{name: "update_incident", method: http.MethodPatch, path: "/v1/admin/incidents/1", user: goldenAdmin, needsDB: true, body: `{"status":"resolved"}`},
+	{name: "delete_incident", method: http.MethodDelete, path: "/v1/admin/incidents/1", user: goldenAdmin, needsDB: true},
+	{name: "status", method: http.MethodGet, path: "/v1/status", needsDB: true, readOnly: true},
+	{name: "status_history", method: http.MethodGet, path: "/v1/status/history", needsDB: true, readOnly: true},
+}
+
+// goldenConfig is the configuration the cases run with. Sessions are
+// enabled so that every operation is served, and the workers which would
+// write to the database behind the cases' backs are off.
+func goldenConfig(t *testing.T) Config {
+	cfg := DefaultConfig()
+	cfg.JWT.Secret = "golden-test-secret"
+	cfg.Limiter.Enabled = false
+	cfg.Mailer.Backend = MailerLog
+	cfg.Session.Enabled = true
+	cfg.Retention.Enabled = false
+	cfg.Tokens.CleanupInterval = 0
+	cfg.FastCrypto = true
+
+	if t != nil {
+		cfg.Storage.Disk.Dir = t.TempDir()
+	}
+
+	return cfg
+}
+
+func TestGolden(t *testing.T) {
+	dsn := os.Getenv(goldenDSNEnv)
+
+	// Without a database, nothing listens at the DSN, and only the cases
+	// which don't need one run.
+	openDSN := dsn
+	if openDSN == "" {
+		openDSN = "postgres://golden@127.0.0.1:1/golden?sslmode=disable&connect_timeout=1"
+	}
+
+	db, err := sql.Open("postgres", openDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	fixtures, err := os.ReadFile(filepath.Join("testdata", "golden", "fixtures.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range goldenCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.needsDB {
+				if dsn == "" {
+					t.Skipf("set %s to the DSN of a migrated database to run this case", goldenDSNEnv)
+				}
+
+				_, err := db.Exec(string(fixtures))
+				if err != nil {
+					t.Fatalf("loading fixtures: %v", err)
+				}
+
+				if tc.setup != "" {
+					_, err = db.Exec(tc.setup)
+					if err != nil {
+						t.Fatalf("running setup: %v", err)
+					}
+				}
+			}
+
+			cfg := goldenConfig(t)
+			if tc.readOnly {
+				cfg.Mode = ModeReadOnly
+			}
+			cfg.Guest.Enabled = tc.guest
+
+			srv, err := New(cfg, WithDB(db, nil), WithLogOutput(io.Discard))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer srv.Shutdown(context.Background())
+
+			r := httptest.NewRequest(tc.method, tc.path, goldenBody(t, tc.body))
+			for key, value := range tc.header {
+				r.Header.Set(key, value)
+			}
+
+			if tc.user != 0 {
+				token, _, err := srv.app.newAuthenticationJWT(&data.User{ID: tc.user})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				r.Header.Set("Authorization", "Bearer "+string(token))
+			}
+
+			rr := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(rr, r)
+
+			got := goldenSnapshot(t, rr)
+			path := goldenPath(tc.name)
+
+			if *update {
+				err := os.MkdirAll(filepath.Dir(path), 0o755)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				err = os.WriteFile(path, got, 0o644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%v (run with -update to create it)", err)
+			}
+
+			if !bytes.Equal(got, want) {
+				t.Errorf("response differs from %s (run with -update to accept it)\n got: %s\nwant: %s", path, got, want)
+			}
+		})
+	}
+}
+
+// TestGoldenCoverage checks that every operation has a golden case for its
+// success response, by reading the recorded status from the golden files,
+// so that it runs without a database too.
+func TestGoldenCoverage(t *testing.T) {
+	cfg := goldenConfig(nil)
+
+	covered := make(map[string]bool)
+
+	for _, tc := range goldenCases {
+		op, ok := goldenOperation(tc, cfg)
+		if !ok {
+			continue
+		}
+
+		js, err := os.ReadFile(goldenPath(tc.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var snapshot struct {
+			Status int `json:"status"`
+		}
+
+		err = json.Unmarshal(js, &snapshot)
+		if err != nil {
+			t.Fatalf("%s: %v", goldenPath(tc.name), err)
+		}
+
+		if snapshot.Status == op.status {
+			covered[op.method+" "+op.path] = true
+		}
+	}
+
+	for _, op := range apiOperations {
+		if op.enabled != nil && !op.enabled(cfg) {
+			continue
+		}
+
+		if !covered[op.method+" "+op.path] {
+			t.Errorf("%s %s has no golden case with a %d response", op.method, op.path, op.status)
+		}
+	}
+}
+
+// goldenOperation returns the operation the case's request is routed to. A
+// static path segment takes precedence over a parameter, as in the router,
+// so /v1/movies/random is not a request for the movie with ID "random".
+func goldenOperation(tc goldenCase, cfg Config) (apiOperation, bool) {
+	path, _, _ := strings.Cut(tc.path, "?")
+	segments := strings.Split(path, "/")
+
+	var (
+		best       apiOperation
+		bestParams = -1
+	)
+
+	for _, op := range apiOperations {
+		if op.method != tc.method || (op.enabled != nil && !op.enabled(cfg)) {
+			continue
+		}
+
+		opSegments := strings.Split(op.path, "/")
+		if len(opSegments) != len(segments) {
+			continue
+		}
+
+		params := 0
+		for i, segment := range opSegments {
+			switch {
+			case strings.HasPrefix(segment, ":"):
+				params++
+			case segment != segments[i]:
+				params = -1
+			}
+
+			if params < 0 {
+				break
+			}
+		}
+
+		if params >= 0 && (bestParams < 0 || params < bestParams) {
+			best, bestParams = op, params
+		}
+	}
+
+	return best, bestParams >= 0
+}
+
+func goldenPath(name string) string {
+	return filepath.Join("testdata", "golden", name+".json")
+}
+
+// goldenBody returns the request body with its placeholders replaced.
+func goldenBody(t *testing.T, body string) io.Reader {
+	t.Helper()
+
+	if body == "" {
+		return nil
+	}
+
+	now := time.Now()
+
+	code, err := totp.Code(goldenTOTPSecret, totp.Step(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replacer := strings.NewReplacer(
+		"{{now}}", now.UTC().Format(time.RFC3339),
+		"{{next_month}}", now.AddDate(0, 1, 0).UTC().Format(time.RFC3339),
+		"{{totp_code}}", code,
+	)
+
+	return strings.NewReader(replacer.Replace(body))
+}
+
+// goldenSnapshot renders the status and body of a response. JSON bodies
+// are normalized, and other bodies are kept as text along with their
+// Content-Type.
+func goldenSnapshot(t *testing.T, rr *httptest.ResponseRecorder) []byte {
+	t.Helper()
+
+	snapshot := map[string]any{"status": rr.Code}
+
+	contentType := rr.Header().Get("Content-Type")
+	if strings.HasPrefix(contentType, "application/json") {
+		snapshot["body"] = normalizeGoldenValue("", anonymizeExampleJSON(rr.Body.Bytes()))
+	} else {
+		snapshot["content_type"] = contentType
+		snapshot["body"] = rr.Body.String()
+	}
+
+	var js bytes.Buffer
+
+	enc := json.NewEncoder(&js)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "\t")
+
+	err := enc.Encode(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return js.Bytes()
+}
+
+// normalizeGoldenValue replaces the values which change between runs: IDs,
+// which are numbers under an "id" or "*_id" key, RFC 3339 timestamps and
+// dates, and poster URLs, which end in a random name.
+func normalizeGoldenValue(key string, v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, value := range v {
+			v[k] = normalizeGoldenValue(k, value)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = normalizeGoldenValue(key, value)
+		}
+	case float64:
+		if key == "id" || strings.HasSuffix(key, "_id") {
+			return "<id>"
+		}
+	case string:
+		if key == "poster_url" {
+			return "<poster_url>"
+		}
+		if _, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return "<timestamp>"
+		}
+		if _, err := time.Parse(time.DateOnly, v); err == nil {
+			return "<date>"
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/http"
+)
+
+func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
+	env := envelope{
+		"status": "available",
+		"system_info": map[string]string{
+			"environment": app.config.Env,
+			"mode":        app.config.Mode,
+			"region":      app.config.Region,
+			"version":     version,
+		},
+	}
+
+	err := app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readinessHandler reports whether the application has finished warming up
+// and can reach the database, and so is ready to receive traffic. Unlike the
+// healthcheck, it responds with 503 Service Unavailable when it isn't. The
+// database state is dampened by the readiness prober, so it only changes
+// after several consecutive probes agree.
+func (app *application) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	env := envelope{"status": "ready"}
+
+	switch {
+	case !app.ready.Load():
+		status = http.StatusServiceUnavailable
+		env = envelope{"status": "warming up"}
+	case !app.dbHealth.Healthy():
+		status = http.StatusServiceUnavailable
+		env = envelope{"status": "dependency unavailable", "dependency": componentDatabase}
+	}
+
+	err := app.writeJSON(w, status, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,316 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type envelope map[string]any
+
+func (app *application) readIDParam(r *http.Request) (int64, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid id parameter")
+	}
+
+	return id, nil
+}
+
+func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
+	if meta := responseMetaFromWriter(w); meta != nil {
+		if _, exists := data["meta"]; !exists {
+			data["meta"] = meta.envelope()
+		}
+	}
+
+	permissions := permissionsFromWriter(w)
+	for key, value := range data {
+		data[key] = redactFields(value, permissions)
+	}
+
+	js, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	js = append(js, '\n')
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+
+	return nil
+}
+
+// The errors readJSON returns for bodies it can't decode. The messages are
+// meant for the client, and badRequestResponse sends them as they are.
+var (
+	errEmptyBody          = errors.New("body must not be empty")
+	errMultipleJSONValues = errors.New("body must only contain a single JSON value")
+)
+
+// jsonSyntaxError is returned by readJSON for badly-formed JSON. Offset is
+// the position of the problem in the body, or 0 if the body ended early.
+type jsonSyntaxError struct {
+	Offset int64
+}
+
+func (e *jsonSyntaxError) Error() string {
+	if e.Offset == 0 {
+		return "body contains badly-formed JSON"
+	}
+	return fmt.Sprintf("body contains badly-formed JSON (at character %d)", e.Offset)
+}
+
+// jsonFieldError is returned by readJSON when a field has a value of the
+// wrong type, or isn't a field the endpoint accepts. Field is the dotted path
+// to the field, if the decoder could tell.
+type jsonFieldError struct {
+	Field   string
+	Offset  int64
+	Unknown bool
+}
+
+func (e *jsonFieldError) Error() string {
+	switch {
+	case e.Unknown:
+		return fmt.Sprintf("body contains unknown key %q", e.Field)
+	case e.Field != "":
+		return fmt.Sprintf("body contains incorrect JSON type for field %q", e.Field)
+	default:
+		return fmt.Sprintf("body contains incorrect JSON type (at character %d)", e.Offset)
+	}
+}
+
+// bodyTooLargeError is returned by readJSON when the body is bigger than
+// the -limit-max-body-size limit.
+type bodyTooLargeError struct {
+	Limit int64
+}
+
+func (e *bodyTooLargeError) Error() string {
+	return fmt.Sprintf("body must not be larger than %d bytes", e.Limit)
+}
+
+// readJSON decodes a request body holding a single JSON value into dst.
+// Bodies larger than the configured limit, with fields dst doesn't have, or
+// with anything after the value are rejected.
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	maxBytes := app.config.Limits.MaxBodySize
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		return jsonDecodeError(err)
+	}
+
+	err = dec.Decode(&struct{}{})
+	if !errors.Is(err, io.EOF) {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return &bodyTooLargeError{Limit: maxBytesError.Limit}
+		}
+
+		return errMultipleJSONValues
+	}
+
+	return nil
+}
+
+// jsonDecodeError translates an error from decoding a request body into
+// one of readJSON's errors.
+func jsonDecodeError(err error) error {
+	var syntaxError *json.SyntaxError
+	var unmarshalTypeError *json.UnmarshalTypeError
+	var invalidUnmarshalError *json.InvalidUnmarshalError
+	var maxBytesError *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &syntaxError):
+		return &jsonSyntaxError{Offset: syntaxError.Offset}
+
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &jsonSyntaxError{}
+
+	case errors.As(err, &unmarshalTypeError):
+		return &jsonFieldError{Field: unmarshalTypeError.Field, Offset: unmarshalTypeError.Offset}
+
+	// There isn't an error type for unknown fields, so the field name has to
+	// be taken from the message.
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+		if unquoted, err := strconv.Unquote(field); err == nil {
+			field = unquoted
+		}
+		return &jsonFieldError{Field: field, Unknown: true}
+
+	case errors.Is(err, io.EOF):
+		return errEmptyBody
+
+	case errors.As(err, &maxBytesError):
+		return &bodyTooLargeError{Limit: maxBytesError.Limit}
+
+	case errors.As(err, &invalidUnmarshalError):
+		panic(err)
+
+	default:
+		return err
+	}
+}
+
+// readString returns a string value from the query string, or the provided
+// default value if no matching key could be found.
+func (app *application) readString(qs url.Values, key string, defaultValue string) string {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	return s
+}
+
+// readCSV reads a string value from the query string and splits it into a
+// slice on the comma character. If no matching key could be found, it
+// returns the provided default value.
+func (app *application) readCSV(qs url.Values, key string, defaultValue []string) []string {
+	csv := qs.Get(key)
+
+	if csv == "" {
+		return defaultValue
+	}
+
+	return strings.Split(csv, ",")
+}
+
+// readInt reads a string value from the query string and converts it to an
+// integer before returning. If no matching key could be found it returns the
+// provided default value. If the value couldn't be converted to an integer,
+// then we record an error message in the provided Validator instance.
+func (app *application) readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		v.AddError(key, "must be an integer value")
+		return defaultValue
+	}
+
+	return i
+}
+
+// isDryRun reports whether the client asked for the request to be validated
+// and checked without persisting anything, either with a "Prefer: dry-run"
+// header or a "dry_run=true" query string parameter.
+func (app *application) isDryRun(r *http.Request) bool {
+	for _, prefer := range r.Header.Values("Prefer") {
+		for _, preference := range strings.Split(prefer, ",") {
+			if strings.EqualFold(strings.TrimSpace(preference), "dry-run") {
+				return true
+			}
+		}
+	}
+
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	return dryRun
+}
+
+// write calls fn with the application models. For dry-run requests the
+// models are bound to a transaction which is rolled back afterwards.
+func (app *application) write(r *http.Request, fn func(data.Models) error) error {
+	if !app.isDryRun(r) {
+		return fn(app.models)
+	}
+
+	return app.models.DryRun(fn)
+}
+
+// dryRunResponse sends the result of a dry-run write: a 200 OK with the
+// would-be representation and a Preference-Applied header.
+func (app *application) dryRunResponse(w http.ResponseWriter, r *http.Request, env envelope) {
+	env["dry_run"] = true
+
+	headers := make(http.Header)
+	headers.Set("Preference-Applied", "dry-run")
+
+	err := app.writeJSON(w, http.StatusOK, env, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// paginationLinks returns an RFC 8288 (formerly RFC 5988) Link header value
+// with the first, prev, next and last pages of a paginated list, or just the
+// next page for a keyset-paginated one. The links keep the request's other
+// query string parameters, and the snapshot the list was pinned to. It
+// returns an empty string if the list is empty.
+func (app *application) paginationLinks(r *http.Request, metadata data.Metadata) string {
+	if metadata.NextCursor != "" {
+		qs := r.URL.Query()
+		qs.Set("after", metadata.NextCursor)
+		setSnapshot(qs, metadata)
+
+		return fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, qs.Encode())
+	}
+
+	if metadata.TotalRecords == 0 {
+		return ""
+	}
+
+	link := func(page int, rel string) string {
+		qs := r.URL.Query()
+		qs.Set("page", strconv.Itoa(page))
+		qs.Set("page_size", strconv.Itoa(metadata.PageSize))
+		setSnapshot(qs, metadata)
+
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, r.URL.Path, qs.Encode(), rel)
+	}
+
+	links := []string{link(metadata.FirstPage, "first")}
+
+	if metadata.CurrentPage > metadata.FirstPage {
+		links = append(links, link(min(metadata.CurrentPage-1, metadata.LastPage), "prev"))
+	}
+
+	if metadata.CurrentPage < metadata.LastPage {
+		links = append(links, link(metadata.CurrentPage+1, "next"))
+	}
+
+	links = append(links, link(metadata.LastPage, "last"))
+
+	return strings.Join(links, ", ")
+}
+
+// setSnapshot replaces the snapshot parameter with the one the list was
+// pinned to, which is a new one if the request asked for it with an empty
+// parameter.
+func setSnapshot(qs url.Values, metadata data.Metadata) {
+	if metadata.Snapshot != "" {
+		qs.Set("snapshot", metadata.Snapshot)
+	}
+}
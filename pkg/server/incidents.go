@@ -0,0 +1,149 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+)
+
+func (app *application) createIncidentHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Title      string   `json:"title"`
+		Body       string   `json:"body"`
+		Status     string   `json:"status"`
+		Components []string `json:"components"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Status == "" {
+		input.Status = data.IncidentInvestigating
+	}
+
+	incident := &data.Incident{
+		Title:      input.Title,
+		Body:       input.Body,
+		Status:     input.Status,
+		Components: input.Components,
+	}
+
+	v := validator.New()
+
+	if data.ValidateIncident(v, incident, statusComponents); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Incidents.Insert(incident)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/admin/incidents/%d", incident.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"incident": incident}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateIncidentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	incident, err := app.models.Incidents.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Title      *string  `json:"title"`
+		Body       *string  `json:"body"`
+		Status     *string  `json:"status"`
+		Components []string `json:"components"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Title != nil {
+		incident.Title = *input.Title
+	}
+	if input.Body != nil {
+		incident.Body = *input.Body
+	}
+	if input.Status != nil {
+		incident.Status = *input.Status
+	}
+	if input.Components != nil {
+		incident.Components = input.Components
+	}
+
+	v := validator.New()
+
+	if data.ValidateIncident(v, incident, statusComponents); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Incidents.Update(incident)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"incident": incident}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteIncidentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Incidents.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "incident successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
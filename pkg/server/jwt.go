@@ -0,0 +1,257 @@
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+// The expired and not-yet-valid errors wrap errInvalidAuthenticationToken,
+// so callers which don't care about the difference can treat them alike.
+var (
+	errInvalidAuthenticationToken     = errors.New("invalid authentication token")
+	errExpiredAuthenticationToken     = fmt.Errorf("%w: expired", errInvalidAuthenticationToken)
+	errAuthenticationTokenNotYetValid = fmt.Errorf("%w: not yet valid", errInvalidAuthenticationToken)
+)
+
+// jwtKeys are the keys authentication JWTs are signed and checked with.
+// Tokens signed with a key pair carry its ID in the kid header, and are only
+// checked with the public key of that ID. Tokens without a kid are checked
+// with the HMAC secret.
+type jwtKeys struct {
+	signingKID string
+	signingKey any
+	secret     []byte
+	public     map[string]any
+}
+
+// loadJWTKeys reads the key files of the configuration.
+func loadJWTKeys(cfg Config) (*jwtKeys, error) {
+	keys := &jwtKeys{
+		signingKID: cfg.JWT.SigningKeyID,
+		public:     make(map[string]any, len(cfg.JWT.Keys)),
+	}
+
+	if cfg.JWT.Secret != "" {
+		keys.secret = []byte(cfg.JWT.Secret)
+	}
+
+	for kid, path := range cfg.JWT.Keys {
+		text, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading JWT key %q: %w", kid, err)
+		}
+
+		key, err := parseJWTKey(text)
+		if err != nil {
+			return nil, fmt.Errorf("JWT key %q: %w", kid, err)
+		}
+
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			keys.public[kid] = &key.PublicKey
+		case ed25519.PrivateKey:
+			keys.public[kid] = key.Public()
+		default:
+			if kid == keys.signingKID {
+				return nil, fmt.Errorf("JWT key %q: the signing key must be a private key", kid)
+			}
+			keys.public[kid] = key
+		}
+
+		if kid == keys.signingKID {
+			keys.signingKey = key
+		}
+	}
+
+	return keys, nil
+}
+
+// parseJWTKey parses a PEM-encoded RSA or Ed25519 key, either a private key
+// or just the public key.
+func parseJWTKey(text []byte) (any, error) {
+	block, _ := pem.Decode(text)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var (
+		key any
+		err error
+	)
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch key.(type) {
+	case *rsa.PrivateKey, *rsa.PublicKey, ed25519.PrivateKey, ed25519.PublicKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T: use RSA or Ed25519", key)
+	}
+}
+
+// sign signs the claims with the signing key, or the secret if there isn't
+// one.
+func (k *jwtKeys) sign(claims *jwt.Claims) ([]byte, error) {
+	switch key := k.signingKey.(type) {
+	case *rsa.PrivateKey:
+		claims.KeyID = k.signingKID
+		return claims.RSASign(jwt.RS256, key)
+	case ed25519.PrivateKey:
+		claims.KeyID = k.signingKID
+		return claims.EdDSASign(key)
+	default:
+		return claims.HMACSign(jwt.HS256, k.secret)
+	}
+}
+
+// check verifies the token's signature with the key its kid selects. The
+// kind of key decides which algorithms are accepted, so a token can't have
+// a public key used as an HMAC secret.
+func (k *jwtKeys) check(token []byte) (*jwt.Claims, error) {
+	unverified, err := jwt.ParseWithoutCheck(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if unverified.KeyID == "" {
+		if k.secret == nil {
+			return nil, errInvalidAuthenticationToken
+		}
+		return jwt.HMACCheck(token, k.secret)
+	}
+
+	switch key := k.public[unverified.KeyID].(type) {
+	case *rsa.PublicKey:
+		return jwt.RSACheck(token, key)
+	case ed25519.PublicKey:
+		return jwt.EdDSACheck(token, key)
+	default:
+		return nil, errInvalidAuthenticationToken
+	}
+}
+
+// newAuthenticationJWT issues a signed authentication JWT for the user, and
+// returns it along with its expiry time. Each token gets a random ID in the
+// jti claim, by which it can be revoked.
+func (app *application) newAuthenticationJWT(user *data.User) ([]byte, time.Time, error) {
+	now := time.Now()
+	expiry := now.Add(app.config.JWT.TTL)
+
+	randomBytes := make([]byte, 16)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var claims jwt.Claims
+	claims.ID = base64.RawURLEncoding.EncodeToString(randomBytes)
+	claims.Subject = strconv.FormatInt(user.ID, 10)
+	claims.Issued = jwt.NewNumericTime(now)
+	claims.NotBefore = jwt.NewNumericTime(now)
+	claims.Expires = jwt.NewNumericTime(expiry)
+	claims.Issuer = app.config.JWT.Issuer
+	claims.Audiences = []string{app.config.JWT.Audience}
+
+	jwtBytes, err := app.jwtKeys.sign(&claims)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return jwtBytes, expiry, nil
+}
+
+// userForJWT verifies an authentication JWT and returns the user it was
+// issued to, along with the token's claims. It returns
+// errInvalidAuthenticationToken if the token isn't valid, has been revoked,
+// the user no longer exists, or the user has changed their password since it
+// was issued. The exp and nbf claims are checked with
+// Config.JWT.Leeway of tolerance either way, to allow for clocks which have
+// drifted, and failing them returns the more specific
+// errExpiredAuthenticationToken or errAuthenticationTokenNotYetValid.
+func (app *application) userForJWT(ctx context.Context, token string) (*data.User, *jwt.Claims, error) {
+	claims, err := app.jwtKeys.check([]byte(token))
+	if err != nil {
+		return nil, nil, errInvalidAuthenticationToken
+	}
+
+	now := time.Now()
+	leeway := app.config.JWT.Leeway
+
+	if claims.Expires != nil && !now.Add(-leeway).Before(claims.Expires.Time()) {
+		return nil, nil, errExpiredAuthenticationToken
+	}
+
+	if claims.NotBefore != nil && now.Add(leeway).Before(claims.NotBefore.Time()) {
+		return nil, nil, errAuthenticationTokenNotYetValid
+	}
+
+	if claims.Issuer != app.config.JWT.Issuer {
+		return nil, nil, errInvalidAuthenticationToken
+	}
+
+	if !claims.AcceptAudience(app.config.JWT.Audience) {
+		return nil, nil, errInvalidAuthenticationToken
+	}
+
+	// Tokens issued before revocation was introduced have no ID, and can't
+	// be revoked.
+	if claims.ID != "" {
+		revoked, err := app.revocations.IsRevoked(ctx, claims.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if revoked {
+			return nil, nil, errInvalidAuthenticationToken
+		}
+	}
+
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := app.models.Users.Get(userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, nil, errInvalidAuthenticationToken
+		default:
+			return nil, nil, err
+		}
+	}
+
+	// Changing the password signs the user out everywhere else.
+	if user.PasswordChangedAt != nil && (claims.Issued == nil || claims.Issued.Time().Before(*user.PasswordChangedAt)) {
+		return nil, nil, errInvalidAuthenticationToken
+	}
+
+	return user, claims, nil
+}
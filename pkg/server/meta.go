@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+	"time"
+)
+
+// responseMeta holds the operational information which is added to JSON
+// responses as a "meta" object when the -envelope-meta flag is set.
+type responseMeta struct {
+	start              time.Time
+	requestID          string
+	rateLimitRemaining *int
+}
+
+func (m *responseMeta) envelope() envelope {
+	env := envelope{
+		"processing_time": time.Since(m.start).String(),
+	}
+
+	if m.requestID != "" {
+		env["request_id"] = m.requestID
+	}
+
+	if m.rateLimitRemaining != nil {
+		env["rate_limit_remaining"] = *m.rateLimitRemaining
+	}
+
+	return env
+}
+
+// metaResponseWriter carries the responseMeta for a request through to
+// writeJSON.
+type metaResponseWriter struct {
+	http.ResponseWriter
+	meta *responseMeta
+}
+
+func (mw *metaResponseWriter) Unwrap() http.ResponseWriter {
+	return mw.ResponseWriter
+}
+
+// responseMetaFromWriter returns the responseMeta carried by w, looking
+// through any other wrapping response writers, or nil if there isn't one.
+func responseMetaFromWriter(w http.ResponseWriter) *responseMeta {
+	for {
+		switch rw := w.(type) {
+		case *metaResponseWriter:
+			return rw.meta
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,623 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+)
+
+// requestID gives every request an ID which is returned in the X-Request-ID
+// response header and included in log entries and error responses. An
+// X-Request-ID header set by the client (or a proxy in front of us) is
+// honored if it looks reasonable, so IDs can be correlated across services.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+
+		if !validRequestID(requestID) {
+			randomBytes := make([]byte, 16)
+
+			_, err := rand.Read(randomBytes)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			requestID = hex.EncodeToString(randomBytes)
+		}
+
+		w.Header().Set("X-Request-ID", requestID)
+
+		r = app.contextSetRequestID(r, requestID)
+		r = app.contextSetLogger(r, app.logger.With(map[string]string{"request_id": requestID}))
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// recoverPanic turns a panic in a handler into a 500 response, rather than
+// net/http closing the connection without one. The panic is logged with its
+// stack trace, which the logger adds to every error. The connection is
+// closed after the response, as the panic may have left it in an
+// inconsistent state. http.ErrAbortHandler is re-panicked, since handlers
+// use it to abort a response deliberately.
+func (app *application) recoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			pv := recover()
+			if pv == nil {
+				return
+			}
+
+			if pv == http.ErrAbortHandler {
+				panic(pv)
+			}
+
+			w.Header().Set("Connection", "close")
+			app.serverErrorResponse(w, r, fmt.Errorf("panic: %v", pv))
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > 128 {
+		return false
+	}
+
+	for _, c := range requestID {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// readOnly rejects every request other than GET, HEAD and OPTIONS when the
+// server runs with -mode=read-only, for example as a horizontally scaled read
+// tier pointed at a replica, or during a view-only maintenance window.
+func (app *application) readOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.config.Mode == ModeReadOnly {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+			default:
+				app.readOnlyModeResponse(w, r)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *application) envelopeMeta(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.config.EnvelopeMeta {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		mw := &metaResponseWriter{
+			ResponseWriter: w,
+			meta: &responseMeta{
+				start:     time.Now(),
+				requestID: app.contextGetRequestID(r),
+			},
+		}
+
+		next.ServeHTTP(mw, r)
+	})
+}
+
+// servedBy sets the X-Served-By header to the region this instance runs in,
+// so clients and operators can tell which region handled a request.
+func (app *application) servedBy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.config.Region != "" {
+			w.Header().Set("X-Served-By", app.config.Region)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate checks the bearer token or API key in the Authorization
+// header, if there is one, and adds the user it was issued to into the
+// request context. When cookie sessions are enabled, requests without an
+// Authorization header can authenticate with the session cookie instead.
+// Requests with neither are treated as coming from the AnonymousUser.
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		authorizationHeader := r.Header.Get("Authorization")
+
+		if authorizationHeader == "" {
+			if app.config.Session.Enabled {
+				w.Header().Add("Vary", "Cookie")
+
+				cookie, err := r.Cookie(sessionCookieName)
+				if err == nil {
+					user, claims, err := app.userForJWT(r.Context(), cookie.Value)
+					if err != nil {
+						switch {
+						case errors.Is(err, errExpiredAuthenticationToken):
+							app.clearSessionCookie(w)
+							app.expiredAuthenticationTokenResponse(w, r)
+						case errors.Is(err, errAuthenticationTokenNotYetValid):
+							app.clearSessionCookie(w)
+							app.authenticationTokenNotYetValidResponse(w, r)
+						case errors.Is(err, errInvalidAuthenticationToken):
+							app.clearSessionCookie(w)
+							app.invalidAuthenticationTokenResponse(w, r)
+						default:
+							app.serverErrorResponse(w, r, err)
+						}
+						return
+					}
+
+					r = app.contextSetUser(r, user)
+					r = app.contextSetAuthenticationJWT(r, claims)
+					r = app.contextSetSessionAuthenticated(r)
+
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			r = app.contextSetUser(r, data.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		headerParts := strings.Split(authorizationHeader, " ")
+		if len(headerParts) != 2 || (headerParts[0] != "Bearer" && headerParts[0] != "ApiKey") {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		token := headerParts[1]
+
+		if headerParts[0] == "ApiKey" {
+			key, user, err := app.models.APIKeys.GetForPlaintext(token)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.invalidAuthenticationTokenResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+
+			if app.config.Mode != ModeReadOnly {
+				err = app.models.APIKeys.Touch(key.ID)
+				if err != nil {
+					app.logError(r, err)
+				}
+			}
+
+			r = app.contextSetUser(r, user)
+			r = app.contextSetAPIKey(r, key)
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if strings.HasPrefix(token, data.PersonalAccessTokenPrefix) {
+			pat, user, err := app.models.PersonalAccessTokens.GetForPlaintext(token)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.invalidAuthenticationTokenResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+
+			if app.config.Mode != ModeReadOnly {
+				err = app.models.PersonalAccessTokens.Touch(pat.ID)
+				if err != nil {
+					app.logError(r, err)
+				}
+			}
+
+			r = app.contextSetUser(r, user)
+			r = app.contextSetPersonalAccessToken(r, pat)
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, claims, err := app.userForJWT(r.Context(), token)
+		if err != nil {
+			switch {
+			case errors.Is(err, errExpiredAuthenticationToken):
+				app.expiredAuthenticationTokenResponse(w, r)
+			case errors.Is(err, errAuthenticationTokenNotYetValid):
+				app.authenticationTokenNotYetValidResponse(w, r)
+			case errors.Is(err, errInvalidAuthenticationToken):
+				app.invalidAuthenticationTokenResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		r = app.contextSetUser(r, user)
+		r = app.contextSetAuthenticationJWT(r, claims)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// csrfProtect requires a valid CSRF token on unsafe requests which were
+// authenticated with the session cookie. Requests authenticated with a bearer
+// token are exempt, because browsers never attach those automatically.
+func (app *application) csrfProtect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !app.contextIsSessionAuthenticated(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cookie, err := r.Cookie(csrfCookieName)
+		if err != nil {
+			app.invalidCSRFTokenResponse(w, r)
+			return
+		}
+
+		header := r.Header.Get(csrfHeaderName)
+
+		if header == "" || subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) != 1 {
+			app.invalidCSRFTokenResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if user.IsAnonymous() {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireScope checks that a request authenticated with a personal access
+// token or an API key was granted the scope. Requests authenticated in other
+// ways, and anonymous requests, aren't scope-restricted.
+//
+// Scopes only restrict the routes which check them: a route without a
+// requireScope accepts every token, whatever it was granted, so a route
+// which tokens shouldn't reach without a particular grant must check one.
+func (app *application) requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token := app.contextGetPersonalAccessToken(r); token != nil && !token.HasScope(scope) {
+			app.insufficientScopeResponse(w, r, scope)
+			return
+		}
+
+		if key := app.contextGetAPIKey(r); key != nil && !key.HasScope(scope) {
+			app.insufficientScopeResponse(w, r, scope)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// requireSession rejects requests authenticated with a personal access
+// token or an API key, for endpoints such as token management which a token
+// must not be able to use to escalate its own access.
+func (app *application) requireSession(next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if app.contextGetPersonalAccessToken(r) != nil || app.contextGetAPIKey(r) != nil {
+			app.sessionRequiredResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireActivatedUser(fn)
+}
+
+// requireRole checks that the user is activated and has the role, or a role
+// which outranks it.
+func (app *application) requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		roles, err := app.models.Roles.GetAllForUser(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !roles.Includes(role) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireActivatedUser(fn)
+}
+
+// requirePermission checks that the user is activated and has been granted
+// the permission.
+func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !permissions.Includes(code) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireActivatedUser(fn)
+}
+
+// requireMovieReader checks that the user has been granted movies:read.
+// With guest access enabled, anonymous clients can read the catalog too,
+// within the guest rate limit. Their requests have already been through
+// the main limiter, so the guest one only ever makes it tighter.
+func (app *application) requireMovieReader(next http.HandlerFunc) http.HandlerFunc {
+	member := app.requirePermission(data.PermissionReadMovies, next)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.guestLimiter == nil || !app.contextGetUser(r).IsAnonymous() {
+			member(w, r)
+			return
+		}
+
+		if app.config.Limiter.Enabled {
+			ip, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			decision, err := app.guestLimiter.take(r.Context(), ip, time.Now())
+			if err != nil {
+				app.logError(r, err)
+			} else if !decision.allowed {
+				app.rateLimitExceededResponse(w, r)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// requireActivatedUser checks that a user is both authenticated and
+// activated.
+func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if !user.Activated {
+			app.inactiveAccountResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+
+	return app.requireAuthenticatedUser(fn)
+}
+
+// rateLimitGraceWindow is the length of the windows counted by the
+// rate limiter's grace mode.
+const rateLimitGraceWindow = time.Minute
+
+// rateLimit enforces a token-bucket rate limit per client IP address. With
+// the memory backend each instance keeps its own buckets, and a background
+// goroutine removes clients which haven't been seen recently, so the map
+// doesn't grow without bound. With the redis backend the buckets are shared
+// by every instance, and expire in Redis instead. If Redis can't be reached
+// the request is let through, so that an outage doesn't take the API down.
+//
+// With -limiter-grace-windows set, a client exceeding the limit isn't
+// rejected straight away. Instead its requests carry an X-RateLimit-Warning
+// header, and an event is logged, for that many one-minute windows in which
+// it goes over; only after that does it get 429 responses. This eases rate
+// limiting in against existing integrations. A client's grace is reset when
+// it is removed for inactivity.
+func (app *application) rateLimit(next http.Handler) http.Handler {
+	store := app.newRateLimitStore("greenlight:ratelimit:", app.config.Limiter.RPS, app.config.Limiter.Burst, app.config.Limiter.GraceWindows)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.config.Limiter.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		decision, err := store.take(r.Context(), ip, time.Now())
+		if err != nil {
+			app.logError(r, err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed := decision.allowed
+		remaining := decision.remaining
+
+		var grace bool
+
+		if !allowed && app.config.Limiter.GraceWindows > 0 {
+			grace = decision.graceUsed <= app.config.Limiter.GraceWindows
+		}
+
+		graceLeft := app.config.Limiter.GraceWindows - decision.graceUsed
+
+		if meta := responseMetaFromWriter(w); meta != nil {
+			meta.rateLimitRemaining = &remaining
+		}
+
+		if grace {
+			w.Header().Set("X-RateLimit-Warning", fmt.Sprintf("rate limit exceeded; %d grace window(s) left before requests are rejected", graceLeft))
+
+			if decision.newWindow {
+				app.requestLogger(r).PrintInfo("rate limit exceeded during grace period", map[string]string{
+					"ip":                 ip,
+					"grace_windows_left": strconv.Itoa(graceLeft),
+				})
+			}
+
+			allowed = true
+		}
+
+		if !allowed {
+			app.rateLimitExceededResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// enableCORS allows cross-origin requests from the trusted origins set with
+// the -cors-trusted-origins flag, and responds to CORS preflight requests
+// from those origins.
+func (app *application) enableCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+
+		origin := r.Header.Get("Origin")
+
+		if origin != "" {
+			for i := range app.config.CORS.TrustedOrigins {
+				if origin == app.config.CORS.TrustedOrigins[i] {
+					w.Header().Set("Access-Control-Allow-Origin", origin)
+
+					// A preflight request is an OPTIONS request which also
+					// has an Access-Control-Request-Method header.
+					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
+						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-CSRF-Token")
+						w.Header().Set("Access-Control-Max-Age", "60")
+
+						w.WriteHeader(http.StatusOK)
+						return
+					}
+
+					break
+				}
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// metricsResponseWriter records the status code of the response, so it can
+// be counted by the metrics middleware.
+type metricsResponseWriter struct {
+	wrapped       http.ResponseWriter
+	statusCode    int
+	headerWritten bool
+}
+
+func newMetricsResponseWriter(w http.ResponseWriter) *metricsResponseWriter {
+	return &metricsResponseWriter{
+		wrapped:    w,
+		statusCode: http.StatusOK,
+	}
+}
+
+func (mw *metricsResponseWriter) Header() http.Header {
+	return mw.wrapped.Header()
+}
+
+func (mw *metricsResponseWriter) WriteHeader(statusCode int) {
+	mw.wrapped.WriteHeader(statusCode)
+
+	if !mw.headerWritten {
+		mw.statusCode = statusCode
+		mw.headerWritten = true
+	}
+}
+
+func (mw *metricsResponseWriter) Write(b []byte) (int, error) {
+	mw.headerWritten = true
+	return mw.wrapped.Write(b)
+}
+
+func (mw *metricsResponseWriter) Unwrap() http.ResponseWriter {
+	return mw.wrapped
+}
+
+// The request metrics are process-wide, since an expvar can only be
+// published once.
+var (
+	totalRequestsReceived           = expvar.NewInt("total_requests_received")
+	totalResponsesSent              = expvar.NewInt("total_responses_sent")
+	totalProcessingTimeMicroseconds = expvar.NewInt("total_processing_time_μs")
+	totalResponsesSentByStatus      = expvar.NewMap("total_responses_sent_by_status")
+)
+
+func (app *application) metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		totalRequestsReceived.Add(1)
+
+		mw := newMetricsResponseWriter(w)
+
+		next.ServeHTTP(mw, r)
+
+		totalResponsesSent.Add(1)
+
+		totalResponsesSentByStatus.Add(strconv.Itoa(mw.statusCode), 1)
+
+		duration := time.Since(start).Microseconds()
+		totalProcessingTimeMicroseconds.Add(duration)
+	})
+}
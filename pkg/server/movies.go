@@ -0,0 +1,424 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+)
+
+func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Title         string       `json:"title"`
+		Year          int32        `json:"year"`
+		Runtime       data.Runtime `json:"runtime"`
+		Genres        []string     `json:"genres"`
+		Certification string       `json:"certification"`
+		Language      string       `json:"language"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	movie := &data.Movie{
+		Title:         input.Title,
+		Year:          input.Year,
+		Runtime:       input.Runtime,
+		Genres:        input.Genres,
+		Certification: input.Certification,
+		Language:      input.Language,
+	}
+
+	v := validator.New()
+
+	err = app.validateMovie(v, movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.write(r, func(m data.Models) error {
+		return m.Movies.Insert(movie)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrUnknownGenre):
+			v.AddError("genres", "contains a genre which no longer exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if app.isDryRun(r) {
+		app.dryRunResponse(w, r, envelope{"movie": movie})
+		return
+	}
+
+	app.moviesChanged()
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Has("as_of") {
+		app.requireRole(data.RoleEditor, app.showMovieAsOfHandler)(w, r)
+		return
+	}
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.getMovieCoalesced(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showMovieAsOfHandler returns a movie as it was at the time in the as_of
+// query string parameter, for reviewing changes to the catalog. History is
+// only available from when revisions started being recorded.
+func (app *application) showMovieAsOfHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	asOf, err := time.Parse(time.RFC3339, r.URL.Query().Get("as_of"))
+	if err != nil {
+		v.AddError("as_of", "must be an RFC 3339 timestamp, such as 2024-01-01T00:00:00Z")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := app.models.Movies.GetAsOf(id, asOf)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie, "as_of": asOf}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Title         string       `json:"title"`
+		Year          int32        `json:"year"`
+		Runtime       data.Runtime `json:"runtime"`
+		Genres        []string     `json:"genres"`
+		Certification string       `json:"certification"`
+		Language      string       `json:"language"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	movie.Title = input.Title
+	movie.Year = input.Year
+	movie.Runtime = input.Runtime
+	movie.Genres = input.Genres
+	movie.Certification = input.Certification
+	movie.Language = input.Language
+
+	v := validator.New()
+
+	err = app.validateMovie(v, movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.write(r, func(m data.Models) error {
+		return m.Movies.Update(movie)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrUnknownGenre):
+			v.AddError("genres", "contains a genre which no longer exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if app.isDryRun(r) {
+		app.dryRunResponse(w, r, envelope{"movie": movie})
+		return
+	}
+
+	app.moviesChanged()
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// patchMovieHandler applies a partial update. The input fields are pointers
+// so that a field which is absent from the request body (nil) can be told
+// apart from one set to its zero value, and only the fields supplied by the
+// client are changed.
+func (app *application) patchMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Title         *string       `json:"title"`
+		Year          *int32        `json:"year"`
+		Runtime       *data.Runtime `json:"runtime"`
+		Genres        []string      `json:"genres"`
+		Certification *string       `json:"certification"`
+		Language      *string       `json:"language"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Title != nil {
+		movie.Title = *input.Title
+	}
+	if input.Year != nil {
+		movie.Year = *input.Year
+	}
+	if input.Runtime != nil {
+		movie.Runtime = *input.Runtime
+	}
+	if input.Genres != nil {
+		movie.Genres = input.Genres
+	}
+	if input.Certification != nil {
+		movie.Certification = *input.Certification
+	}
+	if input.Language != nil {
+		movie.Language = *input.Language
+	}
+
+	v := validator.New()
+
+	err = app.validateMovie(v, movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.write(r, func(m data.Models) error {
+		return m.Movies.Update(movie)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrUnknownGenre):
+			v.AddError("genres", "contains a genre which no longer exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if app.isDryRun(r) {
+		app.dryRunResponse(w, r, envelope{"movie": movie})
+		return
+	}
+
+	app.moviesChanged()
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	posterKey, err := app.models.Movies.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if posterKey != "" {
+		if err := app.storage.Delete(r.Context(), posterKey); err != nil {
+			app.logError(r, err)
+		}
+	}
+
+	app.moviesChanged()
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Title  string
+		Genres []string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Title = app.readString(qs, "title", "")
+	input.Genres = app.readCSV(qs, "genres", []string{})
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortKeys = data.MovieSortKeys
+	input.Filters.MaxPageSize = app.config.Limits.MaxPageSize
+	input.Filters.MaxOffset = app.config.Limits.MaxOffset
+
+	// An after parameter, even an empty one, opts in to keyset pagination.
+	if qs.Has("after") {
+		cursor, err := data.DecodeCursor(qs.Get("after"))
+		if err != nil {
+			v.AddError("after", "must be a next_cursor value from a previous response")
+		}
+		input.Filters.After = &cursor
+	}
+
+	// A snapshot parameter pins the listing to the movies created by then.
+	// An empty one takes a new snapshot, which is returned in the metadata
+	// for the following pages.
+	if qs.Has("snapshot") {
+		snapshot := data.NewSnapshot(time.Now())
+		if qs.Get("snapshot") != "" {
+			var err error
+			snapshot, err = data.DecodeSnapshot(qs.Get("snapshot"))
+			if err != nil {
+				v.AddError("snapshot", "must be a snapshot value from a previous response")
+			}
+		}
+		input.Filters.Snapshot = &snapshot
+	}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	if links := app.paginationLinks(r, metadata); links != "" {
+		headers.Set("Link", links)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movies": movies, "metadata": metadata}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,1076 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// apiAuth is the authentication an operation requires.
+type apiAuth int
+
+const (
+	// authNone operations can be called anonymously, although they still
+	// accept credentials.
+	authNone apiAuth = iota
+	// authUser operations accept any credentials: an authentication JWT,
+	// the session cookie, a personal access token or an API key.
+	authUser
+	// authSession operations only accept an authentication JWT or the
+	// session cookie.
+	authSession
+	// authGuest operations are authUser ones which can also be called
+	// anonymously when guest access is enabled.
+	authGuest
+)
+
+// apiOperation documents one /v1 endpoint. The request and response bodies
+// are described by example envelopes, in the same shape the handlers read
+// and write them, and their schemas are generated from the Go types of the
+// values.
+type apiOperation struct {
+	method  string
+	path    string
+	tag     string
+	summary string
+	auth    apiAuth
+	query   querySpec
+
+	request  envelope
+	status   int
+	response envelope
+
+	// consumes is the media type of the request body, for operations which
+	// don't take a JSON envelope.
+	consumes string
+
+	// produces is the media type of the response, for operations which
+	// don't respond with a JSON envelope.
+	produces string
+
+	// errors are the error statuses specific to the operation. 429 and 500
+	// apply to every operation, 400 and 413 to every operation with a
+	// request body and 401 to every authenticated one, so they're added
+	// automatically.
+	errors []int
+
+	// enabled reports whether the operation is served with the given
+	// configuration. A nil enabled means always.
+	enabled func(cfg Config) bool
+}
+
+var dryRunQuery = querySpec{{name: "dry_run", kind: queryBool}}
+
+var movieInput = envelope{
+	"title":         "",
+	"year":          int32(0),
+	"runtime":       data.Runtime(0),
+	"genres":        []string{},
+	"certification": "",
+	"language":      "",
+}
+
+// uploadedFile stands for a file part in a multipart/form-data request.
+type uploadedFile []byte
+
+var authenticationTokenBody = envelope{"token": "", "expiry": time.Time{}}
+
+// apiOperations lists every /v1 endpoint. routes() refuses to start if a
+// route is missing from the list or the list has a route which doesn't
+// exist, so that the OpenAPI document can't drift from the router.
+var apiOperations = []apiOperation{
+	{
+		method: http.MethodGet, path: "/v1/healthcheck", tag: "status",
+		summary:  "Report that the service is available",
+		status:   http.StatusOK,
+		response: envelope{"status": "", "system_info": map[string]string{}},
+	},
+	{
+		method: http.MethodGet, path: "/v1/readyz", tag: "status",
+		summary:  "Report whether the instance is ready to serve traffic",
+		status:   http.StatusOK,
+		response: envelope{"status": ""},
+		errors:   []int{http.StatusServiceUnavailable},
+	},
+	{
+		method: http.MethodGet, path: "/v1/status", tag: "status",
+		summary: "Summarize the health of each component",
+		status:  http.StatusOK,
+		response: envelope{
+			"status":     "",
+			"components": []componentStatus{},
+			"updated_at": time.Time{},
+			"uptime":     map[string]data.Uptime{},
+			"incidents":  []*data.Incident{},
+		},
+	},
+	{
+		method: http.MethodGet, path: "/v1/status/history", tag: "status",
+		summary: "List the periods in which a component had the same status",
+		query:   statusHistoryQuery,
+		status:  http.StatusOK,
+		response: envelope{
+			"component":   "",
+			"since":       time.Time{},
+			"periods":     []data.HealthPeriod{},
+			"transitions": 0,
+		},
+		errors: []int{http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodGet, path: "/v1/movies", tag: "movies",
+		summary:  "List movies",
+		auth:     authGuest,
+		query:    listMoviesQuery,
+		status:   http.StatusOK,
+		response: envelope{"movies": []*data.Movie{}, "metadata": data.Metadata{}},
+		errors:   []int{http.StatusForbidden, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodPost, path: "/v1/movies", tag: "movies",
+		summary:  "Create a movie",
+		auth:     authUser,
+		query:    dryRunQuery,
+		request:  movieInput,
+		status:   http.StatusCreated,
+		response: envelope{"movie": data.Movie{}},
+		errors:   []int{http.StatusForbidden, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodGet, path: "/v1/movies/random", tag: "movies",
+		summary:  "Show a random movie",
+		auth:     authGuest,
+		query:    randomMovieQuery,
+		status:   http.StatusOK,
+		response: envelope{"movie": data.Movie{}},
+		errors:   []int{http.StatusForbidden, http.StatusNotFound, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodGet, path: "/v1/movies/featured", tag: "movies",
+		summary:  "Show the featured movie of the day",
+		auth:     authGuest,
+		status:   http.StatusOK,
+		response: envelope{"date": "", "movie": data.Movie{}},
+		errors:   []int{http.StatusForbidden, http.StatusNotFound},
+	},
+	{
+		method: http.MethodGet, path: "/v1/movies/:id", tag: "movies",
+		summary:  "Show a movie, or with as_of (editors only) the movie as it was then",
+		auth:     authGuest,
+		query:    querySpec{{name: "as_of", kind: queryString}},
+		status:   http.StatusOK,
+		response: envelope{"movie": data.Movie{}, "as_of": time.Time{}},
+		errors:   []int{http.StatusForbidden, http.StatusNotFound, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodPut, path: "/v1/movies/:id", tag: "movies",
+		summary:  "Replace a movie",
+		auth:     authUser,
+		query:    dryRunQuery,
+		request:  movieInput,
+		status:   http.StatusOK,
+		response: envelope{"movie": data.Movie{}},
+		errors:   []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodPatch, path: "/v1/movies/:id", tag: "movies",
+		summary:  "Update some of the fields of a movie",
+		auth:     authUser,
+		query:    dryRunQuery,
+		request:  movieInput,
+		status:   http.StatusOK,
+		response: envelope{"movie": data.Movie{}},
+		errors:   []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodDelete, path: "/v1/movies/:id", tag: "movies",
+		summary:  "Delete a movie",
+		auth:     authUser,
+		status:   http.StatusOK,
+		response: envelope{"message": ""},
+		errors:   []int{http.StatusForbidden, http.StatusNotFound},
+	},
+	{
+		method: http.MethodPost, path: "/v1/movies/:id/poster", tag: "movies",
+		summary:  "Upload a JPEG, PNG or WebP poster for a movie, replacing any earlier one",
+		auth:     authUser,
+		request:  envelope{"poster": uploadedFile{}},
+		consumes: "multipart/form-data",
+		status:   http.StatusOK,
+		response: envelope{"movie": data.Movie{}},
+		errors:   []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodGet, path: "/v1/feeds/movies.atom", tag: "movies",
+		summary:  "Show an Atom feed of recently added and updated movies",
+		auth:     authGuest,
+		query:    movieFeedQuery,
+		status:   http.StatusOK,
+		produces: "application/atom+xml",
+		errors:   []int{http.StatusForbidden, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodGet, path: "/v1/feeds/movies.rss", tag: "movies",
+		summary:  "Show an RSS feed of recently added and updated movies",
+		auth:     authGuest,
+		query:    movieFeedQuery,
+		status:   http.StatusOK,
+		produces: "application/rss+xml",
+		errors:   []int{http.StatusForbidden, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodGet, path: "/v1/movies/:id/card", tag: "movies",
+		summary:  "Show the OpenGraph and Twitter card tags for a movie",
+		auth:     authGuest,
+		status:   http.StatusOK,
+		response: envelope{"card": envelope{"meta": []cardMeta{}, "html": ""}},
+		errors:   []int{http.StatusForbidden, http.StatusNotFound},
+	},
+	{
+		method: http.MethodGet, path: "/v1/movies/:id/reviews", tag: "reviews",
+		summary:  "List the reviews of a movie",
+		auth:     authGuest,
+		query:    listReviewsQuery,
+		status:   http.StatusOK,
+		response: envelope{"reviews": []*data.Review{}, "metadata": data.Metadata{}},
+		errors:   []int{http.StatusForbidden, http.StatusNotFound, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodPost, path: "/v1/movies/:id/reviews", tag: "reviews",
+		summary:  "Review a movie, once per user",
+		auth:     authUser,
+		request:  envelope{"rating": int32(0), "body": ""},
+		status:   http.StatusCreated,
+		response: envelope{"review": data.Review{}},
+		errors:   []int{http.StatusForbidden, http.StatusNotFound, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodGet, path: "/v1/movies/:id/progress", tag: "progress",
+		summary:  "Show how far the user has watched a movie",
+		auth:     authUser,
+		status:   http.StatusOK,
+		response: envelope{"watch_progress": data.WatchProgress{}},
+		errors:   []int{http.StatusForbidden, http.StatusNotFound},
+	},
+	{
+		method: http.MethodPut, path: "/v1/movies/:id/progress", tag: "progress",
+		summary: "Record how far the user has watched a movie",
+		auth:    authUser,
+		request: envelope{
+			"position_seconds": int32(0),
+			"completed":        false,
+			"device":           "",
+			"updated_at":       time.Time{},
+		},
+		status:   http.StatusOK,
+		response: envelope{"watch_progress": data.WatchProgress{}},
+		errors:   []int{http.StatusForbidden, http.StatusNotFound, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodPost, path: "/v1/users", tag: "users",
+		summary:  "Register a user",
+		request:  envelope{"name": "", "email": "", "password": "", "language": ""},
+		status:   http.StatusAccepted,
+		response: envelope{"user": data.User{}},
+		errors:   []int{http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodPut, path: "/v1/users/activated", tag: "users",
+		summary:  "Activate a user with the token sent by email",
+		request:  envelope{"token": ""},
+		status:   http.StatusOK,
+		response: envelope{"user": data.User{}},
+		errors:   []int{http.StatusConflict, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodPut, path: "/v1/users/email/verified", tag: "users",
+		summary:  "Confirm an email change with the token sent to the new address",
+		request:  envelope{"token": ""},
+		status:   http.StatusOK,
+		response: envelope{"user": data.User{}},
+		errors:   []int{http.StatusConflict, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodPut, path: "/v1/users/password", tag: "users",
+		summary:  "Reset a forgotten password with the token sent by email",
+		request:  envelope{"password": "", "token": ""},
+		status:   http.StatusOK,
+		response: envelope{"message": ""},
+		errors:   []int{http.StatusConflict, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodPut, path: "/v1/users/me/email", tag: "users",
+		summary:  "Start changing the user's email address",
+		auth:     authSession,
+		request:  envelope{"email": "", "password": ""},
+		status:   http.StatusAccepted,
+		response: envelope{"message": ""},
+		errors:   []int{http.StatusForbidden, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodPut, path: "/v1/users/me/password", tag: "users",
+		summary: "Change the user's password",
+		auth:    authSession,
+		request: envelope{"current_password": "", "password": ""},
+		status:  http.StatusOK,
+		response: envelope{
+			"message":              "",
+			"authentication_token": authenticationTokenBody,
+			"session":              envelope{"expiry": time.Time{}},
+		},
+		errors: []int{http.StatusForbidden, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodPost, path: "/v1/users/me/totp", tag: "users",
+		summary: "Start enrolling in two-factor authentication",
+		auth:    authSession,
+		request: envelope{"current_password": ""},
+		status:  http.StatusCreated,
+		response: envelope{"totp": envelope{
+			"secret":           "",
+			"provisioning_uri": "",
+			"recovery_codes":   []string{},
+		}},
+		errors: []int{http.StatusForbidden, http.StatusConflict, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodPost, path: "/v1/users/me/totp/confirm", tag: "users",
+		summary:  "Enable two-factor authentication with a code from the authenticator",
+		auth:     authSession,
+		request:  envelope{"code": ""},
+		status:   http.StatusOK,
+		response: envelope{"message": ""},
+		errors:   []int{http.StatusForbidden, http.StatusConflict, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodGet, path: "/v1/users/me/progress", tag: "progress",
+		summary:  "List the movies the user has started but not finished",
+		auth:     authUser,
+		status:   http.StatusOK,
+		response: envelope{"watch_progress": []*data.WatchProgress{}},
+		errors:   []int{http.StatusForbidden},
+	},
+	{
+		method: http.MethodGet, path: "/v1/me/watchlist", tag: "watchlist",
+		summary:  "List the movies on the user's watchlist",
+		auth:     authUser,
+		query:    listWatchlistQuery,
+		status:   http.StatusOK,
+		response: envelope{"watchlist": []*data.WatchlistItem{}, "metadata": data.Metadata{}},
+		errors:   []int{http.StatusForbidden, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodPost, path: "/v1/me/watchlist", tag: "watchlist",
+		summary:  "Add a movie to the user's watchlist",
+		auth:     authUser,
+		request:  envelope{"movie_id": int64(0)},
+		status:   http.StatusCreated,
+		response: envelope{"watchlist_item": data.WatchlistItem{}},
+		errors:   []int{http.StatusForbidden, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodDelete, path: "/v1/me/watchlist/:id", tag: "watchlist",
+		summary:  "Remove a movie from the user's watchlist",
+		auth:     authUser,
+		status:   http.StatusOK,
+		response: envelope{"message": ""},
+		errors:   []int{http.StatusForbidden, http.StatusNotFound},
+	},
+	{
+		method: http.MethodGet, path: "/v1/users/me/tokens", tag: "tokens",
+		summary:  "List the user's personal access tokens",
+		auth:     authSession,
+		status:   http.StatusOK,
+		response: envelope{"personal_access_tokens": []*data.PersonalAccessToken{}},
+		errors:   []int{http.StatusForbidden},
+	},
+	{
+		method: http.MethodPost, path: "/v1/users/me/tokens", tag: "tokens",
+		summary:  "Create a personal access token",
+		auth:     authSession,
+		request:  envelope{"name": "", "scopes": []string{}, "expiry": time.Time{}},
+		status:   http.StatusCreated,
+		response: envelope{"personal_access_token": data.PersonalAccessToken{}},
+		errors:   []int{http.StatusForbidden, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodDelete, path: "/v1/users/me/tokens/:id", tag: "tokens",
+		summary:  "Revoke a personal access token",
+		auth:     authSession,
+		status:   http.StatusOK,
+		response: envelope{"message": ""},
+		errors:   []int{http.StatusForbidden, http.StatusNotFound},
+	},
+	{
+		method: http.MethodGet, path: "/v1/users/me/api-keys", tag: "tokens",
+		summary:  "List the user's API keys",
+		auth:     authSession,
+		status:   http.StatusOK,
+		response: envelope{"api_keys": []*data.APIKey{}},
+		errors:   []int{http.StatusForbidden},
+	},
+	{
+		method: http.MethodPost, path: "/v1/users/me/api-keys", tag: "tokens",
+		summary:  "Create an API key",
+		auth:     authSession,
+		request:  envelope{"name": "", "scopes": []string{}},
+		status:   http.StatusCreated,
+		response: envelope{"api_key": data.APIKey{}},
+		errors:   []int{http.StatusForbidden, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodDelete, path: "/v1/users/me/api-keys/:id", tag: "tokens",
+		summary:  "Revoke an API key",
+		auth:     authSession,
+		status:   http.StatusOK,
+		response: envelope{"message": ""},
+		errors:   []int{http.StatusForbidden, http.StatusNotFound},
+	},
+	{
+		method: http.MethodGet, path: "/v1/admin/users", tag: "admin",
+		summary:  "List users",
+		auth:     authSession,
+		query:    listUsersQuery,
+		status:   http.StatusOK,
+		response: envelope{"users": []*data.User{}, "metadata": data.Metadata{}},
+		errors:   []int{http.StatusForbidden, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodGet, path: "/v1/admin/users/:id/roles", tag: "admin",
+		summary:  "Show the roles of a user",
+		auth:     authSession,
+		status:   http.StatusOK,
+		response: envelope{"roles": data.Roles{}},
+		errors:   []int{http.StatusForbidden, http.StatusNotFound},
+	},
+	{
+		method: http.MethodPut, path: "/v1/admin/users/:id/roles", tag: "admin",
+		summary:  "Replace the roles of a user",
+		auth:     authSession,
+		request:  envelope{"roles": data.Roles{}},
+		status:   http.StatusOK,
+		response: envelope{"roles": data.Roles{}},
+		errors:   []int{http.StatusForbidden, http.StatusNotFound, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodGet, path: "/v1/vocabularies", tag: "vocabularies",
+		summary:  "List the terms of every vocabulary",
+		status:   http.StatusOK,
+		response: envelope{"vocabularies": data.Vocabularies{}},
+	},
+	{
+		method: http.MethodGet, path: "/v1/vocabularies/:name", tag: "vocabularies",
+		summary:  "List the terms of a vocabulary",
+		status:   http.StatusOK,
+		response: envelope{"vocabulary": "", "terms": []data.Term{}},
+		errors:   []int{http.StatusNotFound},
+	},
+	{
+		method: http.MethodGet, path: "/v1/genres", tag: "vocabularies",
+		summary:  "List the genres with how many movies are filed under each",
+		status:   http.StatusOK,
+		response: envelope{"genres": []data.Genre{}},
+	},
+	{
+		method: http.MethodPost, path: "/v1/admin/vocabularies/:name", tag: "admin",
+		summary:  "Add a term to a vocabulary",
+		auth:     authSession,
+		request:  envelope{"value": "", "label": ""},
+		status:   http.StatusCreated,
+		response: envelope{"term": data.Term{}},
+		errors:   []int{http.StatusForbidden, http.StatusNotFound, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodPatch, path: "/v1/admin/vocabularies/:name/:value", tag: "admin",
+		summary:  "Change the label of a term",
+		auth:     authSession,
+		request:  envelope{"label": ""},
+		status:   http.StatusOK,
+		response: envelope{"term": data.Term{}},
+		errors:   []int{http.StatusForbidden, http.StatusNotFound, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodDelete, path: "/v1/admin/vocabularies/:name/:value", tag: "admin",
+		summary:  "Delete a term from a vocabulary",
+		auth:     authSession,
+		status:   http.StatusOK,
+		response: envelope{"message": ""},
+		errors:   []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict},
+	},
+	{
+		method: http.MethodGet, path: "/v1/admin/email-checks", tag: "admin",
+		summary:  "Report on the latest email check",
+		auth:     authSession,
+		status:   http.StatusOK,
+		response: envelope{"email_check": emailCheckState{}, "statuses": map[string]int{}},
+		errors:   []int{http.StatusForbidden},
+	},
+	{
+		method: http.MethodPost, path: "/v1/admin/email-checks", tag: "admin",
+		summary:  "Start checking the email address of every user",
+		auth:     authSession,
+		status:   http.StatusAccepted,
+		response: envelope{"email_check": emailCheckState{}},
+		errors:   []int{http.StatusForbidden, http.StatusConflict},
+	},
+	{
+		method: http.MethodPost, path: "/v1/admin/email-suppressions", tag: "admin",
+		summary:  "Suppress an email address",
+		auth:     authSession,
+		request:  envelope{"email": "", "reason": ""},
+		status:   http.StatusCreated,
+		response: envelope{"suppression": data.EmailSuppression{}},
+		errors:   []int{http.StatusForbidden, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodDelete, path: "/v1/admin/email-suppressions/:email", tag: "admin",
+		summary:  "Lift the suppression of an email address",
+		auth:     authSession,
+		status:   http.StatusOK,
+		response: envelope{"message": ""},
+		errors:   []int{http.StatusForbidden, http.StatusNotFound},
+	},
+	{
+		method: http.MethodPost, path: "/v1/admin/ratings/reconcile", tag: "admin",
+		summary:  "Check the movies' rating counters against their reviews, and correct any which have drifted",
+		auth:     authSession,
+		query:    dryRunQuery,
+		status:   http.StatusOK,
+		response: envelope{"drift": []data.RatingDrift{}},
+		errors:   []int{http.StatusForbidden},
+	},
+	{
+		method: http.MethodPost, path: "/v1/admin/incidents", tag: "admin",
+		summary:  "Open an incident on the status page",
+		auth:     authSession,
+		request:  envelope{"title": "", "body": "", "status": "", "components": []string{}},
+		status:   http.StatusCreated,
+		response: envelope{"incident": data.Incident{}},
+		errors:   []int{http.StatusForbidden, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodPatch, path: "/v1/admin/incidents/:id", tag: "admin",
+		summary:  "Update an incident",
+		auth:     authSession,
+		request:  envelope{"title": "", "body": "", "status": "", "components": []string{}},
+		status:   http.StatusOK,
+		response: envelope{"incident": data.Incident{}},
+		errors:   []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodDelete, path: "/v1/admin/incidents/:id", tag: "admin",
+		summary:  "Delete an incident",
+		auth:     authSession,
+		status:   http.StatusOK,
+		response: envelope{"message": ""},
+		errors:   []int{http.StatusForbidden, http.StatusNotFound},
+	},
+	{
+		method: http.MethodPost, path: "/v1/tokens/authentication", tag: "tokens",
+		summary: "Exchange an email address and password for an authentication token, or a session cookie",
+		request: envelope{
+			"email":         "",
+			"password":      "",
+			"totp_code":     "",
+			"recovery_code": "",
+			"cookie":        false,
+		},
+		status: http.StatusCreated,
+		response: envelope{
+			"authentication_token": authenticationTokenBody,
+			"session":              envelope{"expiry": time.Time{}, "csrf_token": ""},
+		},
+		errors: []int{http.StatusUnauthorized, http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodDelete, path: "/v1/tokens/authentication", tag: "tokens",
+		summary:  "Revoke the authentication token used for the request",
+		auth:     authUser,
+		status:   http.StatusOK,
+		response: envelope{"message": ""},
+	},
+	{
+		method: http.MethodPost, path: "/v1/tokens/password-reset", tag: "tokens",
+		summary:  "Email the user a token to reset their password with",
+		request:  envelope{"email": ""},
+		status:   http.StatusAccepted,
+		response: envelope{"message": ""},
+		errors:   []int{http.StatusUnprocessableEntity},
+	},
+	{
+		method: http.MethodPost, path: "/v1/events", tag: "analytics",
+		summary:  "Record a batch of analytics events",
+		request:  envelope{"events": []data.AnalyticsEvent{}},
+		status:   http.StatusAccepted,
+		response: envelope{"received": 0, "accepted": 0},
+		errors:   []int{http.StatusUnprocessableEntity},
+		enabled:  func(cfg Config) bool { return cfg.Analytics.Enabled },
+	},
+	{
+		method: http.MethodPost, path: "/v1/tokens/csrf", tag: "tokens",
+		summary:  "Issue a CSRF token for the session",
+		status:   http.StatusCreated,
+		response: envelope{"csrf_token": ""},
+		enabled:  func(cfg Config) bool { return cfg.Session.Enabled },
+	},
+	{
+		method: http.MethodGet, path: "/v1/openapi.json", tag: "status",
+		summary:  "Show this OpenAPI document",
+		status:   http.StatusOK,
+		produces: "application/json",
+	},
+}
+
+// errorDescriptions describe the error responses in the document. Every
+// error has the same shape, with error holding either a message or, for
+// 422 responses, a message for each invalid field.
+var errorDescriptions = map[int]string{
+	http.StatusBadRequest:            "The request body is malformed.",
+	http.StatusUnauthorized:          "The credentials are missing, invalid or expired.",
+	http.StatusForbidden:             "The user isn't permitted to do this.",
+	http.StatusNotFound:              "The resource doesn't exist.",
+	http.StatusConflict:              "The resource was changed by another request.",
+	http.StatusRequestEntityTooLarge: "The request body is too large.",
+	http.StatusUnprocessableEntity:   "The request failed validation.",
+	http.StatusTooManyRequests:       "The client is over the rate limit.",
+	http.StatusInternalServerError:   "The server encountered a problem.",
+	http.StatusServiceUnavailable:    "The service, or a dependency of it, is unavailable.",
+}
+
+// checkAPIOperations reports an error if a /v1 route isn't documented by an
+// operation, or an enabled operation doesn't match a route.
+func checkAPIOperations(router *apiRouter, ops []apiOperation, cfg Config) error {
+	documented := make(map[string]bool, len(ops))
+
+	for _, op := range ops {
+		if op.enabled != nil && !op.enabled(cfg) {
+			continue
+		}
+
+		documented[op.method+" "+op.path] = true
+
+		// Static paths such as /v1/movies/random are served by a wildcard
+		// route, so look the operation up the way a request would be.
+		handle, _, _ := router.Lookup(op.method, op.path)
+		if handle == nil {
+			return fmt.Errorf("the API operation %s %s has no route", op.method, op.path)
+		}
+	}
+
+	for _, route := range router.registered {
+		_, path, _ := strings.Cut(route, " ")
+		if strings.HasPrefix(path, "/v1/") && !documented[route] {
+			return fmt.Errorf("the route %s isn't documented in apiOperations", route)
+		}
+	}
+
+	return nil
+}
+
+// apiRouter records the routes registered on it, so that they can be
+// checked against apiOperations.
+type apiRouter struct {
+	*httprouter.Router
+	registered []string
+}
+
+func (r *apiRouter) Handler(method, path string, handler http.Handler) {
+	r.registered = append(r.registered, method+" "+path)
+	r.Router.Handler(method, path, handler)
+}
+
+func (r *apiRouter) HandlerFunc(method, path string, handler http.HandlerFunc) {
+	r.Handler(method, path, handler)
+}
+
+// openAPIDocument generates the OpenAPI 3 document describing the enabled
+// operations.
+func (app *application) openAPIDocument() ([]byte, error) {
+	g := &schemaGenerator{components: make(map[string]any)}
+
+	paths := make(map[string]map[string]any)
+
+	for _, op := range apiOperations {
+		if op.enabled != nil && !op.enabled(app.config) {
+			continue
+		}
+
+		path, params := openAPIPath(op.path)
+
+		for _, param := range op.query {
+			params = append(params, map[string]any{
+				"name":   param.name,
+				"in":     "query",
+				"schema": queryParamSchema(param),
+			})
+		}
+
+		operation := map[string]any{
+			"operationId": operationID(op.method, op.path),
+			"summary":     op.summary,
+			"tags":        []string{op.tag},
+		}
+
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+
+		auth := op.auth
+		if auth == authGuest {
+			auth = authUser
+			if app.config.Guest.Enabled {
+				auth = authNone
+			}
+		}
+
+		switch auth {
+		case authUser:
+			operation["security"] = []map[string][]string{{"bearerAuth": {}}, {"apiKeyAuth": {}}, {"cookieAuth": {}}}
+		case authSession:
+			operation["security"] = []map[string][]string{{"bearerAuth": {}}, {"cookieAuth": {}}}
+		}
+
+		statuses := slices.Clone(op.errors)
+		statuses = append(statuses, http.StatusTooManyRequests, http.StatusInternalServerError)
+
+		if op.request != nil {
+			consumes := op.consumes
+			if consumes == "" {
+				consumes = "application/json"
+			}
+
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					consumes: map[string]any{"schema": g.schema(reflect.ValueOf(op.request))},
+				},
+			}
+			statuses = append(statuses, http.StatusBadRequest, http.StatusRequestEntityTooLarge)
+		}
+
+		if auth != authNone {
+			statuses = append(statuses, http.StatusUnauthorized)
+		}
+
+		responses := map[string]any{}
+
+		success := map[string]any{"description": http.StatusText(op.status)}
+		if op.produces != "" {
+			success["content"] = map[string]any{op.produces: map[string]any{}}
+		} else {
+			success["content"] = map[string]any{
+				"application/json": map[string]any{"schema": g.schema(reflect.ValueOf(op.response))},
+			}
+		}
+		responses[fmt.Sprint(op.status)] = success
+
+		for _, status := range statuses {
+			responses[fmt.Sprint(status)] = map[string]any{"$ref": fmt.Sprintf("#/components/responses/%d", status)}
+		}
+
+		operation["responses"] = responses
+
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+		paths[path][strings.ToLower(op.method)] = operation
+	}
+
+	errorResponses := make(map[string]any, len(errorDescriptions))
+	for status, description := range errorDescriptions {
+		errorResponses[fmt.Sprint(status)] = map[string]any{
+			"description": description,
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Error"}},
+			},
+		}
+	}
+
+	g.components["Error"] = map[string]any{
+		"type":     "object",
+		"required": []string{"error"},
+		"properties": map[string]any{
+			"error": map[string]any{
+				"oneOf": []any{
+					map[string]any{"type": "string"},
+					map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}},
+				},
+			},
+			"request_id": map[string]any{"type": "string"},
+		},
+	}
+
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Greenlight API",
+			"version": version,
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas":   g.components,
+			"responses": errorResponses,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{
+					"type":         "http",
+					"scheme":       "bearer",
+					"description":  "An authentication JWT or a personal access token.",
+					"bearerFormat": "JWT",
+				},
+				"apiKeyAuth": map[string]any{
+					"type":        "apiKey",
+					"in":          "header",
+					"name":        "Authorization",
+					"description": `An API key, as "ApiKey <key>".`,
+				},
+				"cookieAuth": map[string]any{
+					"type": "apiKey",
+					"in":   "cookie",
+					"name": sessionCookieName,
+				},
+			},
+		},
+	}
+
+	return json.MarshalIndent(doc, "", "\t")
+}
+
+// openAPIPath converts a router path such as /v1/movies/:id into its
+// OpenAPI form, /v1/movies/{id}, along with its path parameters.
+func openAPIPath(path string) (string, []any) {
+	segments := strings.Split(path, "/")
+	var params []any
+
+	for i, segment := range segments {
+		name, ok := strings.CutPrefix(segment, ":")
+		if !ok {
+			continue
+		}
+
+		schema := map[string]any{"type": "string"}
+		if name == "id" {
+			schema = map[string]any{"type": "integer", "format": "int64", "minimum": 1}
+		}
+
+		params = append(params, map[string]any{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   schema,
+		})
+
+		segments[i] = "{" + name + "}"
+	}
+
+	return strings.Join(segments, "/"), params
+}
+
+// operationID derives an ID such as putV1MoviesIdProgress from the method
+// and path.
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == ':' || r == '-' || r == '.' }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+
+	return b.String()
+}
+
+func queryParamSchema(param queryParam) map[string]any {
+	var schema map[string]any
+
+	switch param.kind {
+	case queryInt:
+		schema = map[string]any{"type": "integer"}
+		if param.min != 0 || param.max != 0 {
+			schema["minimum"] = param.min
+			schema["maximum"] = param.max
+		}
+	case queryBool:
+		schema = map[string]any{"type": "boolean"}
+	case queryCSV:
+		schema = map[string]any{"type": "string", "description": "A comma-separated list."}
+	default:
+		schema = map[string]any{"type": "string"}
+	}
+
+	if param.def != "" {
+		schema["default"] = param.def
+	}
+
+	return schema
+}
+
+// schemaGenerator generates JSON schemas from Go values. Exported named
+// struct types become components, referenced by name, and everything else
+// is inlined.
+type schemaGenerator struct {
+	components map[string]any
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	runtimeType = reflect.TypeOf(data.Runtime(0))
+	fileType    = reflect.TypeOf(uploadedFile(nil))
+)
+
+// schema describes v. Maps such as envelopes are described by the values
+// they hold, so that an example envelope documents its own keys.
+func (g *schemaGenerator) schema(v reflect.Value) map[string]any {
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return map[string]any{}
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String && v.Len() > 0 {
+		keys := make([]string, 0, v.Len())
+		for _, key := range v.MapKeys() {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+
+		properties := make(map[string]any, len(keys))
+		for _, key := range keys {
+			properties[key] = g.schema(v.MapIndex(reflect.ValueOf(key)))
+		}
+
+		return map[string]any{"type": "object", "properties": properties}
+	}
+
+	return g.typeSchema(v.Type())
+}
+
+func (g *schemaGenerator) typeSchema(t reflect.Type) map[string]any {
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case runtimeType:
+		return map[string]any{"type": "string", "pattern": "^[0-9]+ mins$", "example": "102 mins"}
+	case fileType:
+		return map[string]any{"type": "string", "format": "binary"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := g.typeSchema(t.Elem())
+		if _, ok := schema["$ref"]; ok {
+			return schema
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int32, reflect.Uint32:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.typeSchema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" || !token.IsExported(t.Name()) {
+			return g.structSchema(t)
+		}
+
+		if _, ok := g.components[t.Name()]; !ok {
+			// Reserve the name first, in case the type refers to itself.
+			g.components[t.Name()] = nil
+			g.components[t.Name()] = g.structSchema(t)
+		}
+
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	}
+
+	return map[string]any{}
+}
+
+// structSchema describes the fields of a struct the way encoding/json
+// encodes them. Fields which aren't omitempty are always present, so
+// they're required.
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = g.typeSchema(field.Type)
+
+		if !strings.Contains(options, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+
+	return schema
+}
+
+// openAPIHandler serves the OpenAPI document, which is generated once at
+// startup.
+func (app *application) openAPIHandler(doc []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(doc)
+	}
+}
+
+// docsPage loads Swagger UI from a CDN and points it at the OpenAPI
+// document.
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Greenlight API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>
+window.ui = SwaggerUIBundle({url: "/v1/openapi.json", dom_id: "#swagger-ui"});
+</script>
+</body>
+</html>
+`
+
+// docsHandler serves Swagger UI. It's only mounted outside production.
+func (app *application) docsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(docsPage))
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+)
+
+// checkPasswordBreached adds a validation error if -password-breach-check is
+// set and the password appears in a known data breach. If the check can't be
+// made, the error is logged and the password allowed, so that an outage of
+// the Pwned Passwords API doesn't block sign-ups.
+func (app *application) checkPasswordBreached(r *http.Request, v *validator.Validator, password string) {
+	if app.pwned == nil {
+		return
+	}
+
+	count, err := app.pwned.Count(r.Context(), password)
+	if err != nil {
+		app.logError(r, err)
+		return
+	}
+
+	v.Check(count == 0, "password", "has appeared in a data breach, so it must not be used")
+}
+
+// passwordHasher returns the hasher for new passwords. The parameters have
+// already been range-checked by validate.
+func (cfg Config) passwordHasher() data.PasswordHasher {
+	if cfg.Passwords.Hasher == PasswordHasherArgon2id {
+		return data.Argon2idHasher{
+			Memory:  uint32(cfg.Passwords.Argon2.Memory),
+			Time:    uint32(cfg.Passwords.Argon2.Time),
+			Threads: uint8(cfg.Passwords.Argon2.Threads),
+		}
+	}
+
+	return data.BcryptHasher{Cost: cfg.Passwords.BcryptCost}
+}
+
+// rehashPassword replaces the user's stored hash after a successful login
+// when it was made with an older algorithm or parameters. The plaintext is
+// only available at login, so this is the one chance to upgrade it. Failures
+// are logged rather than returned, since the login itself has succeeded.
+func (app *application) rehashPassword(r *http.Request, user *data.User, plaintext string) {
+	if app.config.Mode == ModeReadOnly || !user.Password.NeedsRehash() {
+		return
+	}
+
+	err := user.Password.Set(plaintext)
+	if err == nil {
+		err = app.models.Users.UpdatePasswordHash(user)
+	}
+	if err != nil {
+		app.logError(r, fmt.Errorf("rehash password: %w", err))
+	}
+}
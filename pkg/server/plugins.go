@@ -0,0 +1,97 @@
+package server
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+	"github.com/agung-learns/ebook-go-further/pkg/plugin"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// pluginHost implements plugin.Host on top of the application.
+type pluginHost struct {
+	app *application
+}
+
+func (h pluginHost) DB() *sql.DB {
+	return h.app.models.DB()
+}
+
+func (h pluginHost) LogInfo(message string, properties map[string]string) {
+	h.app.logger.PrintInfo(message, properties)
+}
+
+func (h pluginHost) LogError(err error, properties map[string]string) {
+	h.app.logger.PrintError(err, properties)
+}
+
+func (h pluginHost) User(r *http.Request) (plugin.User, bool) {
+	user := h.app.contextGetUser(r)
+	if user.IsAnonymous() {
+		return plugin.User{}, false
+	}
+
+	return plugin.User{ID: user.ID, Name: user.Name, Email: user.Email, Activated: user.Activated}, true
+}
+
+func (h pluginHost) RequireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return h.app.requireActivatedUser(next)
+}
+
+func (h pluginHost) ReadJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	return h.app.readJSON(w, r, dst)
+}
+
+func (h pluginHost) WriteJSON(w http.ResponseWriter, status int, data map[string]any, headers http.Header) error {
+	return h.app.writeJSON(w, status, data, headers)
+}
+
+func (h pluginHost) ErrorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
+	h.app.errorResponse(w, r, status, message)
+}
+
+func (h pluginHost) ServerErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	h.app.serverErrorResponse(w, r, err)
+}
+
+// decorateModels passes the models' querier through every registered
+// plugin's WrapQuerier function.
+func decorateModels(models data.Models) data.Models {
+	for _, p := range plugin.All() {
+		if p.WrapQuerier != nil {
+			models = models.WrapQueriers(func(q data.Querier) data.Querier {
+				return p.WrapQuerier(q)
+			})
+		}
+	}
+
+	return models
+}
+
+// pluginRoutes registers the routes of every plugin on the router, and
+// returns the router wrapped in the plugins' middleware.
+func (app *application) pluginRoutes(router *httprouter.Router) http.Handler {
+	host := pluginHost{app: app}
+
+	var handler http.Handler = router
+
+	for _, p := range plugin.All() {
+		if p.Routes != nil {
+			for _, route := range p.Routes(host) {
+				router.Handler(route.Method, route.Path, route.Handler)
+			}
+		}
+
+		if p.Middleware != nil {
+			for _, middleware := range p.Middleware(host) {
+				handler = middleware(handler)
+			}
+		}
+
+		app.logger.PrintInfo("plugin enabled", map[string]string{"plugin": p.Name})
+	}
+
+	return handler
+}
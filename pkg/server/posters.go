@@ -0,0 +1,185 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+)
+
+// uploadsPath is where the API serves the disk storage directory.
+const uploadsPath = "/uploads"
+
+// posterExtensions maps the accepted poster image types to the extension
+// their files are stored with.
+var posterExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// multipartOverhead is allowed on top of the poster size limit, for the
+// part headers and boundaries of the request body.
+const multipartOverhead = 64 * 1024
+
+var errNoPosterPart = errors.New("body must be multipart/form-data with a poster file")
+
+// readPoster returns the contents of the "poster" part of a multipart
+// request body. Other parts are skipped. A poster over the size limit is
+// reported as a bodyTooLargeError, so that it gets a 413.
+func (app *application) readPoster(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	maxBytes := app.config.Limits.MaxPosterSize
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+multipartOverhead)
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, errNoPosterPart
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			switch {
+			case errors.As(err, &maxBytesError):
+				return nil, &bodyTooLargeError{Limit: maxBytes}
+			case errors.Is(err, io.EOF):
+				return nil, errNoPosterPart
+			default:
+				return nil, fmt.Errorf("body contains badly-formed multipart data: %w", err)
+			}
+		}
+
+		if part.FormName() != "poster" || part.FileName() == "" {
+			continue
+		}
+
+		poster, err := io.ReadAll(io.LimitReader(part, maxBytes+1))
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				return nil, &bodyTooLargeError{Limit: maxBytes}
+			}
+			return nil, fmt.Errorf("body contains badly-formed multipart data: %w", err)
+		}
+
+		if int64(len(poster)) > maxBytes {
+			return nil, &bodyTooLargeError{Limit: maxBytes}
+		}
+
+		return poster, nil
+	}
+}
+
+// uploadPosterHandler stores a new poster for the movie and points the
+// movie at it. The image type is sniffed from the file's contents, not
+// taken from the request, and each upload gets a new key so that cached
+// copies of an earlier poster aren't served in its place. The earlier
+// poster is deleted once the movie no longer refers to it.
+func (app *application) uploadPosterHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	poster, err := app.readPoster(w, r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	contentType := http.DetectContentType(poster)
+
+	v := validator.New()
+
+	v.Check(len(poster) > 0, "poster", "must not be empty")
+	if _, ok := posterExtensions[contentType]; !ok {
+		v.AddError("poster", "must be a JPEG, PNG or WebP image")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	randomBytes := make([]byte, 8)
+	_, err = rand.Read(randomBytes)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	key := fmt.Sprintf("posters/%d-%s%s", movie.ID, hex.EncodeToString(randomBytes), posterExtensions[contentType])
+
+	err = app.storage.Put(r.Context(), key, contentType, poster)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	oldKey := movie.PosterKey
+	movie.PosterKey = key
+	movie.PosterURL = app.storage.URL(key)
+
+	err = app.models.Movies.UpdatePoster(movie)
+	if err != nil {
+		if err := app.storage.Delete(r.Context(), key); err != nil {
+			app.logError(r, err)
+		}
+
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if oldKey != "" {
+		if err := app.storage.Delete(r.Context(), oldKey); err != nil {
+			app.logError(r, err)
+		}
+	}
+
+	app.moviesChanged()
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// uploadsHandler serves the files kept by the disk storage backend. Paths
+// ending in a slash are refused, so that the directories aren't listed.
+func (app *application) uploadsHandler() http.Handler {
+	files := http.StripPrefix(uploadsPath, http.FileServer(http.Dir(app.config.Storage.Disk.Dir)))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+)
+
+// queryKind is the type a query string parameter must parse as.
+type queryKind int
+
+const (
+	queryString queryKind = iota
+	queryInt
+	queryBool
+	queryCSV
+)
+
+// queryParam declares one query string parameter accepted by a route. A
+// non-empty def is added to the query when the parameter is missing, so the
+// handler, the response cache key and the pagination links all see it. For
+// integers, min and max are enforced when either is non-zero.
+type queryParam struct {
+	name     string
+	kind     queryKind
+	def      string
+	min, max int
+}
+
+// querySpec lists every query string parameter a route accepts.
+type querySpec []queryParam
+
+// listMoviesQuery leaves page_size unbounded, because its maximum is
+// configurable and checked by data.ValidateFilters.
+var listMoviesQuery = querySpec{
+	{name: "title", kind: queryString},
+	{name: "genres", kind: queryCSV},
+	{name: "page", kind: queryInt, def: "1", min: 1, max: 10_000_000},
+	{name: "page_size", kind: queryInt, def: "20"},
+	{name: "sort", kind: queryString, def: "id"},
+	{name: "after", kind: queryString},
+	{name: "snapshot", kind: queryString},
+}
+
+var listUsersQuery = querySpec{
+	{name: "email", kind: queryString},
+	{name: "email_status", kind: queryString},
+	{name: "page", kind: queryInt, def: "1", min: 1, max: 10_000_000},
+	{name: "page_size", kind: queryInt, def: "20"},
+	{name: "sort", kind: queryString, def: "id"},
+}
+
+var statusHistoryQuery = querySpec{
+	{name: "component", kind: queryString, def: componentDatabase},
+	{name: "hours", kind: queryInt, def: "24", min: 1, max: 30 * 24},
+}
+
+var randomMovieQuery = querySpec{
+	{name: "genres", kind: queryCSV},
+	{name: "decade", kind: queryInt},
+}
+
+// validateQuery checks the query string against the spec before calling
+// next. Unknown parameters are rejected, with a suggestion when they look
+// like a typo of a known one, so that a request such as ?page_szie=2 fails
+// instead of silently being ignored.
+func (app *application) validateQuery(spec querySpec, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		qs := r.URL.Query()
+		v := validator.New()
+
+		for key := range qs {
+			if spec.lookup(key) != nil {
+				continue
+			}
+
+			message := "is not a known query parameter"
+			if suggestion := spec.closest(key); suggestion != "" {
+				message = fmt.Sprintf("%s (did you mean %q?)", message, suggestion)
+			}
+
+			v.AddError(key, message)
+		}
+
+		for _, param := range spec {
+			value := qs.Get(param.name)
+
+			if value == "" {
+				if param.def != "" {
+					qs.Set(param.name, param.def)
+				}
+				continue
+			}
+
+			switch param.kind {
+			case queryInt:
+				i, err := strconv.Atoi(value)
+				if err != nil {
+					v.AddError(param.name, "must be an integer value")
+					continue
+				}
+
+				if param.min != 0 || param.max != 0 {
+					v.Check(i >= param.min, param.name, fmt.Sprintf("must be greater than or equal to %d", param.min))
+					v.Check(i <= param.max, param.name, fmt.Sprintf("must be a maximum of %d", param.max))
+				}
+			case queryBool:
+				_, err := strconv.ParseBool(value)
+				v.Check(err == nil, param.name, "must be a boolean value")
+			}
+		}
+
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		r.URL.RawQuery = qs.Encode()
+
+		next(w, r)
+	}
+}
+
+func (spec querySpec) lookup(name string) *queryParam {
+	for i := range spec {
+		if spec[i].name == name {
+			return &spec[i]
+		}
+	}
+
+	return nil
+}
+
+// closest returns the known parameter nearest to name, if it is within two
+// single-character edits.
+func (spec querySpec) closest(name string) string {
+	best, bestDistance := "", 3
+
+	for _, param := range spec {
+		if d := editDistance(name, param.name); d < bestDistance {
+			best, bestDistance = param.name, d
+		}
+	}
+
+	return best
+}
+
+// editDistance returns the Damerau-Levenshtein (optimal string alignment)
+// distance between a and b, which counts a swap of two adjacent characters
+// as a single edit.
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return d[len(a)][len(b)]
+}
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/cache"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	LimiterBackendMemory = "memory"
+	LimiterBackendRedis  = "redis"
+)
+
+// rateLimitIdleTimeout is how long a client's bucket and grace state are kept
+// after its last request.
+const rateLimitIdleTimeout = 3 * time.Minute
+
+// rateLimitDecision is the outcome of a request against a client's token
+// bucket. When the request is over the limit, graceUsed is how many grace
+// windows the client has gone over in, and newWindow is whether this request
+// started a new one.
+type rateLimitDecision struct {
+	allowed   bool
+	remaining int
+	graceUsed int
+	newWindow bool
+}
+
+// rateLimitStore keeps the token buckets of the rate limiter.
+type rateLimitStore interface {
+	take(ctx context.Context, ip string, now time.Time) (rateLimitDecision, error)
+}
+
+// memoryRateLimitStore keeps the buckets in process, so each instance
+// enforces the limit separately.
+type memoryRateLimitStore struct {
+	rps          float64
+	burst        int
+	graceWindows int
+
+	mu      sync.Mutex
+	clients map[string]*rateLimitClient
+}
+
+type rateLimitClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+
+	graceWindow time.Time
+	graceUsed   int
+}
+
+func newMemoryRateLimitStore(rps float64, burst, graceWindows int) *memoryRateLimitStore {
+	return &memoryRateLimitStore{
+		rps:          rps,
+		burst:        burst,
+		graceWindows: graceWindows,
+		clients:      make(map[string]*rateLimitClient),
+	}
+}
+
+func (s *memoryRateLimitStore) take(_ context.Context, ip string, now time.Time) (rateLimitDecision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, found := s.clients[ip]
+	if !found {
+		c = &rateLimitClient{
+			limiter: rate.NewLimiter(rate.Limit(s.rps), s.burst),
+		}
+		s.clients[ip] = c
+	}
+
+	c.lastSeen = now
+
+	decision := rateLimitDecision{
+		allowed:   c.limiter.AllowN(now, 1),
+		remaining: int(c.limiter.TokensAt(now)),
+	}
+
+	if !decision.allowed && s.graceWindows > 0 {
+		window := now.Truncate(rateLimitGraceWindow)
+		if !window.Equal(c.graceWindow) {
+			c.graceWindow = window
+			c.graceUsed++
+			decision.newWindow = true
+		}
+	}
+
+	decision.graceUsed = c.graceUsed
+
+	return decision, nil
+}
+
+// sweep removes the clients which haven't been seen recently, so the map
+// doesn't grow without bound.
+func (s *memoryRateLimitStore) sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ip, c := range s.clients {
+		if time.Since(c.lastSeen) > rateLimitIdleTimeout {
+			delete(s.clients, ip)
+		}
+	}
+}
+
+// rateLimitScript refills and takes from a token bucket kept in a hash, and
+// tracks the grace windows in the same hash, all atomically. The hash
+// expires once the client has been idle for ARGV[5] milliseconds.
+var rateLimitScript = cache.NewScript(`
+local rps = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local window_ms = tonumber(ARGV[4])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts', 'grace_window', 'grace_used')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+local grace_window = tonumber(state[3]) or 0
+local grace_used = tonumber(state[4]) or 0
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rps / 1000)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+local new_window = 0
+if allowed == 0 and window_ms > 0 then
+	local window = now - (now % window_ms)
+	if window ~= grace_window then
+		grace_window = window
+		grace_used = grace_used + 1
+		new_window = 1
+	end
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now), 'grace_window', tostring(grace_window), 'grace_used', tostring(grace_used))
+redis.call('PEXPIRE', KEYS[1], ARGV[5])
+
+return {allowed, math.floor(tokens), grace_used, new_window}
+`)
+
+// redisRateLimitStore keeps the buckets in Redis, so that the limit applies
+// to a client across every instance. The instances' clocks are assumed to
+// be roughly in sync.
+type redisRateLimitStore struct {
+	client       *cache.Redis
+	prefix       string
+	rps          float64
+	burst        int
+	graceWindows int
+}
+
+func (s redisRateLimitStore) take(ctx context.Context, ip string, now time.Time) (rateLimitDecision, error) {
+	var windowMS int64
+	if s.graceWindows > 0 {
+		windowMS = rateLimitGraceWindow.Milliseconds()
+	}
+
+	reply, err := rateLimitScript.Run(ctx, s.client,
+		[]string{s.prefix + ip},
+		strconv.FormatFloat(s.rps, 'f', -1, 64),
+		strconv.Itoa(s.burst),
+		strconv.FormatInt(now.UnixMilli(), 10),
+		strconv.FormatInt(windowMS, 10),
+		strconv.FormatInt(rateLimitIdleTimeout.Milliseconds(), 10),
+	)
+	if err != nil {
+		return rateLimitDecision{}, err
+	}
+
+	values, ok := reply.([]any)
+	if !ok || len(values) != 4 {
+		return rateLimitDecision{}, fmt.Errorf("unexpected rate limit script reply %v", reply)
+	}
+
+	var n [4]int64
+	for i, value := range values {
+		n[i], _ = value.(int64)
+	}
+
+	return rateLimitDecision{
+		allowed:   n[0] == 1,
+		remaining: int(n[1]),
+		graceUsed: int(n[2]),
+		newWindow: n[3] == 1,
+	}, nil
+}
+
+// newRateLimitStore returns a store for the configured backend, with buckets
+// of its own. The Redis keys of the buckets start with prefix, so that
+// stores for different limits don't share them.
+func (app *application) newRateLimitStore(prefix string, rps float64, burst, graceWindows int) rateLimitStore {
+	if app.config.Limiter.Backend == LimiterBackendRedis {
+		return redisRateLimitStore{
+			client:       app.redis,
+			prefix:       prefix,
+			rps:          rps,
+			burst:        burst,
+			graceWindows: graceWindows,
+		}
+	}
+
+	store := newMemoryRateLimitStore(rps, burst, graceWindows)
+
+	app.background("rate limiter cleanup", false, func(ctx context.Context) error {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+
+			store.sweep()
+		}
+	})
+
+	return store
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// flapDamper smooths a stream of pass/fail probe results into a healthy
+// flag which only flips after several consecutive results disagree with it,
+// so that a brief database blip doesn't take the instance out of the load
+// balancer and put it straight back again.
+type flapDamper struct {
+	mu      sync.Mutex
+	healthy bool
+	streak  int
+	rise    int
+	fall    int
+}
+
+// newFlapDamper returns a damper which starts out healthy, becomes unhealthy
+// after fall consecutive failures, and recovers after rise consecutive
+// successes.
+func newFlapDamper(rise, fall int) *flapDamper {
+	return &flapDamper{healthy: true, rise: rise, fall: fall}
+}
+
+// observe records one probe result, and reports the resulting state and
+// whether this result flipped it.
+func (d *flapDamper) observe(ok bool) (healthy, changed bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if ok == d.healthy {
+		d.streak = 0
+		return d.healthy, false
+	}
+
+	d.streak++
+
+	threshold := d.fall
+	if ok {
+		threshold = d.rise
+	}
+
+	if d.streak < threshold {
+		return d.healthy, false
+	}
+
+	d.healthy = ok
+	d.streak = 0
+
+	return d.healthy, true
+}
+
+func (d *flapDamper) Healthy() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.healthy
+}
+
+// readinessProber pings the database at every probe interval until ctx is
+// cancelled, feeding the results to the damper behind /v1/readyz. Unlike the
+// health recorder, it runs in read-only mode too, and stores nothing.
+func (app *application) readinessProber(ctx context.Context) error {
+	ticker := time.NewTicker(app.config.Status.ProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		err := app.models.Ping(pingCtx)
+		cancel()
+
+		healthy, changed := app.dbHealth.observe(err == nil)
+		if !changed {
+			continue
+		}
+
+		properties := map[string]string{
+			"dependency": componentDatabase,
+			"healthy":    strconv.FormatBool(healthy),
+		}
+
+		if healthy {
+			app.logger.PrintInfo("dependency recovered, reporting ready", properties)
+		} else {
+			app.logger.PrintError(err, properties)
+		}
+	}
+}
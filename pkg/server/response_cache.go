@@ -0,0 +1,290 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// responseCache holds successful responses of cacheable GET routes. With
+// the memory backend the cache is local to each instance, so explicit
+// invalidation only affects the instance which handled the write, and the
+// TTL bounds how stale the other instances can be. With the redis backend
+// every instance shares the cache and sees invalidations.
+type responseCache struct {
+	entries responseStore
+
+	mu           sync.Mutex
+	revalidating map[string]bool
+
+	hits   atomic.Int64
+	stale  atomic.Int64
+	misses atomic.Int64
+}
+
+type cachedResponse struct {
+	path   string
+	status int
+	header http.Header
+	body   []byte
+	etag   string
+	stored time.Time
+}
+
+func newResponseCache(store responseStore) *responseCache {
+	return &responseCache{
+		entries:      store,
+		revalidating: make(map[string]bool),
+	}
+}
+
+// invalidate removes the cached responses for every path which starts with
+// one of the prefixes.
+func (c *responseCache) invalidate(prefixes ...string) {
+	c.entries.DeleteByPathPrefix(prefixes...)
+}
+
+// startRevalidation reports whether the caller should refresh key, making
+// sure only one refresh per key runs at a time.
+func (c *responseCache) startRevalidation(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.revalidating[key] {
+		return false
+	}
+
+	c.revalidating[key] = true
+	return true
+}
+
+func (c *responseCache) endRevalidation(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.revalidating, key)
+}
+
+func (c *responseCache) snapshot() any {
+	stats := map[string]int64{
+		"hits":   c.hits.Load(),
+		"stale":  c.stale.Load(),
+		"misses": c.misses.Load(),
+	}
+
+	if memory, ok := c.entries.(memoryResponseStore); ok {
+		stats["entries"] = int64(memory.lru.Len())
+	}
+
+	return stats
+}
+
+// responseRecorder buffers a response so that it can be cached. It
+// deliberately doesn't unwrap to the underlying writer, so writeJSON
+// produces a body without the per-request meta object, which is added back
+// by writeCachedResponse.
+type responseRecorder struct {
+	status      int
+	header      http.Header
+	body        bytes.Buffer
+	permissions *grantedPermissions
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{
+		status: http.StatusOK,
+		header: make(http.Header),
+	}
+}
+
+func (rec *responseRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	rec.status = status
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	return rec.body.Write(b)
+}
+
+func (rec *responseRecorder) cacheable() bool {
+	return rec.status == http.StatusOK && !strings.Contains(rec.header.Get("Cache-Control"), "no-store")
+}
+
+// responseCacheKey identifies a response by its path, its normalized query
+// string and the authenticated user, so that users never see each other's
+// responses.
+func (app *application) responseCacheKey(r *http.Request) string {
+	return fmt.Sprintf("%s?%s user=%d", r.URL.Path, r.URL.Query().Encode(), app.contextGetUser(r).ID)
+}
+
+// cacheResponse serves a GET route from the response cache. Fresh responses
+// are served for the configured TTL. After that they are still served for
+// the stale-while-revalidate window, while a background request refreshes
+// them. The X-Cache header says whether a response was a HIT, STALE or MISS.
+func (app *application) cacheResponse(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !app.config.Cache.Enabled || r.Method != http.MethodGet {
+			next(w, r)
+			return
+		}
+
+		c := app.responseCache
+		key := app.responseCacheKey(r)
+
+		res, ok := c.entries.Get(key)
+		if ok {
+			age := time.Since(res.stored)
+
+			switch {
+			case age < app.config.Cache.TTL:
+				c.hits.Add(1)
+				app.writeCachedResponse(w, r, res, "HIT")
+				return
+			case age < app.config.Cache.TTL+app.config.Cache.StaleWhileRevalidate:
+				c.stale.Add(1)
+
+				if c.startRevalidation(key) {
+					req := r.Clone(context.WithoutCancel(r.Context()))
+					permissions := permissionsFromWriter(w)
+
+					app.background("response cache revalidation", false, func(context.Context) error {
+						defer c.endRevalidation(key)
+
+						rec := newResponseRecorder()
+						rec.permissions = permissions
+						next(rec, req)
+						app.storeResponse(key, req, rec)
+						return nil
+					})
+				}
+
+				app.writeCachedResponse(w, r, res, "STALE")
+				return
+			}
+		}
+
+		c.misses.Add(1)
+
+		rec := newResponseRecorder()
+		rec.permissions = permissionsFromWriter(w)
+		next(rec, r)
+
+		res = app.storeResponse(key, r, rec)
+		app.writeCachedResponse(w, r, res, "MISS")
+	}
+}
+
+// storeResponse caches the recorded response if it is cacheable, and
+// returns it as a cachedResponse either way.
+func (app *application) storeResponse(key string, r *http.Request, rec *responseRecorder) *cachedResponse {
+	res := &cachedResponse{
+		path:   r.URL.Path,
+		status: rec.status,
+		header: rec.header,
+		body:   rec.body.Bytes(),
+		stored: time.Now(),
+	}
+
+	sum := sha256.Sum256(res.body)
+	res.etag = fmt.Sprintf(`"%x"`, sum[:16])
+
+	if rec.cacheable() {
+		app.responseCache.entries.Set(key, res, app.config.Cache.TTL+app.config.Cache.StaleWhileRevalidate)
+	}
+
+	return res
+}
+
+// writeCachedResponse writes res to w, adding the meta object for the
+// current request to JSON bodies when -envelope-meta is set. Cacheable
+// responses get Cache-Control, Age, ETag and Last-Modified headers, with the
+// time the response was generated as its modification time; since writes
+// invalidate the cache, nothing has changed since then. A conditional
+// request which still has the current version gets a 304 Not Modified
+// instead. If-None-Match takes precedence, as the ETag also catches changes
+// within the one-second resolution of Last-Modified.
+func (app *application) writeCachedResponse(w http.ResponseWriter, r *http.Request, res *cachedResponse, status string) {
+	body := res.body
+
+	cacheable := res.status == http.StatusOK && res.header.Get("Cache-Control") == ""
+
+	if meta := responseMetaFromWriter(w); meta != nil && res.header.Get("Content-Type") == "application/json" {
+		var env map[string]json.RawMessage
+
+		err := json.Unmarshal(body, &env)
+		if err == nil {
+			js, err := json.Marshal(meta.envelope())
+			if err == nil {
+				env["meta"] = js
+
+				indented, err := json.MarshalIndent(env, "", "\t")
+				if err == nil {
+					body = append(indented, '\n')
+				}
+			}
+		}
+	}
+
+	for key, values := range res.header {
+		w.Header()[key] = append([]string(nil), values...)
+	}
+
+	w.Header().Set("X-Cache", status)
+
+	if cacheable {
+		modified := res.stored.UTC().Truncate(time.Second)
+
+		w.Header().Set("Cache-Control", app.cacheControl(r))
+		w.Header().Set("Age", strconv.Itoa(int(time.Since(res.stored).Seconds())))
+		w.Header().Set("ETag", res.etag)
+		w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+
+		if notModified(r, res.etag, modified) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	w.WriteHeader(res.status)
+	w.Write(body)
+}
+
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !modified.After(since)
+}
+
+// cacheControl returns the Cache-Control header for a cached response,
+// which lets clients and shared caches reuse it for as long as this cache
+// would. Responses to authenticated requests are only for the requester.
+func (app *application) cacheControl(r *http.Request) string {
+	ttl := int(app.config.Cache.TTL.Seconds())
+	swr := int(app.config.Cache.StaleWhileRevalidate.Seconds())
+
+	if !app.contextGetUser(r).IsAnonymous() {
+		return fmt.Sprintf("private, max-age=%d", ttl)
+	}
+
+	return fmt.Sprintf("public, max-age=%d, stale-while-revalidate=%d", ttl, swr)
+}
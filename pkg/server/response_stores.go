@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/cache"
+	"github.com/agung-learns/ebook-go-further/internal/jsonlog"
+)
+
+const (
+	CacheBackendMemory = "memory"
+	CacheBackendRedis  = "redis"
+)
+
+// responseStore is where the response cache keeps its entries. Stores don't
+// need to expire entries themselves, because the cache checks their age,
+// but may drop them after ttl.
+type responseStore interface {
+	Get(key string) (*cachedResponse, bool)
+	Set(key string, res *cachedResponse, ttl time.Duration)
+	DeleteByPathPrefix(prefixes ...string)
+}
+
+// memoryResponseStore keeps the entries in an in-process LRU.
+type memoryResponseStore struct {
+	lru *cache.LRU[string, *cachedResponse]
+}
+
+func newMemoryResponseStore(size int) memoryResponseStore {
+	return memoryResponseStore{lru: cache.NewLRU[string, *cachedResponse](size)}
+}
+
+func (s memoryResponseStore) Get(key string) (*cachedResponse, bool) {
+	return s.lru.Get(key)
+}
+
+func (s memoryResponseStore) Set(key string, res *cachedResponse, _ time.Duration) {
+	s.lru.Set(key, res)
+}
+
+func (s memoryResponseStore) DeleteByPathPrefix(prefixes ...string) {
+	s.lru.DeleteFunc(func(_ string, res *cachedResponse) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(res.path, prefix) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// redisResponseStore keeps the entries in Redis, shared by every instance.
+// The cache key starts with the request path, so the entries for a path
+// prefix can be found with a SCAN. Redis errors are logged and treated as
+// misses, so that an outage only makes the cache ineffective.
+type redisResponseStore struct {
+	client *cache.Redis
+	logger *jsonlog.Logger
+}
+
+const redisResponseKeyPrefix = "greenlight:response:"
+
+// redisResponse is the JSON encoding of a cachedResponse.
+type redisResponse struct {
+	Path   string      `json:"path"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+	ETag   string      `json:"etag"`
+	Stored time.Time   `json:"stored"`
+}
+
+func (s redisResponseStore) Get(key string) (*cachedResponse, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	js, err := s.client.Get(ctx, redisResponseKeyPrefix+key)
+	if err != nil {
+		if !errors.Is(err, cache.ErrNil) {
+			s.logger.PrintError(err, map[string]string{"response_cache": "get"})
+		}
+		return nil, false
+	}
+
+	var stored redisResponse
+
+	err = json.Unmarshal(js, &stored)
+	if err != nil {
+		s.logger.PrintError(err, map[string]string{"response_cache": "get"})
+		return nil, false
+	}
+
+	return &cachedResponse{
+		path:   stored.Path,
+		status: stored.Status,
+		header: stored.Header,
+		body:   stored.Body,
+		etag:   stored.ETag,
+		stored: stored.Stored,
+	}, true
+}
+
+func (s redisResponseStore) Set(key string, res *cachedResponse, ttl time.Duration) {
+	js, err := json.Marshal(redisResponse{
+		Path:   res.path,
+		Status: res.status,
+		Header: res.header,
+		Body:   res.body,
+		ETag:   res.etag,
+		Stored: res.stored,
+	})
+	if err != nil {
+		s.logger.PrintError(err, map[string]string{"response_cache": "set"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err = s.client.Set(ctx, redisResponseKeyPrefix+key, js, ttl)
+	if err != nil {
+		s.logger.PrintError(err, map[string]string{"response_cache": "set"})
+	}
+}
+
+func (s redisResponseStore) DeleteByPathPrefix(prefixes ...string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, prefix := range prefixes {
+		pattern := redisResponseKeyPrefix + escapeGlob(prefix) + "*"
+
+		err := s.client.Scan(ctx, pattern, func(keys []string) error {
+			_, err := s.client.Del(ctx, keys...)
+			return err
+		})
+		if err != nil {
+			s.logger.PrintError(err, map[string]string{"response_cache": "invalidate"})
+		}
+	}
+}
+
+// escapeGlob escapes the characters which are special in Redis glob-style
+// patterns.
+func escapeGlob(s string) string {
+	var b strings.Builder
+
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\^`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+)
+
+// retentionStats records the outcome of the latest run of each retention
+// rule, and is published as the "retention" expvar.
+type retentionStats struct {
+	mu    sync.Mutex
+	rules map[string]*retentionRuleStats
+}
+
+type retentionRuleStats struct {
+	LastRun     time.Time `json:"last_run"`
+	LastCount   int64     `json:"last_count"`
+	TotalPurged int64     `json:"total_purged"`
+	DryRun      bool      `json:"dry_run"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+func newRetentionStats() *retentionStats {
+	return &retentionStats{rules: make(map[string]*retentionRuleStats)}
+}
+
+func (s *retentionStats) record(rule string, count int64, dryRun bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats, ok := s.rules[rule]
+	if !ok {
+		stats = &retentionRuleStats{}
+		s.rules[rule] = stats
+	}
+
+	stats.LastRun = time.Now()
+	stats.LastCount = count
+	stats.DryRun = dryRun
+	stats.LastError = ""
+
+	if err != nil {
+		stats.LastError = err.Error()
+	}
+
+	if !dryRun {
+		stats.TotalPurged += count
+	}
+}
+
+func (s *retentionStats) snapshot() any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := make(map[string]retentionRuleStats, len(s.rules))
+	for rule, stats := range s.rules {
+		snapshot[rule] = *stats
+	}
+
+	return snapshot
+}
+
+// retentionPurger applies the retention rules once straight away, and then
+// at every interval until ctx is cancelled. In dry-run mode the rows each
+// rule would delete are only counted and logged.
+func (app *application) retentionPurger(ctx context.Context) error {
+	ticker := time.NewTicker(app.config.Retention.Interval)
+	defer ticker.Stop()
+
+	for {
+		for _, rule := range app.config.Retention.Rules {
+			app.applyRetentionRule(rule)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *application) applyRetentionRule(rule RetentionRule) {
+	dataRule := data.RetentionRule{
+		Name:   rule.Name,
+		Table:  rule.Table,
+		Column: rule.Column,
+		MaxAge: rule.MaxAge,
+	}
+
+	var (
+		count int64
+		err   error
+	)
+
+	if app.config.Retention.DryRun {
+		count, err = app.models.Retention.Count(dataRule)
+	} else {
+		count, err = app.models.Retention.Purge(dataRule)
+	}
+
+	app.retentionStats.record(rule.Name, count, app.config.Retention.DryRun, err)
+
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"retention_rule": rule.Name})
+		return
+	}
+
+	message := "retention rule applied"
+	if app.config.Retention.DryRun {
+		message = "retention rule dry run"
+	}
+
+	app.logger.PrintInfo(message, map[string]string{
+		"retention_rule": rule.Name,
+		"table":          rule.Table,
+		"max_age":        rule.MaxAge.String(),
+		"rows":           strconv.FormatInt(count, 10),
+	})
+}
+
+// tokenCleaner deletes expired activation and email change tokens at every
+// cleanup interval until ctx is cancelled. Expired tokens are already
+// rejected when used, so this only keeps the tokens table from growing.
+func (app *application) tokenCleaner(ctx context.Context) error {
+	ticker := time.NewTicker(app.config.Tokens.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		count, err := app.models.Tokens.DeleteExpired()
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"worker": "token cleaner"})
+		} else if count > 0 {
+			app.logger.PrintInfo("expired tokens deleted", map[string]string{
+				"rows": strconv.FormatInt(count, 10),
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+)
+
+var listReviewsQuery = querySpec{
+	{name: "page", kind: queryInt, def: "1", min: 1, max: 10_000_000},
+	{name: "page_size", kind: queryInt, def: "20"},
+	{name: "sort", kind: queryString, def: "-created_at"},
+}
+
+// createReviewHandler adds the user's review of a movie. A user can only
+// review each movie once.
+func (app *application) createReviewHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Rating int32  `json:"rating"`
+		Body   string `json:"body"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	review := &data.Review{
+		MovieID: movie.ID,
+		UserID:  user.ID,
+		Author:  user.Name,
+		Rating:  input.Rating,
+		Body:    input.Body,
+	}
+
+	v := validator.New()
+
+	if data.ValidateReview(v, review); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Reviews.Insert(review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateReview):
+			v.AddError("movie_id", "has already been reviewed by you")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The movie's average rating has changed.
+	app.responseCache.invalidate("/v1/movies")
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"review": review}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listReviewsHandler lists the reviews of a movie, newest first by default,
+// paginated in the same way as the movie listing.
+func (app *application) listReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
+	input.Filters.SortKeys = data.ReviewSortKeys
+	input.Filters.MaxPageSize = app.config.Limits.MaxPageSize
+	input.Filters.MaxOffset = app.config.Limits.MaxOffset
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	reviews, metadata, err := app.models.Reviews.GetAllForMovie(id, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	if links := app.paginationLinks(r, metadata); links != "" {
+		headers.Set("Link", links)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"reviews": reviews, "metadata": metadata}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// reconcileRatingsHandler checks every movie's rating counters against its
+// reviews and corrects those which have drifted, reporting each one. As a
+// dry run it only reports them.
+func (app *application) reconcileRatingsHandler(w http.ResponseWriter, r *http.Request) {
+	var drifts []data.RatingDrift
+
+	err := app.write(r, func(m data.Models) error {
+		var err error
+		drifts, err = m.Movies.ReconcileRatings()
+		return err
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if app.isDryRun(r) {
+		app.dryRunResponse(w, r, envelope{"drift": drifts})
+		return
+	}
+
+	if len(drifts) > 0 {
+		app.responseCache.invalidate("/v1/movies")
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"drift": drifts}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
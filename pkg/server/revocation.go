@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/cache"
+)
+
+const (
+	RevocationBackendMemory = "memory"
+	RevocationBackendRedis  = "redis"
+)
+
+// revocationList records the IDs (jti claims) of authentication JWTs which
+// were revoked before they expired. An ID only needs to be kept until the
+// token expires, since after that it is rejected anyway, plus the leeway,
+// since the token is accepted for that long after it expires.
+type revocationList interface {
+	Revoke(ctx context.Context, id string, expiry time.Time) error
+	IsRevoked(ctx context.Context, id string) (bool, error)
+}
+
+// memoryRevocationList keeps the revoked IDs in process, so a token is only
+// rejected by the instance it was revoked on.
+type memoryRevocationList struct {
+	mu  sync.Mutex
+	ids map[string]time.Time
+}
+
+func newMemoryRevocationList() *memoryRevocationList {
+	return &memoryRevocationList{ids: make(map[string]time.Time)}
+}
+
+func (l *memoryRevocationList) Revoke(_ context.Context, id string, expiry time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	for revoked, revokedExpiry := range l.ids {
+		if now.After(revokedExpiry) {
+			delete(l.ids, revoked)
+		}
+	}
+
+	l.ids[id] = expiry.Add(maxJWTLeeway)
+
+	return nil
+}
+
+func (l *memoryRevocationList) IsRevoked(_ context.Context, id string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, ok := l.ids[id]
+	return ok, nil
+}
+
+// redisRevocationList keeps the revoked IDs in Redis, shared by every
+// instance, each expiring along with its token.
+type redisRevocationList struct {
+	client *cache.Redis
+}
+
+func (l redisRevocationList) Revoke(ctx context.Context, id string, expiry time.Time) error {
+	ttl := time.Until(expiry) + maxJWTLeeway
+	return l.client.Set(ctx, "greenlight:revoked:"+id, []byte("1"), ttl)
+}
+
+func (l redisRevocationList) IsRevoked(ctx context.Context, id string) (bool, error) {
+	return l.client.Exists(ctx, "greenlight:revoked:"+id)
+}
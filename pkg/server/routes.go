@@ -0,0 +1,202 @@
+package server
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func (app *application) routes() http.Handler {
+	router := &apiRouter{Router: httprouter.New()}
+
+	router.NotFound = http.HandlerFunc(app.notFoundResponse)
+	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
+
+	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/readyz", app.readinessHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/status", app.statusHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/status/history", app.validateQuery(statusHistoryQuery, app.statusHistoryHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies", app.validateQuery(listMoviesQuery, app.requireMovieReader(app.requireScope(data.ScopeReadMovies, app.cacheResponse(app.listMoviesHandler)))))
+	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission(data.PermissionWriteMovies, app.requireScope(data.ScopeWriteMovies, app.createMovieHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requireMovieReader(app.requireScope(data.ScopeReadMovies, app.cacheResponse(app.showMovieOrDiscoveryHandler))))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id", app.requirePermission(data.PermissionWriteMovies, app.requireScope(data.ScopeWriteMovies, app.updateMovieHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission(data.PermissionWriteMovies, app.requireScope(data.ScopeWriteMovies, app.patchMovieHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission(data.PermissionWriteMovies, app.requireScope(data.ScopeWriteMovies, app.deleteMovieHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/poster", app.requirePermission(data.PermissionWriteMovies, app.requireScope(data.ScopeWriteMovies, app.uploadPosterHandler)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/feeds/movies.atom", app.validateQuery(movieFeedQuery, app.requireMovieReader(app.requireScope(data.ScopeReadMovies, app.cacheResponse(app.movieFeedHandler(feedFormatAtom))))))
+	router.HandlerFunc(http.MethodGet, "/v1/feeds/movies.rss", app.validateQuery(movieFeedQuery, app.requireMovieReader(app.requireScope(data.ScopeReadMovies, app.cacheResponse(app.movieFeedHandler(feedFormatRSS))))))
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/card", app.requireMovieReader(app.requireScope(data.ScopeReadMovies, app.cacheResponse(app.showMovieCardHandler))))
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/reviews", app.validateQuery(listReviewsQuery, app.requireMovieReader(app.requireScope(data.ScopeReadMovies, app.cacheResponse(app.listReviewsHandler)))))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/reviews", app.requireActivatedUser(app.requireScope(data.ScopeWriteReviews, app.createReviewHandler)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/progress", app.requireActivatedUser(app.showWatchProgressHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/progress", app.requireActivatedUser(app.requireScope(data.ScopeWriteProgress, app.updateWatchProgressHandler)))
+
+	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/email/verified", app.confirmUserEmailHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.resetUserPasswordHandler)
+
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/email", app.requireSession(app.updateUserEmailHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/password", app.requireSession(app.updateUserPasswordHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/totp", app.requireSession(app.enrollTOTPHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/totp/confirm", app.requireSession(app.confirmTOTPHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/progress", app.requireActivatedUser(app.continueWatchingHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/me/watchlist", app.requireActivatedUser(app.validateQuery(listWatchlistQuery, app.listWatchlistHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/me/watchlist", app.requireActivatedUser(app.requireScope(data.ScopeWriteWatchlist, app.addToWatchlistHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/me/watchlist/:id", app.requireActivatedUser(app.requireScope(data.ScopeWriteWatchlist, app.removeFromWatchlistHandler)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/tokens", app.requireSession(app.listPersonalAccessTokensHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/tokens", app.requireSession(app.createPersonalAccessTokenHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/tokens/:id", app.requireSession(app.deletePersonalAccessTokenHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/api-keys", app.requireSession(app.listAPIKeysHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/api-keys", app.requireSession(app.createAPIKeyHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/api-keys/:id", app.requireSession(app.revokeAPIKeyHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users", app.requireSession(app.requireRole(data.RoleAdmin, app.validateQuery(listUsersQuery, app.listUsersHandler))))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id/roles", app.requireSession(app.requireRole(data.RoleAdmin, app.showUserRolesHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/roles", app.requireSession(app.requireRole(data.RoleAdmin, app.updateUserRolesHandler)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/vocabularies", app.listVocabulariesHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/vocabularies/:name", app.showVocabularyHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/genres", app.listGenresHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/admin/vocabularies/:name", app.requireSession(app.requireRole(data.RoleAdmin, app.createTermHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/admin/vocabularies/:name/:value", app.requireSession(app.requireRole(data.RoleAdmin, app.updateTermHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/vocabularies/:name/:value", app.requireSession(app.requireRole(data.RoleAdmin, app.deleteTermHandler)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/email-checks", app.requireSession(app.requireRole(data.RoleAdmin, app.showEmailCheckHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/email-checks", app.requireSession(app.requireRole(data.RoleAdmin, app.startEmailCheckHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/email-suppressions", app.requireSession(app.requireRole(data.RoleAdmin, app.createEmailSuppressionHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/email-suppressions/:email", app.requireSession(app.requireRole(data.RoleAdmin, app.deleteEmailSuppressionHandler)))
+
+	router.HandlerFunc(http.MethodPost, "/v1/admin/ratings/reconcile", app.requireSession(app.requireRole(data.RoleAdmin, app.reconcileRatingsHandler)))
+
+	router.HandlerFunc(http.MethodPost, "/v1/admin/incidents", app.requireSession(app.requireRole(data.RoleAdmin, app.createIncidentHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/admin/incidents/:id", app.requireSession(app.requireRole(data.RoleAdmin, app.updateIncidentHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/incidents/:id", app.requireSession(app.requireRole(data.RoleAdmin, app.deleteIncidentHandler)))
+
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/tokens/authentication", app.requireAuthenticatedUser(app.revokeAuthenticationTokenHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
+
+	if app.config.Analytics.Enabled {
+		router.HandlerFunc(http.MethodPost, "/v1/events", app.createEventsHandler)
+	}
+
+	if app.config.Session.Enabled {
+		router.HandlerFunc(http.MethodPost, "/v1/tokens/csrf", app.createCSRFTokenHandler)
+	}
+
+	openAPIDoc, err := app.openAPIDocument()
+	if err != nil {
+		panic(err)
+	}
+
+	router.HandlerFunc(http.MethodGet, "/v1/openapi.json", app.openAPIHandler(openAPIDoc))
+
+	if app.config.Docs.Enabled && app.config.Env != "production" {
+		router.HandlerFunc(http.MethodGet, "/docs", app.docsHandler)
+	}
+
+	if app.config.Storage.Backend == StorageDisk {
+		router.Handler(http.MethodGet, uploadsPath+"/*filepath", app.uploadsHandler())
+	}
+
+	// expvar publishes the command line, which can carry secrets such as
+	// the -db-dsn, so the metrics are for admins only.
+	router.HandlerFunc(http.MethodGet, "/debug/vars", app.requireSession(app.requireRole(data.RoleAdmin, expvar.Handler().ServeHTTP)))
+
+	if err := checkAPIOperations(router, apiOperations, app.config); err != nil {
+		panic(err)
+	}
+
+	handler := app.pluginRoutes(router.Router)
+
+	if app.config.Examples.Dir != "" {
+		handler = app.recordExamples(router.Router, handler)
+	}
+
+	// The application-wide middleware, outermost first.
+	chain := []namedMiddleware{
+		{"metrics", app.metrics},
+		{"requestID", app.requestID},
+		{"recoverPanic", app.recoverPanic},
+		{"servedBy", app.servedBy},
+		{"compress", app.compress},
+		{"envelopeMeta", app.envelopeMeta},
+		{"enableCORS", app.enableCORS},
+		{"rateLimit", app.rateLimit},
+		{"readOnly", app.readOnly},
+		{"authenticate", app.authenticate},
+		{"fieldPermissions", app.fieldPermissions},
+		{"csrfProtect", app.csrfProtect},
+	}
+
+	if err := checkMiddlewareOrder(chain); err != nil {
+		panic(err)
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		handler = chain[i].fn(handler)
+	}
+
+	return handler
+}
+
+type namedMiddleware struct {
+	name string
+	fn   func(http.Handler) http.Handler
+}
+
+// middlewareOrder lists pairs of middleware where the first must wrap the
+// second, because the second reads something the first puts in the request
+// context. The per-route requireActivatedUser, requireScope and requireSession
+// helpers rely on authenticate in the same way, which is covered by
+// requiredMiddleware.
+var middlewareOrder = [][2]string{
+	{"requestID", "envelopeMeta"},
+	{"requestID", "recoverPanic"},
+	{"authenticate", "csrfProtect"},
+	{"authenticate", "fieldPermissions"},
+}
+
+var requiredMiddleware = []string{"requestID", "authenticate"}
+
+// checkMiddlewareOrder reports an error if a required middleware is missing
+// from the chain, or if two middleware are in the wrong order. It runs once
+// at startup, so a mistake in routes() fails immediately instead of
+// surfacing as a panic from contextGetUser on the first request.
+func checkMiddlewareOrder(chain []namedMiddleware) error {
+	position := make(map[string]int, len(chain))
+	for i, m := range chain {
+		position[m.name] = i
+	}
+
+	for _, name := range requiredMiddleware {
+		if _, ok := position[name]; !ok {
+			return fmt.Errorf("middleware %q is missing from the chain", name)
+		}
+	}
+
+	for _, pair := range middlewareOrder {
+		outer, ok1 := position[pair[0]]
+		inner, ok2 := position[pair[1]]
+
+		if ok1 && ok2 && outer > inner {
+			return fmt.Errorf("middleware %q must come before %q", pair[0], pair[1])
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,627 @@
+// Package server contains the greenlight JSON API. The cmd/api binary is a
+// thin wrapper around it, and other programs can use it to mount the API
+// inside a larger mux, or to run it in-process in tests:
+//
+//	srv, err := server.New(cfg, server.WithDB(db, nil))
+//	if err != nil {
+//		return err
+//	}
+//	defer srv.Shutdown(context.Background())
+//
+//	mux.Handle("/", srv.Handler())
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/cache"
+	"github.com/agung-learns/ebook-go-further/internal/data"
+	"github.com/agung-learns/ebook-go-further/internal/jsonlog"
+	"github.com/agung-learns/ebook-go-further/internal/lifecycle"
+	"github.com/agung-learns/ebook-go-further/internal/mailer"
+	"github.com/agung-learns/ebook-go-further/internal/pwned"
+	"github.com/agung-learns/ebook-go-further/internal/storage"
+
+	"github.com/XSAM/otelsql"
+	_ "github.com/lib/pq"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/sync/singleflight"
+)
+
+const version = "1.0.0"
+
+type application struct {
+	config          Config
+	logger          *jsonlog.Logger
+	models          data.Models
+	reads           singleflight.Group
+	ready           atomic.Bool
+	dbHealth        *flapDamper
+	lifecycle       *lifecycle.Lifecycle
+	validationStats *validationStats
+	mailer          mailer.Mailer
+	mailQueue       *mailer.Queue
+	workers         *workers
+	featured        featuredCache
+	retentionStats  *retentionStats
+	emailChecks     *emailCheckJob
+	analytics       *analyticsBuffer
+	responseCache   *responseCache
+	pwned           *pwned.Client
+	redis           *cache.Redis
+	revocations     revocationList
+	jwtKeys         *jwtKeys
+	guestLimiter    rateLimitStore
+	webSubPending   chan struct{}
+	storage         storage.Storage
+}
+
+// Server is a running instance of the API, with its database connection
+// pools and background subsystems already started.
+type Server struct {
+	app     *application
+	handler http.Handler
+}
+
+// Option customizes a Server created with New.
+type Option func(*options)
+
+type options struct {
+	logOutput  io.Writer
+	db, readDB *sql.DB
+}
+
+// WithLogOutput sets where the JSON log is written. It defaults to
+// os.Stdout.
+func WithLogOutput(w io.Writer) Option {
+	return func(o *options) {
+		o.logOutput = w
+	}
+}
+
+// WithDB makes the Server use existing connection pools instead of opening
+// its own from Config.DB. readDB may be nil when there is no read replica.
+// The pools are not closed by Shutdown.
+func WithDB(db, readDB *sql.DB) Option {
+	return func(o *options) {
+		o.db = db
+		o.readDB = readDB
+	}
+}
+
+// expvarOnce guards the process-wide expvars, which can only be published
+// once. When several Servers are created in one process, the expvars report
+// on the first of them.
+var expvarOnce sync.Once
+
+// New validates the configuration, connects to the database, and starts the
+// application's background subsystems. The returned Server is ready to
+// handle requests through Handler or Run, and must be stopped with Shutdown
+// if Run isn't used.
+func New(cfg Config, opts ...Option) (*Server, error) {
+	o := options{logOutput: os.Stdout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	err := cfg.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	logger := jsonlog.New(o.logOutput, jsonlog.LevelInfo)
+
+	if cfg.Region != "" {
+		logger = logger.With(map[string]string{"region": cfg.Region})
+	}
+
+	data.DefaultPasswordHasher = cfg.passwordHasher()
+
+	if cfg.FastCrypto {
+		data.DefaultPasswordHasher = data.BcryptHasher{Cost: bcrypt.MinCost}
+		cfg.JWT.TTL = min(cfg.JWT.TTL, fastCryptoMaxJWTTTL)
+
+		logger.PrintInfo("fast crypto mode enabled, for testing and development only", map[string]string{
+			"env":     cfg.Env,
+			"jwt_ttl": cfg.JWT.TTL.String(),
+		})
+	}
+
+	if cfg.Examples.Dir != "" {
+		err = os.MkdirAll(cfg.Examples.Dir, 0o755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sender, err := newMailSender(cfg, o.logOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	retry := mailer.RetryPolicy{
+		MaxAttempts: cfg.Mailer.MaxAttempts,
+		Backoff:     cfg.Mailer.RetryBackoff,
+		MaxBackoff:  cfg.Mailer.RetryMaxBackoff,
+	}
+
+	mail, err := mailer.New(sender, retry, cfg.Mailer.Sender, cfg.Mailer.TemplateDir)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := newStorage(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	jwtKeys, err := loadJWTKeys(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	lc := lifecycle.New()
+
+	var shutdownTracing func(context.Context) error
+
+	lc.Append(lifecycle.Hook{
+		Name: "tracing",
+		OnStart: func(context.Context) (err error) {
+			shutdownTracing, err = setupTracing(cfg)
+			return err
+		},
+		OnShutdown: func(ctx context.Context) error {
+			return shutdownTracing(ctx)
+		},
+	})
+
+	db, readDB := o.db, o.readDB
+
+	if db == nil {
+		lc.Append(lifecycle.Hook{
+			Name: "database",
+			OnStart: func(ctx context.Context) (err error) {
+				db, err = openDB(ctx, cfg, cfg.DB.DSN)
+				if err != nil {
+					return err
+				}
+
+				logger.PrintInfo("database connection pool established", nil)
+				return nil
+			},
+			OnShutdown: func(context.Context) error {
+				return db.Close()
+			},
+		})
+
+		if cfg.DB.ReadDSN != "" {
+			lc.Append(lifecycle.Hook{
+				Name: "read replica",
+				OnStart: func(ctx context.Context) (err error) {
+					readDB, err = openDB(ctx, cfg, cfg.DB.ReadDSN)
+					if err != nil {
+						return err
+					}
+
+					logger.PrintInfo("read replica connection pool established", nil)
+					return nil
+				},
+				OnShutdown: func(context.Context) error {
+					return readDB.Close()
+				},
+			})
+		}
+	}
+
+	err = lc.Start(context.Background())
+	if err != nil {
+		lc.Shutdown(context.Background())
+		return nil, err
+	}
+
+	models := data.NewModels(db)
+	if readDB != nil {
+		models = data.NewModelsWithReplica(db, readDB)
+	}
+
+	models.Movies.ListTimeout = cfg.Limits.ListTimeout
+
+	// validate has already checked the ID strategies.
+	ids, _ := cfg.idGenerators()
+	models.Movies.IDs = ids["movies"]
+	models.Users.IDs = ids["users"]
+
+	models = decorateModels(models)
+
+	app := &application{
+		config:          cfg,
+		logger:          logger,
+		models:          models,
+		lifecycle:       lc,
+		validationStats: newValidationStats(),
+		mailer:          mail,
+		mailQueue:       mailer.NewQueue(mail, logger, cfg.Mailer.QueueSize),
+		workers:         newWorkers(),
+		retentionStats:  newRetentionStats(),
+		emailChecks:     &emailCheckJob{},
+		analytics:       newAnalyticsBuffer(cfg.Analytics.BufferSize),
+		responseCache:   newResponseCache(newMemoryResponseStore(cfg.Cache.Size)),
+		dbHealth:        newFlapDamper(cfg.Status.ReadinessRise, cfg.Status.ReadinessFall),
+		revocations:     newMemoryRevocationList(),
+		storage:         store,
+		jwtKeys:         jwtKeys,
+	}
+
+	if cfg.Passwords.BreachCheck {
+		app.pwned = pwned.New(pwned.DefaultBaseURL, 2*time.Second)
+	}
+
+	if cfg.Redis.Addr != "" {
+		app.redis = cache.NewRedis(cfg.Redis.Addr, cfg.Redis.Password, cfg.Redis.DB, cfg.Redis.PoolSize)
+
+		lc.Append(lifecycle.Hook{
+			Name: "redis",
+			OnShutdown: func(context.Context) error {
+				return app.redis.Close()
+			},
+		})
+	}
+
+	if cfg.Cache.Backend == CacheBackendRedis {
+		app.responseCache = newResponseCache(redisResponseStore{client: app.redis, logger: logger})
+	}
+
+	if cfg.JWT.RevocationBackend == RevocationBackendRedis {
+		app.revocations = redisRevocationList{client: app.redis}
+	}
+
+	if cfg.Guest.Enabled {
+		app.guestLimiter = app.newRateLimitStore("greenlight:ratelimit:guest:", cfg.Guest.RPS, cfg.Guest.Burst, 0)
+	}
+
+	lc.Append(lifecycle.Hook{
+		Name:       "background workers",
+		Timeout:    30 * time.Second,
+		OnShutdown: app.workers.shutdown,
+	})
+
+	expvarOnce.Do(func() {
+		expvar.NewString("version").Set(version)
+
+		expvar.Publish("goroutines", expvar.Func(func() any {
+			return runtime.NumGoroutine()
+		}))
+
+		expvar.Publish("database", expvar.Func(func() any {
+			return db.Stats()
+		}))
+
+		expvar.Publish("timestamp", expvar.Func(func() any {
+			return time.Now().Unix()
+		}))
+
+		expvar.Publish("validation_failures", expvar.Func(app.validationStats.snapshot))
+
+		expvar.Publish("response_cache", expvar.Func(app.responseCache.snapshot))
+
+		expvar.Publish("analytics", expvar.Func(app.analytics.snapshot))
+
+		expvar.Publish("retention", expvar.Func(app.retentionStats.snapshot))
+
+		expvar.Publish("mail_queue", expvar.Func(func() any {
+			return app.mailQueue.Stats()
+		}))
+	})
+
+	s := &Server{
+		app:     app,
+		handler: otelhttp.NewHandler(app.routes(), "greenlight"),
+	}
+
+	lc.Append(lifecycle.Hook{
+		Name:    "mail queue",
+		Timeout: 30 * time.Second,
+		OnStart: func(context.Context) error {
+			for i := 0; i < cfg.Mailer.Workers; i++ {
+				app.background("mail queue", true, func(ctx context.Context) error {
+					app.mailQueue.Work(ctx)
+					return nil
+				})
+			}
+			return nil
+		},
+		OnShutdown: func(context.Context) error {
+			app.mailQueue.Close()
+			return nil
+		},
+	})
+
+	if cfg.Analytics.Enabled {
+		lc.Append(lifecycle.Hook{
+			Name: "analytics exporter",
+			OnStart: func(context.Context) error {
+				app.background("analytics exporter", false, app.analyticsExporter)
+				return nil
+			},
+		})
+	}
+
+	if cfg.Retention.Enabled && cfg.Mode != ModeReadOnly {
+		lc.Append(lifecycle.Hook{
+			Name: "retention purger",
+			OnStart: func(context.Context) error {
+				app.background("retention purger", false, app.retentionPurger)
+				return nil
+			},
+		})
+	}
+
+	if cfg.Tokens.CleanupInterval > 0 && cfg.Mode != ModeReadOnly {
+		lc.Append(lifecycle.Hook{
+			Name: "token cleaner",
+			OnStart: func(context.Context) error {
+				app.background("token cleaner", false, app.tokenCleaner)
+				return nil
+			},
+		})
+	}
+
+	if cfg.Feed.WebSubHub != "" && cfg.Mode != ModeReadOnly {
+		app.webSubPending = make(chan struct{}, 1)
+
+		lc.Append(lifecycle.Hook{
+			Name: "websub publisher",
+			OnStart: func(context.Context) error {
+				app.background("websub publisher", false, app.webSubPublisher)
+				return nil
+			},
+		})
+	}
+
+	if cfg.Mode != ModeReadOnly {
+		lc.Append(lifecycle.Hook{
+			Name: "health recorder",
+			OnStart: func(context.Context) error {
+				app.background("health recorder", false, app.healthRecorder)
+				return nil
+			},
+		})
+	}
+
+	lc.Append(lifecycle.Hook{
+		Name: "readiness prober",
+		OnStart: func(context.Context) error {
+			app.background("readiness prober", false, app.readinessProber)
+			return nil
+		},
+	})
+
+	lc.Append(lifecycle.Hook{
+		Name: "warm-up",
+		OnStart: func(context.Context) error {
+			if cfg.WarmUp {
+				app.background("warm-up", false, func(context.Context) error {
+					app.warmUp(db, readDB, s.handler)
+					return nil
+				})
+			} else {
+				app.ready.Store(true)
+			}
+			return nil
+		},
+	})
+
+	err = lc.Start(context.Background())
+	if err != nil {
+		lc.Shutdown(context.Background())
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Handler returns the HTTP handler for the API, including all of its
+// middleware.
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// Shutdown stops the application's subsystems in the reverse order they were
+// started, beginning with the HTTP server when Run is in use, which waits
+// for in-flight requests to complete.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.app.ready.Store(false)
+	return s.app.lifecycle.Shutdown(ctx)
+}
+
+// Run serves requests on the port set in Config.Port until ctx is
+// cancelled, and then shuts the Server down. A failing critical background
+// worker also triggers the shutdown, and its error is returned.
+func (s *Server) Run(ctx context.Context) error {
+	app := s.app
+
+	srv := &http.Server{
+		Addr:         fmt.Sprintf(":%d", app.config.Port),
+		Handler:      s.handler,
+		ErrorLog:     log.New(app.logger, "", 0),
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+
+	app.lifecycle.Append(lifecycle.Hook{
+		Name:    "http server",
+		Timeout: 30 * time.Second,
+		OnShutdown: func(ctx context.Context) error {
+			return srv.Shutdown(ctx)
+		},
+	})
+
+	err := app.lifecycle.Start(ctx)
+	if err != nil {
+		s.Shutdown(context.Background())
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	shutdownError := make(chan error, 1)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			app.logger.PrintInfo("shutting down server", nil)
+		case <-app.workers.done():
+			app.logger.PrintInfo("shutting down server after a critical background worker failed", nil)
+		}
+
+		shutdownError <- s.Shutdown(context.Background())
+	}()
+
+	app.logger.PrintInfo("starting server", map[string]string{
+		"addr": srv.Addr,
+		"env":  app.config.Env,
+		"mode": app.config.Mode,
+	})
+
+	err = srv.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		cancel()
+		<-shutdownError
+		return err
+	}
+
+	err = <-shutdownError
+	if err != nil {
+		return err
+	}
+
+	err = app.workers.err()
+	if err != nil {
+		return err
+	}
+
+	app.logger.PrintInfo("stopped server", map[string]string{
+		"addr": srv.Addr,
+	})
+
+	return nil
+}
+
+// newMailSender returns the mailer backend selected in Config.Mailer. The log
+// backend writes to logOutput, alongside the application's logs.
+func newMailSender(cfg Config, logOutput io.Writer) (mailer.Sender, error) {
+	switch cfg.Mailer.Backend {
+	case MailerSendGrid:
+		return mailer.NewSendGridSender(cfg.Mailer.SendGrid.APIKey), nil
+	case MailerSES:
+		return mailer.NewSESSender(cfg.Mailer.SES.Region)
+	case MailerLog:
+		return mailer.NewLogSender(logOutput), nil
+	default:
+		s := cfg.Mailer.SMTP
+		return mailer.NewSMTPSender(s.Host, s.Port, s.Username, s.Password), nil
+	}
+}
+
+// newStorage returns the poster storage backend selected in Config.Storage.
+func newStorage(cfg Config) (storage.Storage, error) {
+	switch cfg.Storage.Backend {
+	case StorageS3:
+		s := cfg.Storage.S3
+		return storage.NewS3Storage(s.Bucket, s.Region, s.Endpoint, s.URL)
+	default:
+		return storage.NewDiskStorage(cfg.Storage.Disk.Dir, cfg.Storage.Disk.URL)
+	}
+}
+
+// openDB opens a connection pool for the DSN. With DB.Schema set, the
+// connections' search_path puts that schema first, so the unqualified table
+// names in the models resolve to it, and the schema must already exist.
+func openDB(ctx context.Context, cfg Config, dsn string) (*sql.DB, error) {
+	if cfg.DB.Schema != "" {
+		var err error
+
+		dsn, err = withSearchPath(dsn, cfg.DB.Schema)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := otelsql.Open("postgres", dsn, otelsql.WithAttributes(semconv.DBSystemPostgreSQL))
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(cfg.DB.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.DB.MaxIdleConns)
+
+	duration, err := time.ParseDuration(cfg.DB.MaxIdleTime)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetConnMaxIdleTime(duration)
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.DB.Schema != "" {
+		var exists bool
+
+		err = db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = $1)", cfg.DB.Schema).Scan(&exists)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+
+		if !exists {
+			db.Close()
+			return nil, fmt.Errorf("database schema %q doesn't exist; create it before running the migrations", cfg.DB.Schema)
+		}
+	}
+
+	return db, nil
+}
+
+// withSearchPath returns the DSN with its search_path set to the schema,
+// followed by public so that extensions such as citext installed there are
+// still found. lib/pq passes the parameter through to the server as a
+// run-time setting, for both URL and key=value DSNs.
+func withSearchPath(dsn, schema string) (string, error) {
+	searchPath := schema + ",public"
+
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", err
+		}
+
+		q := u.Query()
+		q.Set("search_path", searchPath)
+		u.RawQuery = q.Encode()
+
+		return u.String(), nil
+	}
+
+	return fmt.Sprintf("%s search_path='%s'", dsn, searchPath), nil
+}
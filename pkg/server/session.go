@@ -0,0 +1,80 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"time"
+)
+
+const sessionCookieName = "greenlight_session"
+
+// setSessionCookie stores an authentication JWT in an HttpOnly cookie for
+// first-party browser clients, so that scripts on the page can't read it.
+// The JWT is signed, so the cookie can't be tampered with.
+func (app *application) setSessionCookie(w http.ResponseWriter, token string, expiry time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiry,
+		HttpOnly: true,
+		Secure:   app.config.Env != "development",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (app *application) clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   app.config.Env != "development",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+const (
+	csrfCookieName = "greenlight_csrf"
+	csrfHeaderName = "X-CSRF-Token"
+)
+
+// newCSRFToken generates a random CSRF token, stores it in a cookie, and
+// returns it. Browser clients send it back in the X-CSRF-Token header on
+// unsafe requests (the double-submit cookie pattern): another site can make
+// the browser send our cookies, but it can't read them to set the header.
+func (app *application) newCSRFToken(w http.ResponseWriter) (string, error) {
+	randomBytes := make([]byte, 32)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(randomBytes)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Path:     "/",
+		Secure:   app.config.Env != "development",
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	return token, nil
+}
+
+func (app *application) createCSRFTokenHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := app.newCSRFToken(w)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"csrf_token": token}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+)
+
+// The components reported on the status page.
+const (
+	componentAPI       = "api"
+	componentDatabase  = "database"
+	componentMailer    = "mailer"
+	componentMailQueue = "mail_queue"
+)
+
+var statusComponents = []string{componentAPI, componentDatabase, componentMailer, componentMailQueue}
+
+// statusIncidentWindow is how long resolved incidents stay on the status
+// page.
+const statusIncidentWindow = 7 * 24 * time.Hour
+
+type componentStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// checkComponents reports the current status of each component.
+func (app *application) checkComponents(ctx context.Context) []componentStatus {
+	statuses := make([]componentStatus, 0, len(statusComponents))
+
+	api := data.StatusOperational
+	if !app.ready.Load() {
+		api = data.StatusDegraded
+	}
+	statuses = append(statuses, componentStatus{componentAPI, api})
+
+	database := data.StatusOperational
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	if err := app.models.Ping(ctx); err != nil {
+		database = data.StatusOutage
+	}
+	statuses = append(statuses, componentStatus{componentDatabase, database})
+
+	mailer := data.StatusOperational
+	if app.mailQueue.Failing() {
+		mailer = data.StatusDegraded
+	}
+	statuses = append(statuses, componentStatus{componentMailer, mailer})
+
+	// A full queue rejects new emails, so it counts as an outage; one which
+	// is filling up is degraded.
+	queue := data.StatusOperational
+	stats := app.mailQueue.Stats()
+	switch {
+	case stats.Queued >= stats.Capacity:
+		queue = data.StatusOutage
+	case stats.Queued*5 >= stats.Capacity*4:
+		queue = data.StatusDegraded
+	}
+	statuses = append(statuses, componentStatus{componentMailQueue, queue})
+
+	return statuses
+}
+
+// overallStatus returns the worst status among the components.
+func overallStatus(statuses []componentStatus) string {
+	overall := data.StatusOperational
+
+	for _, s := range statuses {
+		switch s.Status {
+		case data.StatusOutage:
+			return data.StatusOutage
+		case data.StatusDegraded:
+			overall = data.StatusDegraded
+		}
+	}
+
+	return overall
+}
+
+// healthRecorder stores the status of every component straight away, and
+// then at every interval until ctx is cancelled. The stored history is what
+// the status page computes uptime from.
+func (app *application) healthRecorder(ctx context.Context) error {
+	ticker := time.NewTicker(app.config.Status.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+
+		statuses := app.checkComponents(ctx)
+		checks := make([]data.HealthCheck, len(statuses))
+		for i, s := range statuses {
+			checks[i] = data.HealthCheck{Component: s.Name, Status: s.Status, CheckedAt: now}
+		}
+
+		err := app.models.HealthChecks.InsertBatch(checks)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"worker": "health recorder"})
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// statusHandler summarizes the health of the service for a public status
+// page. It must keep working while the database is down, so failures to
+// load the uptime history or incidents are logged and those sections left
+// out rather than failing the request. Concurrent requests share one set of
+// checks.
+func (app *application) statusHandler(w http.ResponseWriter, r *http.Request) {
+	v, _, _ := app.reads.Do("status", func() (any, error) {
+		statuses := app.checkComponents(context.Background())
+
+		env := envelope{
+			"status":     overallStatus(statuses),
+			"components": statuses,
+			"updated_at": time.Now(),
+		}
+
+		uptime, err := app.models.HealthChecks.UptimeByComponent()
+		if err != nil {
+			app.logError(r, err)
+		} else {
+			env["uptime"] = uptime
+		}
+
+		incidents, err := app.models.Incidents.GetRecent(statusIncidentWindow)
+		if err != nil {
+			app.logError(r, err)
+		} else {
+			env["incidents"] = incidents
+		}
+
+		return env, nil
+	})
+
+	// The envelope is copied, because writeJSON can add a meta object to
+	// it, and it is shared with the other requests.
+	env := make(envelope)
+	for key, value := range v.(envelope) {
+		env[key] = value
+	}
+
+	err := app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// statusHistoryHandler returns the recorded status of one component over the
+// last few hours, as periods of unchanged status. The number of transitions
+// makes a flapping component easy to spot.
+func (app *application) statusHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	component := app.readString(qs, "component", componentDatabase)
+	hours := app.readInt(qs, "hours", 24, v)
+
+	v.Check(validator.PermittedValue(component, statusComponents...), "component", "must be a known component")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+
+	periods, err := app.models.HealthChecks.GetHistory(component, since)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"component":   component,
+		"since":       since,
+		"periods":     periods,
+		"transitions": max(len(periods)-1, 0),
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
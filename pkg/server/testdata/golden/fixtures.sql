@@ -0,0 +1,132 @@
+-- The data the golden database cases run against. TestGolden loads it
+-- before every case, so that the cases don't depend on each other or on
+-- what is already in the database. Everything but the roles and
+-- permissions is deleted first, so only point GREENLIGHT_TEST_DB_DSN at a
+-- database made for the tests.
+--
+-- Every fixture user's password is "pa55word-golden", hashed with bcrypt's
+-- minimum cost.
+
+TRUNCATE movies, movies_genres, movie_revisions, genres, vocabularies,
+    users, users_roles, users_permissions, tokens, personal_access_tokens,
+    api_keys, totp_secrets, totp_recovery_codes, reviews, watchlist,
+    watch_progress, health_checks, incidents, email_suppressions,
+    analytics_events
+RESTART IDENTITY CASCADE;
+
+INSERT INTO genres (id, name, label)
+VALUES
+    (1, 'action', 'Action'),
+    (2, 'comedy', 'Comedy'),
+    (3, 'drama', 'Drama'),
+    (4, 'western', 'Western');
+
+INSERT INTO vocabularies (vocabulary, value, label)
+VALUES
+    ('certifications', 'PG', 'Parental guidance suggested'),
+    ('certifications', 'R', 'Restricted'),
+    ('languages', 'en', 'English'),
+    ('languages', 'fr', 'French');
+
+INSERT INTO movies (id, created_at, title, year, runtime, certification, language, rating_count, rating_sum)
+VALUES
+    (1, '2024-01-01T00:00:00Z', 'Casablanca', 1942, 102, 'PG', 'en', 2, 9),
+    (2, '2024-01-02T00:00:00Z', 'Moana', 2016, 107, 'PG', 'en', 0, 0),
+    (3, '2024-01-03T00:00:00Z', 'The Breakfast Club', 1985, 97, 'R', 'en', 1, 3);
+
+INSERT INTO movies_genres (movie_id, genre_id, position)
+VALUES
+    (1, 3, 1),
+    (2, 1, 1),
+    (2, 2, 2),
+    (3, 2, 1),
+    (3, 3, 2);
+
+-- The revisions recorded by the insert trigger predate the genres, and are
+-- dated now rather than when the movies were created.
+UPDATE movie_revisions
+SET genres = movie_genres(movie_revisions.movie_id), valid_from = movies.created_at
+FROM movies
+WHERE movies.id = movie_revisions.movie_id;
+
+INSERT INTO users (id, created_at, name, email, password_hash, activated, email_status, pending_email)
+VALUES
+    (1, '2024-01-01T00:00:00Z', 'Golden Admin', 'admin@example.com', '$2a$04$f.SCdLnEzLXMCQ.X7JT.vOeMamGwN9GD.zpXEGckyO/rGvm01BaQC', true, 'deliverable', NULL),
+    (2, '2024-01-02T00:00:00Z', 'Golden Viewer', 'viewer@example.com', '$2a$04$f.SCdLnEzLXMCQ.X7JT.vOeMamGwN9GD.zpXEGckyO/rGvm01BaQC', true, 'deliverable', 'viewer.new@example.com'),
+    (3, '2024-01-03T00:00:00Z', 'Golden Inactive', 'inactive@example.com', '$2a$04$f.SCdLnEzLXMCQ.X7JT.vOeMamGwN9GD.zpXEGckyO/rGvm01BaQC', false, 'unchecked', NULL);
+
+INSERT INTO users_roles (user_id, role)
+VALUES
+    (1, 'admin'),
+    (2, 'viewer'),
+    (3, 'viewer');
+
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT users.id, permissions.id
+FROM users, permissions
+WHERE permissions.code = 'movies:read';
+
+-- The plaintexts of the tokens are in golden_test.go.
+INSERT INTO tokens (hash, user_id, expiry, scope)
+VALUES
+    (sha256('GOLDENACTIVATE234567ABCDEF'), 3, NOW() + INTERVAL '3 days', 'activation'),
+    (sha256('GOLDENEMAILCHANGE234567ABC'), 2, NOW() + INTERVAL '3 days', 'email_change'),
+    (sha256('GOLDENPASSWORDRESET234567A'), 2, NOW() + INTERVAL '45 minutes', 'password_reset');
+
+INSERT INTO personal_access_tokens (id, user_id, name, hash, scopes, created_at, expiry)
+VALUES
+    (1, 1, 'CI', sha256('pat_golden'), '{read:movies}', '2024-04-01T00:00:00Z', NOW() + INTERVAL '30 days');
+
+INSERT INTO api_keys (id, user_id, name, hash, scopes, created_at)
+VALUES
+    (1, 1, 'Backend', sha256('ak_golden'), '{read:movies,write:movies}', '2024-04-02T00:00:00Z');
+
+-- The viewer has started enrolling in two-factor authentication, but not
+-- confirmed it.
+INSERT INTO totp_secrets (user_id, secret)
+VALUES
+    (2, 'JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP');
+
+INSERT INTO reviews (id, movie_id, user_id, rating, body, created_at)
+VALUES
+    (1, 1, 2, 5, 'A classic.', '2024-02-01T00:00:00Z'),
+    (2, 1, 1, 4, '', '2024-02-02T00:00:00Z'),
+    (3, 3, 1, 3, 'Dated, but fun.', '2024-02-03T00:00:00Z');
+
+INSERT INTO watchlist (user_id, movie_id, added_at)
+VALUES
+    (2, 1, '2024-03-01T00:00:00Z'),
+    (2, 3, '2024-03-02T00:00:00Z');
+
+INSERT INTO watch_progress (user_id, movie_id, position, completed, device, updated_at)
+VALUES
+    (2, 1, 600, false, 'tv', '2024-03-03T00:00:00Z'),
+    (2, 3, 5820, true, 'phone', '2024-03-04T00:00:00Z');
+
+-- The database was out for the first of its four checks, and everything
+-- else has been up.
+INSERT INTO health_checks (component, status, checked_at)
+VALUES
+    ('database', 'outage', NOW() - INTERVAL '4 hours'),
+    ('database', 'operational', NOW() - INTERVAL '3 hours'),
+    ('database', 'operational', NOW() - INTERVAL '2 hours'),
+    ('database', 'operational', NOW() - INTERVAL '1 hour'),
+    ('api', 'operational', NOW() - INTERVAL '1 hour'),
+    ('mailer', 'operational', NOW() - INTERVAL '1 hour'),
+    ('mail_queue', 'operational', NOW() - INTERVAL '1 hour');
+
+INSERT INTO incidents (id, title, body, status, components, created_at, updated_at)
+VALUES
+    (1, 'Mail delays', 'Emails are taking longer than usual to arrive.', 'investigating', '{mailer}', NOW() - INTERVAL '1 hour', NOW() - INTERVAL '1 hour');
+
+INSERT INTO email_suppressions (email, reason, created_at)
+VALUES
+    ('bounced@example.com', 'hard bounce', '2024-05-01T00:00:00Z');
+
+SELECT setval('movies_id_seq', 3);
+SELECT setval('genres_id_seq', 4);
+SELECT setval('users_id_seq', 3);
+SELECT setval('personal_access_tokens_id_seq', 1);
+SELECT setval('api_keys_id_seq', 1);
+SELECT setval('reviews_id_seq', 3);
+SELECT setval('incidents_id_seq', 1);
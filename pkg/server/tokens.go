@@ -0,0 +1,215 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+	"github.com/agung-learns/ebook-go-further/internal/mailer"
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+)
+
+func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email        string `json:"email"`
+		Password     string `json:"password"`
+		TOTPCode     string `json:"totp_code"`
+		RecoveryCode string `json:"recovery_code"`
+		Cookie       bool   `json:"cookie"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	// The password is only checked for presence, not with
+	// ValidatePasswordPlaintext, so that users whose passwords predate its
+	// strength rules can still log in.
+	data.ValidateEmail(v, input.Email)
+	v.Check(input.Password != "", "password", "must be provided")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !match {
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	err = app.verifySecondFactor(user, input.TOTPCode, input.RecoveryCode)
+	if err != nil {
+		switch {
+		case errors.Is(err, errTOTPRequired):
+			app.twoFactorRequiredResponse(w, r)
+		case errors.Is(err, errInvalidTOTPCode):
+			app.invalidCredentialsResponse(w, r)
+		case errors.Is(err, errTOTPLocked):
+			app.totpLockedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.rehashPassword(r, user, input.Password)
+
+	jwtBytes, expiry, err := app.newAuthenticationJWT(user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Browser clients can ask for the token to be set as a session cookie
+	// instead of being returned in the response body.
+	if input.Cookie && app.config.Session.Enabled {
+		app.setSessionCookie(w, string(jwtBytes), expiry)
+
+		csrfToken, err := app.newCSRFToken(w)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		env := envelope{
+			"session": envelope{
+				"expiry":     expiry,
+				"csrf_token": csrfToken,
+			},
+		}
+
+		err = app.writeJSON(w, http.StatusCreated, env, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	env := envelope{
+		"authentication_token": envelope{
+			"token":  string(jwtBytes),
+			"expiry": expiry,
+		},
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revokeAuthenticationTokenHandler revokes the authentication JWT the
+// request was authenticated with, signing the client out. Other tokens
+// issued to the user stay valid.
+func (app *application) revokeAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	claims := app.contextGetAuthenticationJWT(r)
+	if claims == nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "the request must be authenticated with an authentication token")
+		return
+	}
+
+	if claims.ID == "" || claims.Expires == nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "the authentication token can't be revoked, and will stay valid until it expires")
+		return
+	}
+
+	err := app.revocations.Revoke(r.Context(), claims.ID, claims.Expires.Time())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if app.contextIsSessionAuthenticated(r) {
+		app.clearSessionCookie(w)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "authentication token successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createPasswordResetTokenHandler emails the user a token which
+// resetUserPasswordHandler accepts in place of their current password.
+func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("email", "no matching email address found")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !user.Activated {
+		v.AddError("email", "user account must be activated")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	token, err := app.models.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	emailData := map[string]any{
+		"passwordResetToken": token.Plaintext,
+	}
+
+	err = app.mailQueue.Enqueue(user.Email, "password_reset.tmpl", emailData, mailer.WithLanguage(user.Language))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"message": "an email will be sent to you containing password reset instructions"}
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
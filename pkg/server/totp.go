@@ -0,0 +1,226 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+	"github.com/agung-learns/ebook-go-further/internal/totp"
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+)
+
+// totpIssuer names the service in users' authenticator apps.
+const totpIssuer = "Greenlight"
+
+// enrollTOTPHandler starts two-factor enrollment. The returned secret and
+// recovery codes are only shown once. Two-factor authentication isn't
+// required at login until the user confirms a code from their app. The
+// user's current password is required, so that a stolen session can't be
+// used to lock the owner out.
+func (app *application) enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	v := validator.New()
+
+	v.Check(input.CurrentPassword != "", "current_password", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	match, err := user.Password.Matches(input.CurrentPassword)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !match {
+		v.AddError("current_password", "is incorrect")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	recoveryCodes, err := data.GenerateRecoveryCodes()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Transaction(func(m data.Models) error {
+		return m.TOTP.Enroll(user.ID, secret, recoveryCodes)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.totpAlreadyEnabledResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	env := envelope{
+		"totp": envelope{
+			"secret":           secret,
+			"provisioning_uri": totp.ProvisioningURI(totpIssuer, user.Email, secret),
+			"recovery_codes":   recoveryCodes,
+		},
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// confirmTOTPHandler enables two-factor authentication once the user sends a
+// valid code from their authenticator app.
+func (app *application) confirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTOTPCode(v, input.Code); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	enrollment, err := app.models.TOTP.Get(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.useTOTPCode(enrollment, input.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, errInvalidTOTPCode):
+			v.AddError("code", "invalid or expired code")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "two-factor authentication enabled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+var errInvalidTOTPCode = errors.New("invalid totp code")
+
+// useTOTPCode checks a code against the enrollment and marks its time step
+// as used. Codes which don't match, or which were already used, return
+// errInvalidTOTPCode.
+func (app *application) useTOTPCode(enrollment *data.TOTP, code string) error {
+	step, ok := totp.Validate(enrollment.Secret, code, time.Now(), 1)
+	if !ok {
+		return errInvalidTOTPCode
+	}
+
+	err := app.models.TOTP.UseStep(enrollment.UserID, step)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTOTPCodeReused):
+			return errInvalidTOTPCode
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// verifySecondFactor checks the second factor of a login. Users who haven't
+// enabled two-factor authentication pass straight away. Otherwise either a
+// current code or an unused recovery code is needed; errTOTPRequired is
+// returned if neither was sent, and errInvalidTOTPCode if the one sent is
+// wrong.
+//
+// Failed attempts are counted per user, whichever IP address they come
+// from, and once Config.TOTP.MaxFailures have failed within
+// Config.TOTP.FailureWindow, errTOTPLocked is returned without checking the
+// code until the window has passed. A successful attempt resets the count.
+func (app *application) verifySecondFactor(user *data.User, code, recoveryCode string) error {
+	enrollment, err := app.models.TOTP.Get(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil
+		default:
+			return err
+		}
+	}
+
+	if !enrollment.Enabled {
+		return nil
+	}
+
+	if code == "" && recoveryCode == "" {
+		return errTOTPRequired
+	}
+
+	err = app.models.TOTP.StartAttempt(user.ID, app.config.TOTP.MaxFailures, app.config.TOTP.FailureWindow)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTOTPLocked):
+			return errTOTPLocked
+		default:
+			return err
+		}
+	}
+
+	if code != "" {
+		err = app.useTOTPCode(enrollment, code)
+	} else {
+		err = app.models.TOTP.UseRecoveryCode(user.ID, recoveryCode)
+		if errors.Is(err, data.ErrRecordNotFound) {
+			err = errInvalidTOTPCode
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return app.models.TOTP.ResetFailures(user.ID)
+}
+
+var (
+	errTOTPRequired = errors.New("totp code required")
+	errTOTPLocked   = errors.New("too many failed totp attempts")
+)
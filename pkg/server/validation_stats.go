@@ -0,0 +1,120 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// validationStatsRetention is the number of days of validation failure
+// counts which are kept in memory.
+const validationStatsRetention = 30
+
+// validationStats aggregates validation failures per day, keyed by endpoint,
+// field and rule, so we can see which fields clients most often get wrong.
+// The counts are published as the "validation_failures" expvar.
+type validationStats struct {
+	mu   sync.Mutex
+	days map[string]map[string]int
+}
+
+func newValidationStats() *validationStats {
+	return &validationStats{days: make(map[string]map[string]int)}
+}
+
+func (s *validationStats) record(endpoint, field, rule string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	day := time.Now().UTC().Format(time.DateOnly)
+
+	counts, ok := s.days[day]
+	if !ok {
+		counts = make(map[string]int)
+		s.days[day] = counts
+		s.prune()
+	}
+
+	counts[fmt.Sprintf("%s %s: %s", endpoint, field, rule)]++
+}
+
+// prune removes the oldest days beyond the retention period. It must be
+// called with the mutex held.
+func (s *validationStats) prune() {
+	if len(s.days) <= validationStatsRetention {
+		return
+	}
+
+	days := make([]string, 0, len(s.days))
+	for day := range s.days {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+
+	for _, day := range days[:len(days)-validationStatsRetention] {
+		delete(s.days, day)
+	}
+}
+
+func (s *validationStats) snapshot() any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := make(map[string]map[string]int, len(s.days))
+
+	for day, counts := range s.days {
+		snapshot[day] = make(map[string]int, len(counts))
+		for key, count := range counts {
+			snapshot[day][key] = count
+		}
+	}
+
+	return snapshot
+}
+
+// routePattern reconstructs the route pattern of a request, such as
+// "/v1/movies/:id", by replacing the path segments which were captured as
+// router parameters with the parameter names.
+func routePattern(r *http.Request) string {
+	params := httprouter.ParamsFromContext(r.Context())
+	if len(params) == 0 {
+		return r.URL.Path
+	}
+
+	segments := strings.Split(r.URL.Path, "/")
+
+	for _, param := range params {
+		for i, segment := range segments {
+			if segment == param.Value {
+				segments[i] = ":" + param.Key
+				break
+			}
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// recordValidationFailures logs a structured event for each failed field
+// and adds it to the daily aggregates. The endpoint is identified by the
+// route pattern rather than the request path, so requests for different
+// resources are counted together.
+func (app *application) recordValidationFailures(r *http.Request, errors map[string]string) {
+	endpoint := r.Method + " " + routePattern(r)
+
+	logger := app.requestLogger(r)
+
+	for field, rule := range errors {
+		logger.PrintInfo("validation failure", map[string]string{
+			"endpoint": endpoint,
+			"field":    field,
+			"rule":     rule,
+		})
+		app.validationStats.record(endpoint, field, rule)
+	}
+}
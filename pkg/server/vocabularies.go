@@ -0,0 +1,192 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// readVocabularyParam returns the vocabulary named in the URL, or false if
+// there is no such vocabulary.
+func (app *application) readVocabularyParam(r *http.Request) (string, bool) {
+	name := httprouter.ParamsFromContext(r.Context()).ByName("name")
+	return name, slices.Contains(data.AllVocabularies, name)
+}
+
+// validateMovie runs the static movie checks and, if they pass, checks the
+// movie against the controlled vocabularies. The returned error is for
+// failures to load the vocabularies; validation failures are added to v.
+func (app *application) validateMovie(v *validator.Validator, movie *data.Movie) error {
+	if data.ValidateMovie(v, movie); !v.Valid() {
+		return nil
+	}
+
+	vocabularies, err := app.models.Vocabularies.GetAll()
+	if err != nil {
+		return err
+	}
+
+	data.ValidateMovieVocabularies(v, movie, vocabularies)
+
+	return nil
+}
+
+func (app *application) listVocabulariesHandler(w http.ResponseWriter, r *http.Request) {
+	vocabularies, err := app.models.Vocabularies.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"vocabularies": vocabularies}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showVocabularyHandler(w http.ResponseWriter, r *http.Request) {
+	name, ok := app.readVocabularyParam(r)
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	terms, err := app.models.Vocabularies.Get(name)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"vocabulary": name, "terms": terms}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createTermHandler(w http.ResponseWriter, r *http.Request) {
+	name, ok := app.readVocabularyParam(r)
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Value string `json:"value"`
+		Label string `json:"label"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	term := &data.Term{Value: input.Value, Label: input.Label}
+
+	v := validator.New()
+
+	if data.ValidateTerm(v, term); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Vocabularies.Insert(name, term)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateTerm):
+			v.AddError("value", "is already in this vocabulary")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/vocabularies/%s", name))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"term": term}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateTermHandler(w http.ResponseWriter, r *http.Request) {
+	name, ok := app.readVocabularyParam(r)
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Label string `json:"label"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	term := &data.Term{
+		Value: httprouter.ParamsFromContext(r.Context()).ByName("value"),
+		Label: input.Label,
+	}
+
+	v := validator.New()
+
+	if data.ValidateTerm(v, term); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Vocabularies.UpdateLabel(name, term)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"term": term}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteTermHandler(w http.ResponseWriter, r *http.Request) {
+	name, ok := app.readVocabularyParam(r)
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	value := httprouter.ParamsFromContext(r.Context()).ByName("value")
+
+	err := app.models.Vocabularies.Delete(name, value)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrTermInUse):
+			app.termInUseResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "term successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+
+	"github.com/pascaldekloe/jwt"
+	"golang.org/x/sync/errgroup"
+)
+
+// warmUpPaths are the hot catalog reads whose responses warm-up primes the
+// response cache with.
+var warmUpPaths = []string{"/v1/movies", "/v1/movies/featured"}
+
+// warmUp prepares the application to serve traffic without first-request
+// latency spikes. It pre-establishes the idle connections in the database
+// pools, parses the email templates, checks that the JWT keys can sign and
+// check a token, and primes the hot catalog reads, then marks the
+// application as ready so that /v1/readyz starts reporting healthy.
+// Failures are logged but don't prevent the application from becoming
+// ready, because every step is only an optimization.
+func (app *application) warmUp(db, readDB *sql.DB, handler http.Handler) {
+	start := time.Now()
+
+	err := warmDBPool(db, app.config.DB.MaxIdleConns, app.config.DB.MaxOpenConns)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"warm_up": "database pool"})
+	}
+
+	if readDB != nil {
+		err = warmDBPool(readDB, app.config.DB.MaxIdleConns, app.config.DB.MaxOpenConns)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"warm_up": "read replica pool"})
+		}
+	}
+
+	err = app.mailer.ParseTemplates()
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"warm_up": "email templates"})
+	}
+
+	err = app.checkJWTKeys()
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"warm_up": "jwt keys"})
+	}
+
+	filters := data.Filters{
+		Page:     1,
+		PageSize: 20,
+		Sort:     "id",
+		SortKeys: data.MovieSortKeys,
+	}
+
+	_, _, err = app.models.Movies.GetAll("", []string{}, filters)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"warm_up": "movie list"})
+	}
+
+	err = app.primeResponseCache(handler)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"warm_up": "response cache"})
+	}
+
+	app.ready.Store(true)
+
+	app.logger.PrintInfo("warm-up completed", map[string]string{"duration": time.Since(start).String()})
+}
+
+// warmDBPool opens n connections concurrently, or as many as the pool
+// allows if that is fewer, and then returns them to the pool, leaving them
+// idle and ready for use.
+func warmDBPool(db *sql.DB, n, maxOpen int) error {
+	if maxOpen > 0 {
+		n = min(n, maxOpen)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var (
+		mu    sync.Mutex
+		conns = make([]*sql.Conn, 0, n)
+	)
+
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	// Every connection is held until they have all been opened, so that
+	// each goroutine gets a new one rather than one another has returned.
+	for i := 0; i < n; i++ {
+		g.Go(func() error {
+			conn, err := db.Conn(ctx)
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+
+			return conn.PingContext(ctx)
+		})
+	}
+
+	return g.Wait()
+}
+
+// checkJWTKeys signs a token and checks it, so that a key which can do
+// neither is found before users try to log in.
+func (app *application) checkJWTKeys() error {
+	var claims jwt.Claims
+	claims.Subject = "warm-up"
+
+	token, err := app.jwtKeys.sign(&claims)
+	if err != nil {
+		return err
+	}
+
+	_, err = app.jwtKeys.check(token)
+	return err
+}
+
+// primeResponseCache requests the warmUpPaths through the full handler, so
+// that their responses are cached. Responses are cached per user, so only
+// the anonymous ones, which are served in guest mode, are worth priming.
+func (app *application) primeResponseCache(handler http.Handler) error {
+	if !app.config.Cache.Enabled || !app.config.Guest.Enabled {
+		return nil
+	}
+
+	for _, path := range warmUpPaths {
+		r, err := http.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			return err
+		}
+		r.RemoteAddr = "127.0.0.1:0"
+
+		w := &discardResponseWriter{header: make(http.Header), status: http.StatusOK}
+		handler.ServeHTTP(w, r)
+
+		// An empty catalog has no featured movie, which isn't a failure.
+		if w.status >= http.StatusInternalServerError {
+			return fmt.Errorf("priming %s: status %d", path, w.status)
+		}
+	}
+
+	return nil
+}
+
+// discardResponseWriter throws away a response, keeping only its status.
+type discardResponseWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *discardResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardResponseWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *discardResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
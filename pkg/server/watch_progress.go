@@ -0,0 +1,127 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/agung-learns/ebook-go-further/internal/data"
+	"github.com/agung-learns/ebook-go-further/internal/validator"
+)
+
+// continueWatchingLimit is the number of movies returned by the continue
+// watching list.
+const continueWatchingLimit = 20
+
+// updateWatchProgressHandler records the user's playback position in a
+// movie. When several devices report progress for the same movie, the one
+// which recorded it most recently wins, so the response always contains the
+// progress which is now stored. If that isn't what was sent, the client
+// should resume from it instead.
+func (app *application) updateWatchProgressHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		PositionSeconds *int32     `json:"position_seconds"`
+		Completed       bool       `json:"completed"`
+		Device          string     `json:"device"`
+		UpdatedAt       *time.Time `json:"updated_at"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.PositionSeconds != nil, "position_seconds", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	progress := &data.WatchProgress{
+		MovieID:         movie.ID,
+		UserID:          app.contextGetUser(r).ID,
+		PositionSeconds: *input.PositionSeconds,
+		Completed:       input.Completed,
+		Device:          input.Device,
+		UpdatedAt:       time.Now(),
+	}
+
+	if input.UpdatedAt != nil {
+		progress.UpdatedAt = *input.UpdatedAt
+	}
+
+	if data.ValidateWatchProgress(v, progress, movie); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.WatchProgress.Upsert(progress)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"watch_progress": progress}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showWatchProgressHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	progress, err := app.models.WatchProgress.Get(app.contextGetUser(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"watch_progress": progress}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// continueWatchingHandler lists the movies the user has started but not
+// finished, most recently watched first.
+func (app *application) continueWatchingHandler(w http.ResponseWriter, r *http.Request) {
+	progress, err := app.models.WatchProgress.GetUnfinishedForUser(app.contextGetUser(r).ID, continueWatchingLimit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"watch_progress": progress}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}